@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/FilipeParreiras/Bookings/internal/driver"
+	"github.com/FilipeParreiras/Bookings/internal/migrations"
+	"log"
+	"os"
+)
+
+const usage = `Usage: migrate [flags] <command>
+
+Commands:
+  up        apply all pending migrations
+  down      roll back the latest migration (see -steps)
+  status    list migrations and whether they are applied
+
+Flags:
+`
+
+func main() {
+	// Read flags - to use inside command line
+	dbDriver := flag.String("dbdriver", driver.Postgres, "Database driver (postgres, sqlite)")
+	dbHost := flag.String("dbhost", "localhost", "Database host")
+	dbName := flag.String("dbname", "", "Database name, or the database file with sqlite")
+	dbUser := flag.String("dbuser", "", "Database user")
+	dbPass := flag.String("dbpass", "", "Database password")
+	dbPort := flag.String("dbport", "5432", "Database port")
+	dbSSL := flag.String("dbssl", "disable", "Database ssl settings (disable prefer, require)")
+	steps := flag.Int("steps", 1, "Number of migrations to roll back with down")
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *dbName == "" || (*dbDriver == driver.Postgres && *dbUser == "") || flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	var db *driver.DB
+	var err error
+	switch *dbDriver {
+	case driver.Postgres:
+		connectionString := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s",
+			*dbHost, *dbPort, *dbName, *dbUser, *dbPass, *dbSSL)
+		db, err = driver.ConnectSQL(connectionString)
+	case driver.SQLite:
+		db, err = driver.ConnectSQLite(*dbName)
+	default:
+		log.Fatal("Unknown database driver ", *dbDriver)
+	}
+	if err != nil {
+		log.Fatal("Cannot connect to database! Dying...")
+	}
+	defer db.SQL.Close()
+
+	// the driver names double as migration dialects
+	migrator, err := migrations.New(db.SQL, db.Driver)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	switch flag.Arg(0) {
+	case "up":
+		done, err := migrator.Up(ctx)
+		for _, m := range done {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(done) == 0 {
+			fmt.Println("no pending migrations")
+		}
+
+	case "down":
+		done, err := migrator.Down(ctx, *steps)
+		for _, m := range done {
+			fmt.Printf("rolled back %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(done) == 0 {
+			fmt.Println("no applied migrations")
+		}
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range statuses {
+			if s.Applied {
+				fmt.Printf("%04d_%-40s applied %s\n", s.Version, s.Name, s.AppliedAt.Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Printf("%04d_%-40s pending\n", s.Version, s.Name)
+			}
+		}
+
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+}
@@ -1,19 +1,23 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/FilipeParreiras/Bookings/internal/config"
 	"github.com/FilipeParreiras/Bookings/internal/driver"
 	"github.com/FilipeParreiras/Bookings/internal/handlers"
 	"github.com/FilipeParreiras/Bookings/internal/helpers"
+	"github.com/FilipeParreiras/Bookings/internal/migrations"
 	"github.com/FilipeParreiras/Bookings/internal/models"
 	"github.com/FilipeParreiras/Bookings/internal/render"
 	"github.com/alexedwards/scs/v2"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -38,6 +42,9 @@ func main() {
 	fmt.Println("Starting mail listener...")
 	listenForMail()
 
+	fmt.Println("Starting webhook sender...")
+	listenForWebhooks(context.Background())
+
 	fmt.Println(fmt.Printf("Starting application on port %s", portNumber))
 
 	// Routing
@@ -55,23 +62,30 @@ func run() (*driver.DB, error) {
 	gob.Register(models.User{})
 	gob.Register(models.Room{})
 	gob.Register(models.Restriction{})
+	gob.Register(models.Booking{})
 	gob.Register(map[string]int{})
 
 	// Read flags - to use inside command line
 	inProduction := flag.Bool("production", true, "Application is in production")
 	useCache := flag.Bool("cache", true, "Use template cache")
+	dbDriver := flag.String("dbdriver", driver.Postgres, "Database driver (postgres, sqlite)")
 	dbHost := flag.String("dbhost", "localhost", "Database host")
-	dbName := flag.String("dbname", "", "Database name")
+	dbName := flag.String("dbname", "", "Database name, or the database file with sqlite")
 	dbUser := flag.String("dbuser", "", "Database user")
 	dbPass := flag.String("dbpass", "", "Database password")
 	dbPort := flag.String("dbport", "5432", "Database port")
 	dbSSL := flag.String("dbssl", "disable", "Database ssl settings (disable prefer, require)")
+	dbTimeout := flag.Duration("dbtimeout", 3*time.Second, "Default timeout for database queries")
+	baseURL := flag.String("baseurl", "http://localhost"+portNumber, "Public url of the site, used in emailed links")
 
 	flag.Parse()
 
-	if *dbName == "" || *dbUser == "" {
-		fmt.Println("Missing required flags")
-		os.Exit(1)
+	if *dbName == "" || (*dbDriver == driver.Postgres && *dbUser == "") {
+		return nil, errors.New("missing required flags")
+	}
+
+	if *dbDriver != driver.Postgres && *dbDriver != driver.SQLite {
+		return nil, fmt.Errorf("unknown database driver %s", *dbDriver)
 	}
 
 	mailChan := make(chan models.MailData)
@@ -80,6 +94,8 @@ func run() (*driver.DB, error) {
 	// Change this to true when is production
 	app.InProduction = *inProduction
 	app.UseCache = *useCache
+	app.DBTimeout = *dbTimeout
+	app.BaseURL = strings.TrimSuffix(*baseURL, "/")
 
 	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	app.InfoLog = infoLog
@@ -98,18 +114,38 @@ func run() (*driver.DB, error) {
 
 	// connect to database
 	log.Println("Connecting to Database...")
-	connectionString := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s",
-		*dbHost, *dbPort, *dbName, *dbUser, *dbPass, *dbSSL)
-	db, err := driver.ConnectSQL(connectionString)
+	var db *driver.DB
+	var err error
+	if *dbDriver == driver.SQLite {
+		db, err = driver.ConnectSQLite(*dbName)
+	} else {
+		connectionString := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s",
+			*dbHost, *dbPort, *dbName, *dbUser, *dbPass, *dbSSL)
+		db, err = driver.ConnectSQL(connectionString)
+	}
 	if err != nil {
-		log.Fatal("Cannot connect to database! Dying...")
+		return nil, fmt.Errorf("cannot connect to database: %w", err)
+	}
+
+	// a sqlite file is local to this binary, so keep its schema up to date on start
+	if db.Driver == driver.SQLite {
+		migrator, err := migrations.New(db.SQL, migrations.SQLite)
+		if err != nil {
+			return nil, err
+		}
+		applied, err := migrator.Up(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range applied {
+			log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+		}
 	}
 
 	// template cache
 	tc, err := render.CreateTemplateCache()
 	if err != nil {
-		log.Fatal("Cannot create template cache")
-		return nil, err
+		return nil, fmt.Errorf("cannot create template cache: %w", err)
 	}
 	app.TemplateCache = tc
 
@@ -117,6 +153,7 @@ func run() (*driver.DB, error) {
 	handlers.NewHandlers(repo)
 
 	render.NewRenderer(&app)
+	render.NewMenu(repo.DB)
 	helpers.NewHelpers(&app)
 
 	return db, nil
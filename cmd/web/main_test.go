@@ -1,10 +1,21 @@
 package main
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 func TestRun(t *testing.T) {
-	_, err := run()
+	// run reads the command line, so give it a sqlite database of its own
+	args := os.Args
+	defer func() { os.Args = args }()
+	os.Args = []string{args[0], "-dbdriver=sqlite", "-dbname=" + filepath.Join(t.TempDir(), "bookings.db"),
+		"-production=false"}
+
+	db, err := run()
 	if err != nil {
-		t.Error("failed run")
+		t.Fatalf("failed run: %v", err)
 	}
+	defer db.SQL.Close()
 }
@@ -1,9 +1,18 @@
 package main
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/FilipeParreiras/Bookings/internal/access"
+	"github.com/FilipeParreiras/Bookings/internal/apikeys"
+	"github.com/FilipeParreiras/Bookings/internal/handlers"
 	"github.com/FilipeParreiras/Bookings/internal/helpers"
+	"github.com/FilipeParreiras/Bookings/internal/openapi"
 	"github.com/justinas/nosurf"
 	"net/http"
+	"strings"
+	"time"
 )
 
 // SessionLoad uses a function called LoadAndSave which provides middleware which
@@ -16,6 +25,8 @@ func SessionLoad(next http.Handler) http.Handler {
 // NoSurf deals with CSRF
 func NoSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
+	// the api authenticates requests with an api key instead of the session cookie
+	csrfHandler.ExemptRegexp("^/api/")
 
 	csrfHandler.SetBaseCookie(http.Cookie{
 		HttpOnly: true,
@@ -27,13 +38,124 @@ func NoSurf(next http.Handler) http.Handler {
 	return csrfHandler
 }
 
-// Auth checks if the user is already authenticated
+// Auth checks that the user is logged in with a role, and puts the user in the request's context for Can
 func Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		if !helpers.IsAuthenticated(request) {
 			session.Put(request.Context(), "error", "Log in first.")
 			http.Redirect(writer, request, "/user/login", http.StatusSeeOther)
+			return
 		}
+
+		// the user is loaded on every request, so a change of role or a deleted user applies at once
+		user, err := handlers.Repo.DB.GetUserByID(request.Context(), session.GetInt(request.Context(), "user_id"))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			helpers.ServerError(writer, err)
+			return
+		}
+
+		// deleted and deactivated users, users whose password was reset and sessions from before either are
+		// logged out
+		if err != nil || !user.Active || user.Password == "" ||
+			session.GetInt(request.Context(), "session_version") != user.SessionVersion {
+			session.Remove(request.Context(), "user_id")
+			session.Remove(request.Context(), "session_version")
+			session.Put(request.Context(), "error", "Log in first.")
+			http.Redirect(writer, request, "/user/login", http.StatusSeeOther)
+			return
+		}
+
+		if _, ok := access.RoleFor(user.AccessLevel); !ok {
+			session.Put(request.Context(), "error", "Your account has no access to the admin area.")
+			http.Redirect(writer, request, "/", http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(writer, request.WithContext(access.WithUser(request.Context(), user)))
+	})
+}
+
+// Can only lets users whose role has the permission through, after Auth
+func Can(permission access.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			role, ok := access.RoleFrom(request.Context())
+			if !ok || !role.Can(permission) {
+				session.Put(request.Context(), "error", "You do not have permission to do that.")
+				http.Redirect(writer, request, "/admin/dashboard", http.StatusSeeOther)
+				return
+			}
+
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// APIAuth checks the api key of requests to the api, sent as a bearer token, and that its scope allows the request
+func APIAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		token, found := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+		if !found || token == "" {
+			apiError(writer, http.StatusUnauthorized, "Unauthorized", nil)
+			return
+		}
+
+		key, err := handlers.Repo.DB.GetAPIKeyByHash(request.Context(), apikeys.Hash(token))
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !key.RevokedAt.IsZero()) {
+			apiError(writer, http.StatusUnauthorized, "Unauthorized", nil)
+			return
+		}
+		if err != nil {
+			app.ErrorLog.Println(err)
+			apiError(writer, http.StatusInternalServerError, "Internal server error", nil)
+			return
+		}
+
+		if !apikeys.Allows(key.Scope, request.Method) {
+			apiError(writer, http.StatusForbidden, "This api key can only read", nil)
+			return
+		}
+
+		// a failed update should not fail the request
+		if err := handlers.Repo.DB.UpdateAPIKeyLastUsed(request.Context(), key.ID, time.Now()); err != nil {
+			app.ErrorLog.Println(err)
+		}
+
 		next.ServeHTTP(writer, request)
 	})
 }
+
+// ValidateAPIRequest checks the parameters and body of requests to the api against its OpenAPI document
+func ValidateAPIRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		err := handlers.APIDocument().ValidateRequest(request)
+
+		var fields openapi.Errors
+		switch {
+		case err == nil:
+			next.ServeHTTP(writer, request)
+		case errors.Is(err, openapi.ErrInvalidJSON):
+			apiError(writer, http.StatusBadRequest, "Invalid json body", nil)
+		case errors.As(err, &fields):
+			apiError(writer, http.StatusUnprocessableEntity, "Request does not match the api", fields)
+		default:
+			app.ErrorLog.Println(err)
+			apiError(writer, http.StatusInternalServerError, "Internal server error", nil)
+		}
+	})
+}
+
+// apiError sends a json error like the api handlers do, with the messages for each invalid field if there are any
+func apiError(writer http.ResponseWriter, status int, message string, fields openapi.Errors) {
+	body, _ := json.Marshal(struct {
+		Error  string              `json:"error"`
+		Fields map[string][]string `json:"fields,omitempty"`
+	}{message, fields})
+
+	writer.Header().Set("Content-Type", "application/json")
+	if status == http.StatusUnauthorized {
+		writer.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+	}
+	writer.WriteHeader(status)
+	writer.Write(body)
+}
@@ -1,9 +1,23 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"github.com/FilipeParreiras/Bookings/internal/access"
+	"github.com/FilipeParreiras/Bookings/internal/apikeys"
+	"github.com/FilipeParreiras/Bookings/internal/handlers"
+	"github.com/FilipeParreiras/Bookings/internal/helpers"
+	"github.com/FilipeParreiras/Bookings/internal/models"
+	"github.com/FilipeParreiras/Bookings/internal/repository/dbrepo/memrepo"
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-chi/chi/v5"
+	"log"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNoSurve(t *testing.T) {
@@ -31,3 +45,221 @@ func TestSessionLoad(t *testing.T) {
 
 	}
 }
+
+func TestAPIAuth(t *testing.T) {
+	app.ErrorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime)
+	handlers.NewHandlers(&handlers.Repository{App: &app, DB: memrepo.New(&app)})
+
+	keys := make(map[string]string)
+	for _, scope := range []string{apikeys.ScopeRead, apikeys.ScopeWrite, "revoked"} {
+		key, prefix, hash, err := apikeys.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		apiKey := models.APIKey{Name: scope, Prefix: prefix, KeyHash: hash, Scope: apikeys.ScopeWrite}
+		if scope != "revoked" {
+			apiKey.Scope = scope
+		}
+		id, err := handlers.Repo.DB.InsertAPIKey(context.Background(), apiKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if scope == "revoked" {
+			handlers.Repo.DB.RevokeAPIKey(context.Background(), id)
+		}
+		keys[scope] = key
+	}
+
+	var myH myHandler
+	h := APIAuth(&myH)
+
+	var tests = []struct {
+		name         string
+		method       string
+		header       string
+		expectedCode int
+	}{
+		{"read key reads", "GET", "Bearer " + keys[apikeys.ScopeRead], http.StatusOK},
+		{"read key books", "POST", "Bearer " + keys[apikeys.ScopeRead], http.StatusForbidden},
+		{"write key books", "POST", "Bearer " + keys[apikeys.ScopeWrite], http.StatusOK},
+		{"write key cancels", "DELETE", "Bearer " + keys[apikeys.ScopeWrite], http.StatusOK},
+		{"revoked key", "GET", "Bearer " + keys["revoked"], http.StatusUnauthorized},
+		{"unknown key", "GET", "Bearer bk_guess", http.StatusUnauthorized},
+		{"no key", "GET", "", http.StatusUnauthorized},
+		{"not a bearer token", "GET", "Basic " + keys[apikeys.ScopeRead], http.StatusUnauthorized},
+	}
+
+	for _, e := range tests {
+		request := httptest.NewRequest(e.method, "/api/v1/reservations", nil)
+		if e.header != "" {
+			request.Header.Set("Authorization", e.header)
+		}
+		responseRecorder := httptest.NewRecorder()
+
+		h.ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedCode, responseRecorder.Code)
+		}
+	}
+
+	// using a key records when
+	key, err := handlers.Repo.DB.GetAPIKeyByHash(context.Background(), apikeys.Hash(keys[apikeys.ScopeRead]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.LastUsedAt.IsZero() {
+		t.Error("using the key did not record when it was last used")
+	}
+}
+
+func TestValidateAPIRequest(t *testing.T) {
+	var myH myHandler
+	h := ValidateAPIRequest(&myH)
+
+	var tests = []struct {
+		name         string
+		method       string
+		target       string
+		body         string
+		expectedCode int
+	}{
+		{"valid search", "GET", "/api/v1/availability?start=2050-01-01&end=2050-01-02", "", http.StatusOK},
+		{"bad date", "GET", "/api/v1/availability?start=01/01/2050&end=2050-01-02", "", http.StatusUnprocessableEntity},
+		{"bad id", "GET", "/api/v1/rooms/one", "", http.StatusUnprocessableEntity},
+		{"valid booking", "POST", "/api/v1/reservations",
+			`{"room_id": 1, "start_date": "2050-01-01", "end_date": "2050-01-02", "first_name": "John", "last_name": "Smith",
+			"email": "john@here.com"}`, http.StatusOK},
+		{"missing fields", "POST", "/api/v1/reservations", `{"room_id": 1}`, http.StatusUnprocessableEntity},
+		{"not json", "POST", "/api/v1/reservations", `room_id=1`, http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		request := httptest.NewRequest(e.method, e.target, strings.NewReader(e.body))
+		responseRecorder := httptest.NewRecorder()
+
+		h.ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d: %s", e.name, e.expectedCode, responseRecorder.Code,
+				responseRecorder.Body.String())
+		}
+	}
+}
+
+func TestAuth(t *testing.T) {
+	app.ErrorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime)
+	session = scs.New()
+	app.Session = session
+	helpers.NewHelpers(&app)
+	repo := &handlers.Repository{App: &app, DB: memrepo.New(&app)}
+	handlers.NewHandlers(repo)
+
+	users := make(map[string]int)
+	for name, accessLevel := range map[string]int{"read-only": 1, "front desk": 2, "manager": 3, "no role": 0} {
+		id, err := repo.DB.(*memrepo.Repo).AddUser(models.User{
+			Email:       strings.ReplaceAll(name, " ", "-") + "@here.com",
+			AccessLevel: accessLevel,
+		}, "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		users[name] = id
+	}
+	users["deleted"] = 9999
+
+	// a deactivated manager and a manager whose password was reset are logged out, and so are the sessions they
+	// had before they were reactivated or set a new password
+	memory := repo.DB.(*memrepo.Repo)
+	for _, name := range []string{"deactivated", "reset", "reactivated", "new password"} {
+		id, err := memory.AddUser(models.User{Email: name + "@here.com", AccessLevel: 3}, "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		users[name] = id
+	}
+	if err := memory.UpdateUserActive(context.Background(), users["deactivated"], false); err != nil {
+		t.Fatal(err)
+	}
+	if err := memory.ResetPassword(context.Background(), users["reset"], strings.Repeat("a", 64), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	_ = memory.UpdateUserActive(context.Background(), users["reactivated"], false)
+	if err := memory.UpdateUserActive(context.Background(), users["reactivated"], true); err != nil {
+		t.Fatal(err)
+	}
+	_ = memory.ResetPassword(context.Background(), users["new password"], strings.Repeat("b", 64), time.Now())
+	if err := memory.UpdatePassword(context.Background(), users["new password"], "$2a$04$new"); err != nil {
+		t.Fatal(err)
+	}
+
+	var myH myHandler
+
+	var tests = []struct {
+		name             string
+		user             string
+		permission       access.Permission
+		expectedCode     int
+		expectedLocation string
+	}{
+		{"not logged in", "", access.ViewReservations, http.StatusSeeOther, "/user/login"},
+		{"deleted user", "deleted", access.ViewReservations, http.StatusSeeOther, "/user/login"},
+		{"deactivated user", "deactivated", access.ViewReservations, http.StatusSeeOther, "/user/login"},
+		{"reset password", "reset", access.ViewReservations, http.StatusSeeOther, "/user/login"},
+		{"reactivated user", "reactivated", access.ViewReservations, http.StatusSeeOther, "/user/login"},
+		{"new password", "new password", access.ViewReservations, http.StatusSeeOther, "/user/login"},
+		{"no role", "no role", access.ViewReservations, http.StatusSeeOther, "/"},
+		{"read-only views", "read-only", access.ViewReservations, http.StatusOK, ""},
+		{"read-only edits", "read-only", access.EditReservations, http.StatusSeeOther, "/admin/dashboard"},
+		{"front desk edits", "front desk", access.EditReservations, http.StatusOK, ""},
+		{"front desk deletes", "front desk", access.DeleteReservations, http.StatusSeeOther, "/admin/dashboard"},
+		{"manager deletes", "manager", access.DeleteReservations, http.StatusOK, ""},
+		{"manager adds a webhook", "manager", access.ManageIntegrations, http.StatusSeeOther, "/admin/dashboard"},
+		{"manager invites a user", "manager", access.ManageUsers, http.StatusSeeOther, "/admin/dashboard"},
+	}
+
+	for _, e := range tests {
+		request := httptest.NewRequest("GET", "/admin/anything", nil)
+		ctx, _ := session.Load(request.Context(), "")
+		if e.user != "" {
+			session.Put(ctx, "user_id", users[e.user])
+			session.Put(ctx, "session_version", 1)
+		}
+		request = request.WithContext(ctx)
+		responseRecorder := httptest.NewRecorder()
+
+		Auth(Can(e.permission)(&myH)).ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedCode, responseRecorder.Code)
+		}
+		if location := responseRecorder.Header().Get("Location"); location != e.expectedLocation {
+			t.Errorf("%s: expected to be sent to %q but got %q", e.name, e.expectedLocation, location)
+		}
+	}
+
+	// every page of the admin area asks anonymous visitors to log in
+	mux := routes(&app).(*chi.Mux)
+	checked := 0
+	err := chi.Walk(mux, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if method != "GET" || !strings.HasPrefix(route, "/admin/") {
+			return nil
+		}
+		request := httptest.NewRequest(method, route, nil)
+		responseRecorder := httptest.NewRecorder()
+
+		mux.ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != http.StatusSeeOther || responseRecorder.Header().Get("Location") != "/user/login" {
+			t.Errorf("%s %s is open to anonymous visitors", method, route)
+		}
+		checked++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked == 0 {
+		t.Fatal("no admin routes found")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/FilipeParreiras/Bookings/internal/access"
 	"github.com/FilipeParreiras/Bookings/internal/config"
 	"github.com/FilipeParreiras/Bookings/internal/handlers"
 	"net/http"
@@ -19,14 +20,20 @@ func routes(app *config.AppConfig) http.Handler {
 
 	mux.Get("/", handlers.Repo.Home)
 	mux.Get("/about", handlers.Repo.About)
-	mux.Get("/generals-quarters", handlers.Repo.Generals)
-	mux.Get("/majors-suite", handlers.Repo.Majors)
+	mux.Get("/rooms/{slug}", handlers.Repo.Room)
+
+	// the room pages used to live at the root
+	mux.Handle("/generals-quarters", http.RedirectHandler("/rooms/generals-quarters", http.StatusMovedPermanently))
+	mux.Handle("/majors-suite", http.RedirectHandler("/rooms/majors-suite", http.StatusMovedPermanently))
 
 	mux.Get("/search-availability", handlers.Repo.Availability)
 	mux.Post("/search-availability", handlers.Repo.PostAvailability)
 	mux.Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
+	mux.Get("/availability-grid-json", handlers.Repo.AvailabilityGridJSON)
 	mux.Get("/choose-room/{room_id}", handlers.Repo.ChooseRoom)
 	mux.Get("/book-room", handlers.Repo.BookRoom)
+	mux.Get("/make-split-reservation", handlers.Repo.SplitReservation)
+	mux.Post("/make-split-reservation", handlers.Repo.PostSplitReservation)
 
 	mux.Get("/make-reservation", handlers.Repo.Reservation)
 	mux.Post("/make-reservation", handlers.Repo.PostReservation)
@@ -36,6 +43,8 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Post("/user/login", handlers.Repo.PostShowLogin)
 	mux.Get("/user/logout", handlers.Repo.
 		Logout)
+	mux.Get("/user/set-password/{token}", handlers.Repo.ShowSetPassword)
+	mux.Post("/user/set-password/{token}", handlers.Repo.PostSetPassword)
 
 	mux.Get("/contact", handlers.Repo.Contact)
 
@@ -43,21 +52,90 @@ func routes(app *config.AppConfig) http.Handler {
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
-	// Routes to authenticated users
+	// Public api, json in and json out, for clients holding an api key
+	mux.Get("/api/openapi.json", handlers.Repo.APIOpenAPI)
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.Use(APIAuth)
+		mux.Use(ValidateAPIRequest)
+		mux.NotFound(handlers.Repo.APINotFound)
+		mux.MethodNotAllowed(handlers.Repo.APIMethodNotAllowed)
+
+		mux.Get("/rooms", handlers.Repo.APIRooms)
+		mux.Get("/rooms/{id}", handlers.Repo.APIRoom)
+		mux.Get("/availability", handlers.Repo.APIAvailability)
+		mux.Post("/reservations", handlers.Repo.APIPostReservation)
+		mux.Get("/reservations/{id}", handlers.Repo.APIReservation)
+		mux.Delete("/reservations/{id}", handlers.Repo.APIDeleteReservation)
+	})
+
+	// Routes to authenticated users, each group open to the roles with its permission
 	mux.Route("/admin", func(mux chi.Router) {
-		//mux.Use(Auth)
-		mux.Get("/dashboard", handlers.Repo.AdminDashboard)
+		mux.Use(Auth)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(Can(access.ViewReservations))
+			mux.Get("/dashboard", handlers.Repo.AdminDashboard)
+			mux.Get("/reservations-new", handlers.Repo.AdminNewReservations)
+			mux.Get("/reservations-all", handlers.Repo.AdminAllReservations)
+			mux.Get("/reservations-calendar", handlers.Repo.AdminCalendarReservations)
+			mux.Get("/reservations/{src}/{id}/show", handlers.Repo.AdminShowReservation)
+		})
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(Can(access.EditReservations))
+			mux.Post("/reservations-calendar", handlers.Repo.AdminPostCalendarReservations)
+			mux.Post("/block-room", handlers.Repo.AdminPostBlockRoom)
+			mux.Get("/process-reservation/{src}/{id}/do", handlers.Repo.AdminProcessReservation)
+			mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminPostShowReservation)
+		})
+
+		mux.With(Can(access.DeleteReservations)).
+			Get("/delete-reservation/{src}/{id}/do", handlers.Repo.AdminDeleteReservation)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(Can(access.ManageRooms))
+			mux.Get("/rooms", handlers.Repo.AdminRooms)
+			mux.Get("/rooms/{id}/show", handlers.Repo.AdminShowRoom)
+			mux.Post("/rooms/{id}", handlers.Repo.AdminPostRoom)
+			mux.Get("/toggle-room/{id}/do", handlers.Repo.AdminToggleRoom)
+			mux.Get("/move-room/{id}/{direction}/do", handlers.Repo.AdminMoveRoom)
+			mux.Get("/delete-room/{id}/do", handlers.Repo.AdminDeleteRoom)
+			mux.Get("/rooms/{id}/rates", handlers.Repo.AdminRoomRates)
+			mux.Post("/rooms/{id}/rates", handlers.Repo.AdminPostRoomRate)
+			mux.Get("/delete-room-rate/{room_id}/{id}/do", handlers.Repo.AdminDeleteRoomRate)
+			mux.Get("/rooms/{id}/units", handlers.Repo.AdminRoomUnits)
+			mux.Post("/rooms/{id}/units", handlers.Repo.AdminPostRoomUnit)
+			mux.Get("/delete-room-unit/{room_id}/{id}/do", handlers.Repo.AdminDeleteRoomUnit)
+			mux.Get("/rooms/{id}/rules", handlers.Repo.AdminStayRules)
+			mux.Post("/rooms/{id}/rules", handlers.Repo.AdminPostStayRule)
+			mux.Get("/delete-stay-rule/{room_id}/{id}/do", handlers.Repo.AdminDeleteStayRule)
+
+			mux.Get("/restrictions", handlers.Repo.AdminRestrictions)
+			mux.Get("/restrictions/{id}/show", handlers.Repo.AdminShowRestriction)
+			mux.Post("/restrictions/{id}", handlers.Repo.AdminPostRestriction)
+			mux.Get("/delete-restriction/{id}/do", handlers.Repo.AdminDeleteRestriction)
+		})
 
-		mux.Get("/reservations-new", handlers.Repo.AdminNewReservations)
-		mux.Get("/reservations-all", handlers.Repo.AdminAllReservations)
-		mux.Get("/reservations-calendar", handlers.Repo.AdminCalendarReservations)
-		mux.Post("/reservations-calendar", handlers.Repo.AdminPostCalendarReservations)
-		mux.Get("/process-reservation/{src}/{id}/do", handlers.Repo.AdminProcessReservation)
-		mux.Get("/delete-reservation/{src}/{id}/do", handlers.Repo.AdminDeleteReservation)
+		mux.Group(func(mux chi.Router) {
+			mux.Use(Can(access.ManageIntegrations))
+			mux.Get("/api-keys", handlers.Repo.AdminAPIKeys)
+			mux.Post("/api-keys", handlers.Repo.AdminPostAPIKey)
+			mux.Post("/revoke-api-key/{id}/do", handlers.Repo.AdminRevokeAPIKey)
 
-		mux.Get("/reservations/{src}/{id}/show", handlers.Repo.AdminShowReservation)
-		mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminPostShowReservation)
+			mux.Get("/webhooks", handlers.Repo.AdminWebhooks)
+			mux.Post("/webhooks", handlers.Repo.AdminPostWebhook)
+			mux.Post("/delete-webhook/{id}/do", handlers.Repo.AdminDeleteWebhook)
+			mux.Get("/webhook-deliveries", handlers.Repo.AdminWebhookDeliveries)
+		})
 
+		mux.Group(func(mux chi.Router) {
+			mux.Use(Can(access.ManageUsers))
+			mux.Get("/users", handlers.Repo.AdminUsers)
+			mux.Get("/users/{id}/show", handlers.Repo.AdminShowUser)
+			mux.Post("/users/{id}", handlers.Repo.AdminPostUser)
+			mux.Post("/toggle-user/{id}/do", handlers.Repo.AdminToggleUser)
+			mux.Post("/reset-user-password/{id}/do", handlers.Repo.AdminResetUserPassword)
+		})
 	})
 
 	return mux
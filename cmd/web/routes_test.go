@@ -3,7 +3,11 @@ package main
 import (
 	"fmt"
 	"github.com/FilipeParreiras/Bookings/internal/config"
+	"github.com/FilipeParreiras/Bookings/internal/handlers"
 	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -19,3 +23,78 @@ func TestRoutes(t *testing.T) {
 		t.Error(fmt.Sprintf("type is not chi.Mux type is instaad %T", v))
 	}
 }
+
+// TestAPIRoutesMatchDocument fails when an api route is added or removed without updating the OpenAPI document
+func TestAPIRoutesMatchDocument(t *testing.T) {
+	var app config.AppConfig
+
+	mux := routes(&app).(*chi.Mux)
+	document := handlers.APIDocument()
+
+	routed := make(map[string]bool)
+	err := chi.Walk(mux, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		route = strings.TrimSuffix(route, "/")
+		if !strings.HasPrefix(route, "/api/v1/") {
+			return nil
+		}
+		routed[method+" "+route] = true
+		if op, _ := document.Find(method, route); op == nil {
+			t.Errorf("%s %s is not in the OpenAPI document", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routed) == 0 {
+		t.Fatal("no api routes found")
+	}
+
+	for path, item := range document.Paths {
+		for method := range item {
+			if !routed[strings.ToUpper(method)+" "+path] {
+				t.Errorf("%s %s is in the OpenAPI document but not routed", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+// TestAdminActionsArePosts checks that admin actions which change state are only routed for POST requests, which
+// nosurf refuses without the CSRF token
+func TestAdminActionsArePosts(t *testing.T) {
+	var app config.AppConfig
+
+	mux := routes(&app).(*chi.Mux)
+
+	var actions = []string{
+		"/admin/toggle-user/{id}/do",
+		"/admin/reset-user-password/{id}/do",
+		"/admin/revoke-api-key/{id}/do",
+		"/admin/delete-webhook/{id}/do",
+	}
+
+	routed := make(map[string][]string)
+	err := chi.Walk(mux, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		routed[route] = append(routed[route], method)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, action := range actions {
+		if methods := routed[action]; len(methods) != 1 || methods[0] != "POST" {
+			t.Errorf("%s is routed for %v, wanted only POST", action, methods)
+		}
+
+		request := httptest.NewRequest("POST", strings.ReplaceAll(action, "{id}", "1"), nil)
+		responseRecorder := httptest.NewRecorder()
+
+		mux.ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != http.StatusBadRequest {
+			t.Errorf("%s without a CSRF token returned %d, wanted %d", action, responseRecorder.Code,
+				http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"context"
+	"github.com/FilipeParreiras/Bookings/internal/handlers"
+	"github.com/FilipeParreiras/Bookings/internal/webhooks"
+	"time"
+)
+
+// webhookInterval is how often the queue is checked for due webhook deliveries
+const webhookInterval = 15 * time.Second
+
+// listenForWebhooks sends the queued webhook deliveries in the background until ctx is done
+func listenForWebhooks(ctx context.Context) {
+	sender := webhooks.NewSender(handlers.Repo.DB, app.ErrorLog)
+
+	go sender.Run(ctx, webhookInterval)
+}
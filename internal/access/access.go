@@ -0,0 +1,140 @@
+package access
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/FilipeParreiras/Bookings/internal/models"
+	"time"
+)
+
+// A user's role comes from their access level, and each role can do everything the roles below it can:
+//
+//	1 read-only   looks at reservations and the calendar
+//	2 front desk  also changes guest details, processes reservations and blocks rooms
+//	3 manager     also deletes reservations and manages rooms and restriction types
+//	4 owner       also manages api keys, webhooks and users
+//
+// Any other access level has no role and cannot use the admin area.
+
+// Role is what a user may do in the admin area
+type Role int
+
+// The roles, from the least to the most trusted
+const (
+	ReadOnly  Role = 1
+	FrontDesk Role = 2
+	Manager   Role = 3
+	Owner     Role = 4
+)
+
+// Roles are every role, in the order of their access levels
+var Roles = []Role{ReadOnly, FrontDesk, Manager, Owner}
+
+// Permission is something a route of the admin area lets a user do
+type Permission string
+
+// The permissions, also used in templates to show only what a user can do
+const (
+	ViewReservations   Permission = "view_reservations"
+	EditReservations   Permission = "edit_reservations"
+	DeleteReservations Permission = "delete_reservations"
+	ManageRooms        Permission = "manage_rooms"
+	ManageIntegrations Permission = "manage_integrations"
+	ManageUsers        Permission = "manage_users"
+)
+
+// minimum is the least trusted role with each permission
+var minimum = map[Permission]Role{
+	ViewReservations:   ReadOnly,
+	EditReservations:   FrontDesk,
+	DeleteReservations: Manager,
+	ManageRooms:        Manager,
+	ManageIntegrations: Owner,
+	ManageUsers:        Owner,
+}
+
+// RoleFor returns the role of an access level, and false for a level with no role
+func RoleFor(accessLevel int) (Role, bool) {
+	role := Role(accessLevel)
+	return role, role >= ReadOnly && role <= Owner
+}
+
+// String returns the name of the role shown to admins
+func (r Role) String() string {
+	switch r {
+	case ReadOnly:
+		return "Read-only"
+	case FrontDesk:
+		return "Front desk"
+	case Manager:
+		return "Manager"
+	case Owner:
+		return "Owner"
+	}
+	return "No access"
+}
+
+// Can reports if the role has the permission
+func (r Role) Can(p Permission) bool {
+	least, ok := minimum[p]
+	return ok && r >= least
+}
+
+// Permissions returns the permissions of the role by name, for templates
+func (r Role) Permissions() map[string]bool {
+	permissions := make(map[string]bool)
+	for p := range minimum {
+		if r.Can(p) {
+			permissions[string(p)] = true
+		}
+	}
+	return permissions
+}
+
+type contextKey struct{}
+
+// WithUser returns a copy of ctx with the logged in user
+func WithUser(ctx context.Context, user models.User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// UserFrom returns the logged in user put in ctx by WithUser
+func UserFrom(ctx context.Context) (models.User, bool) {
+	user, ok := ctx.Value(contextKey{}).(models.User)
+	return user, ok
+}
+
+// RoleFrom returns the role of the logged in user in ctx, and false when there is none
+func RoleFrom(ctx context.Context) (Role, bool) {
+	user, ok := UserFrom(ctx)
+	if !ok {
+		return 0, false
+	}
+	return RoleFor(user.AccessLevel)
+}
+
+// Invited users and users whose password was reset set a new password with a token sent to their email. Only a
+// hash of the token is stored, like api keys.
+
+// PasswordTokenLifetime is how long a password token can be used
+const PasswordTokenLifetime = 72 * time.Hour
+
+// GeneratePasswordToken returns a new random password token and its hash
+func GeneratePasswordToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token = hex.EncodeToString(b)
+
+	return token, HashPasswordToken(token), nil
+}
+
+// HashPasswordToken returns the hash a password token is stored and looked up by
+func HashPasswordToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
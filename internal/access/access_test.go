@@ -0,0 +1,98 @@
+package access
+
+import (
+	"context"
+	"github.com/FilipeParreiras/Bookings/internal/models"
+	"testing"
+)
+
+func TestRoleFor(t *testing.T) {
+	var tests = []struct {
+		accessLevel int
+		role        Role
+		ok          bool
+	}{
+		{0, 0, false},
+		{1, ReadOnly, true},
+		{2, FrontDesk, true},
+		{3, Manager, true},
+		{4, Owner, true},
+		{5, 0, false},
+		{-1, 0, false},
+	}
+
+	for _, e := range tests {
+		role, ok := RoleFor(e.accessLevel)
+		if ok != e.ok || (ok && role != e.role) {
+			t.Errorf("access level %d: expected %v %t but got %v %t", e.accessLevel, e.role, e.ok, role, ok)
+		}
+	}
+}
+
+func TestRole_Can(t *testing.T) {
+	var tests = []struct {
+		role       Role
+		permission Permission
+		expected   bool
+	}{
+		{ReadOnly, ViewReservations, true},
+		{ReadOnly, EditReservations, false},
+		{FrontDesk, EditReservations, true},
+		{FrontDesk, DeleteReservations, false},
+		{FrontDesk, ManageRooms, false},
+		{Manager, DeleteReservations, true},
+		{Manager, ManageRooms, true},
+		{Manager, ManageIntegrations, false},
+		{Manager, ManageUsers, false},
+		{Owner, ManageIntegrations, true},
+		{Owner, ManageUsers, true},
+		{Owner, Permission("launch_rockets"), false},
+		{Role(0), ViewReservations, false},
+	}
+
+	for _, e := range tests {
+		if can := e.role.Can(e.permission); can != e.expected {
+			t.Errorf("%s %s: expected %t but got %t", e.role, e.permission, e.expected, can)
+		}
+	}
+
+	permissions := FrontDesk.Permissions()
+	if len(permissions) != 2 || !permissions["view_reservations"] || !permissions["edit_reservations"] {
+		t.Errorf("unexpected front desk permissions %v", permissions)
+	}
+}
+
+func TestRoleFrom(t *testing.T) {
+	if _, ok := RoleFrom(context.Background()); ok {
+		t.Error("a context without a user has a role")
+	}
+
+	ctx := WithUser(context.Background(), models.User{ID: 1, AccessLevel: 3})
+	if role, ok := RoleFrom(ctx); !ok || role != Manager {
+		t.Errorf("expected a manager but got %v %t", role, ok)
+	}
+
+	ctx = WithUser(context.Background(), models.User{ID: 1, AccessLevel: 9})
+	if _, ok := RoleFrom(ctx); ok {
+		t.Error("an unknown access level has a role")
+	}
+}
+
+func TestGeneratePasswordToken(t *testing.T) {
+	token, hash, err := GeneratePasswordToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(token) != 64 || len(hash) != 64 || token == hash {
+		t.Errorf("unexpected token %q with hash %q", token, hash)
+	}
+	if HashPasswordToken(token) != hash {
+		t.Error("the token does not hash to its hash")
+	}
+
+	other, _, _ := GeneratePasswordToken()
+	if other == token {
+		t.Error("two tokens are the same")
+	}
+}
@@ -0,0 +1,56 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+// Keys are shown once when they are created and only their hash is stored. They are long and random, so a
+// plain sha256 is enough to look them up without keeping them.
+
+// Scopes of a key: read keys can only look, write keys can also book and cancel
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// keyPrefix starts every key, so they are easy to spot in scripts and logs
+const keyPrefix = "bk_"
+
+// prefixLength is how much of a key is kept to tell keys apart
+const prefixLength = 11
+
+// Generate returns a new random key, its prefix and its hash
+func Generate() (key, prefix, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+
+	key = keyPrefix + hex.EncodeToString(b)
+
+	return key, key[:prefixLength], Hash(key), nil
+}
+
+// Hash returns the hash a key is stored and looked up by
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidScope reports if scope is one a key can have
+func ValidScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeWrite
+}
+
+// Allows reports if a key with the scope can make a request with the method
+func Allows(scope, method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return ValidScope(scope)
+	default:
+		return scope == ScopeWrite
+	}
+}
@@ -0,0 +1,48 @@
+package apikeys
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	key, prefix, hash, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(key, prefix) || !strings.HasPrefix(prefix, "bk_") {
+		t.Errorf("key %q does not start with its prefix %q", key, prefix)
+	}
+	if hash != Hash(key) || len(hash) != 64 {
+		t.Errorf("unexpected hash %q", hash)
+	}
+
+	other, _, _, _ := Generate()
+	if other == key {
+		t.Error("two keys are the same")
+	}
+}
+
+func TestAllows(t *testing.T) {
+	var tests = []struct {
+		scope    string
+		method   string
+		expected bool
+	}{
+		{ScopeRead, http.MethodGet, true},
+		{ScopeRead, http.MethodPost, false},
+		{ScopeRead, http.MethodDelete, false},
+		{ScopeWrite, http.MethodGet, true},
+		{ScopeWrite, http.MethodPost, true},
+		{ScopeWrite, http.MethodDelete, true},
+		{"admin", http.MethodGet, false},
+	}
+
+	for _, e := range tests {
+		if got := Allows(e.scope, e.method); got != e.expected {
+			t.Errorf("%s %s: expected %t but got %t", e.scope, e.method, e.expected, got)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/FilipeParreiras/Bookings/internal/models"
 	"html/template"
 	"log"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
 )
@@ -17,4 +18,6 @@ type AppConfig struct {
 	InProduction  bool
 	Session       *scs.SessionManager
 	MailChan      chan models.MailData
+	DBTimeout     time.Duration
+	BaseURL       string // the public url of the site, without a trailing slash
 }
@@ -2,16 +2,25 @@ package driver
 
 import (
 	"database/sql"
+	"fmt"
 	"time"
 
 	_ "github.com/jackc/pgx/v5"
 	_ "github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// Drivers that can back the application
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
 )
 
 // DB holds the database connection pool
 type DB struct {
-	SQL *sql.DB
+	SQL    *sql.DB
+	Driver string
 }
 
 var dbConn = &DB{}
@@ -30,6 +39,7 @@ func ConnectSQL(dsn string) (*DB, error) {
 	db.SetConnMaxLifetime(maxDbLifetime)
 
 	dbConn.SQL = db
+	dbConn.Driver = Postgres
 
 	err = testDB(db)
 	if err != nil {
@@ -38,6 +48,31 @@ func ConnectSQL(dsn string) (*DB, error) {
 	return dbConn, nil
 }
 
+// ConnectSQLite opens the SQLite database file at path, creating it if it does not exist
+func ConnectSQLite(path string) (*DB, error) {
+	// dates are stored as sortable text so range comparisons work, and foreign keys
+	// must be switched on for every connection to get the same cascades as postgres
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite", path)
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite allows a single writer, so share one connection instead of failing with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	err = testDB(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DB{
+		SQL:    db,
+		Driver: SQLite,
+	}, nil
+}
+
 // testDB tries to ping the database
 func testDB(d *sql.DB) error {
 	err := d.Ping()
@@ -4,9 +4,15 @@ import (
 	"fmt"
 	"github.com/asaskevich/govalidator"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+var colourPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
 // Form creates a custom form struct, embeds a url.Values object
 type Form struct {
 	url.Values
@@ -60,3 +66,33 @@ func (f *Form) IsEmail(field string) {
 		f.Errors.Add(field, "Invalid email address")
 	}
 }
+
+// IsSlug checks that a field is a lowercase url slug, like generals-quarters
+func (f *Form) IsSlug(field string) {
+	if !slugPattern.MatchString(f.Get(field)) {
+		f.Errors.Add(field, "Use only lowercase letters, numbers and dashes")
+	}
+}
+
+// IsColour checks that a field is a hex colour, like #ffc107
+func (f *Form) IsColour(field string) {
+	if !colourPattern.MatchString(f.Get(field)) {
+		f.Errors.Add(field, "Enter a colour like #ffc107")
+	}
+}
+
+// IsURL checks that a field is an absolute http or https url, like https://example.com/hooks
+func (f *Form) IsURL(field string) {
+	u, err := url.Parse(strings.TrimSpace(f.Get(field)))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		f.Errors.Add(field, "Enter a url like https://example.com/hooks")
+	}
+}
+
+// IsNumber checks that a field is a whole number from min to max
+func (f *Form) IsNumber(field string, min, max int) {
+	x, err := strconv.Atoi(strings.TrimSpace(f.Get(field)))
+	if err != nil || x < min || x > max {
+		f.Errors.Add(field, fmt.Sprintf("Enter a number from %d to %d", min, max))
+	}
+}
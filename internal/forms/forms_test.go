@@ -128,3 +128,108 @@ func TestForm_IsEmail(t *testing.T) {
 		t.Error("got valid for invalid email address")
 	}
 }
+
+func TestForm_IsSlug(t *testing.T) {
+	var tests = []struct {
+		slug  string
+		valid bool
+	}{
+		{"generals-quarters", true},
+		{"room-2", true},
+		{"", false},
+		{"Generals-Quarters", false},
+		{"generals quarters", false},
+		{"-generals", false},
+		{"generals--quarters", false},
+	}
+
+	for _, e := range tests {
+		postedValues := url.Values{}
+		postedValues.Add("slug", e.slug)
+		form := New(postedValues)
+
+		form.IsSlug("slug")
+		if form.Valid() != e.valid {
+			t.Errorf("for %q expected valid to be %t", e.slug, e.valid)
+		}
+	}
+}
+
+func TestForm_IsColour(t *testing.T) {
+	var tests = []struct {
+		colour string
+		valid  bool
+	}{
+		{"#ffc107", true},
+		{"#0DCAF0", true},
+		{"", false},
+		{"ffc107", false},
+		{"#fff", false},
+		{"#ffc10g", false},
+		{"red", false},
+	}
+
+	for _, e := range tests {
+		postedValues := url.Values{}
+		postedValues.Add("colour", e.colour)
+		form := New(postedValues)
+
+		form.IsColour("colour")
+		if form.Valid() != e.valid {
+			t.Errorf("for %q expected valid to be %t", e.colour, e.valid)
+		}
+	}
+}
+
+func TestForm_IsNumber(t *testing.T) {
+	var tests = []struct {
+		number string
+		valid  bool
+	}{
+		{"1", true},
+		{"10", true},
+		{" 3 ", true},
+		{"0", false},
+		{"11", false},
+		{"", false},
+		{"2.5", false},
+		{"two", false},
+	}
+
+	for _, e := range tests {
+		postedValues := url.Values{}
+		postedValues.Add("number", e.number)
+		form := New(postedValues)
+
+		form.IsNumber("number", 1, 10)
+		if form.Valid() != e.valid {
+			t.Errorf("for %q expected valid to be %t", e.number, e.valid)
+		}
+	}
+}
+
+func TestForm_IsURL(t *testing.T) {
+	var tests = []struct {
+		url   string
+		valid bool
+	}{
+		{"https://example.com/hooks", true},
+		{"http://localhost:9000/hooks?source=bookings", true},
+		{"", false},
+		{"example.com/hooks", false},
+		{"ftp://example.com/hooks", false},
+		{"https://", false},
+		{"https://exa mple.com", false},
+	}
+
+	for _, e := range tests {
+		postedValues := url.Values{}
+		postedValues.Add("url", e.url)
+		form := New(postedValues)
+
+		form.IsURL("url")
+		if form.Valid() != e.valid {
+			t.Errorf("for %q expected valid to be %t", e.url, e.valid)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/FilipeParreiras/Bookings/internal/forms"
+	"github.com/FilipeParreiras/Bookings/internal/models"
+	"github.com/FilipeParreiras/Bookings/internal/pricing"
+	"github.com/FilipeParreiras/Bookings/internal/repository"
+	"github.com/FilipeParreiras/Bookings/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiRoom is a room in the responses of the api
+type apiRoom struct {
+	ID           int      `json:"id"`
+	Name         string   `json:"name"`
+	Slug         string   `json:"slug"`
+	Description  string   `json:"description"`
+	MaxOccupancy int      `json:"max_occupancy"`
+	NightlyRate  int      `json:"nightly_rate"` // in cents
+	WeekendRate  int      `json:"weekend_rate"` // in cents, 0 charges the nightly rate on weekends too
+	Units        int      `json:"units"`
+	Amenities    []string `json:"amenities"`
+}
+
+// apiAvailableRoom is a room that is free for the searched stay, with the price of the stay
+type apiAvailableRoom struct {
+	apiRoom
+	FreeUnits  int    `json:"free_units"`
+	TotalPrice int    `json:"total_price"` // in cents
+	Price      string `json:"price"`
+}
+
+// apiNewReservation is the body of a request to book a room
+type apiNewReservation struct {
+	RoomID    int    `json:"room_id" openapi:"minimum=1"`
+	StartDate string `json:"start_date" openapi:"format=date"`
+	EndDate   string `json:"end_date" openapi:"format=date"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone,omitempty"`
+	Adults    int    `json:"adults,omitempty" openapi:"minimum=1"` // 1 when not given
+	Children  int    `json:"children,omitempty" openapi:"minimum=0"`
+}
+
+// apiReservation is a reservation in the responses of the api
+type apiReservation struct {
+	ID         int    `json:"id"`
+	RoomID     int    `json:"room_id"`
+	RoomName   string `json:"room_name"`
+	StartDate  string `json:"start_date" openapi:"format=date"`
+	EndDate    string `json:"end_date" openapi:"format=date"`
+	FirstName  string `json:"first_name"`
+	LastName   string `json:"last_name"`
+	Email      string `json:"email"`
+	Phone      string `json:"phone"`
+	Adults     int    `json:"adults"`
+	Children   int    `json:"children"`
+	TotalPrice int    `json:"total_price"` // in cents
+	Price      string `json:"price"`
+	BookingID  int    `json:"booking_id,omitempty"` // the split stay the reservation is part of
+}
+
+// apiError is the body of every error response of the api
+type apiError struct {
+	Error  string              `json:"error"`
+	Fields map[string][]string `json:"fields,omitempty"` // messages for each invalid field
+}
+
+func newAPIRoom(room models.Room) apiRoom {
+	amenities := []string{}
+	for _, a := range room.Amenities {
+		amenities = append(amenities, a.Name)
+	}
+
+	return apiRoom{
+		ID:           room.ID,
+		Name:         room.RoomName,
+		Slug:         room.Slug,
+		Description:  room.Description,
+		MaxOccupancy: room.MaxOccupancy,
+		NightlyRate:  room.NightlyRate,
+		WeekendRate:  room.WeekendRate,
+		Units:        room.Units,
+		Amenities:    amenities,
+	}
+}
+
+func newAPIReservation(res models.Reservation) apiReservation {
+	return apiReservation{
+		ID:         res.ID,
+		RoomID:     res.RoomID,
+		RoomName:   res.Room.RoomName,
+		StartDate:  res.StartDate.Format("2006-01-02"),
+		EndDate:    res.EndDate.Format("2006-01-02"),
+		FirstName:  res.FirstName,
+		LastName:   res.LastName,
+		Email:      res.Email,
+		Phone:      res.Phone,
+		Adults:     res.Adults,
+		Children:   res.Children,
+		TotalPrice: res.TotalPrice,
+		Price:      pricing.Format(res.TotalPrice),
+		BookingID:  res.BookingID,
+	}
+}
+
+// writeJSON sends v as the json body of a response with the status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	out, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		status = http.StatusInternalServerError
+		out = []byte(`{"error": "Internal server error"}`)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// writeAPIError sends an error response with the message
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, apiError{Error: message})
+}
+
+// apiServerError logs err and sends an internal server error response
+func (m *Repository) apiServerError(w http.ResponseWriter, err error) {
+	m.App.ErrorLog.Println(err)
+	writeAPIError(w, http.StatusInternalServerError, "Internal server error")
+}
+
+// apiID returns the id url parameter, sending a not found response when it is not an id
+func apiID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id < 1 {
+		writeAPIError(w, http.StatusNotFound, "Not found")
+		return 0, false
+	}
+	return id, true
+}
+
+// APINotFound answers requests for api paths that do not exist
+func (m *Repository) APINotFound(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusNotFound, "Not found")
+}
+
+// APIMethodNotAllowed answers requests with a method an api path does not support
+func (m *Repository) APIMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusMethodNotAllowed, "Method not allowed")
+}
+
+// APIRooms sends the rooms guests can book, in display order
+func (m *Repository) APIRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	out := []apiRoom{}
+	for _, room := range rooms {
+		if room.Active {
+			out = append(out, newAPIRoom(room))
+		}
+	}
+
+	writeJSON(w, http.StatusOK, out)
+}
+
+// APIRoom sends a room by id
+func (m *Repository) APIRoom(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiID(w, r)
+	if !ok {
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !room.Active) {
+		writeAPIError(w, http.StatusNotFound, "Room not found")
+		return
+	}
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newAPIRoom(room))
+}
+
+// APIAvailability sends the rooms free from start to end that sleep the party and have every amenity asked for,
+// with the price of the stay. Rooms whose stay rules do not allow the stay are left out.
+func (m *Repository) APIAvailability(w http.ResponseWriter, r *http.Request) {
+	form := forms.New(r.URL.Query())
+	form.Required("start", "end")
+
+	startDate, startErr := time.Parse("2006-01-02", form.Get("start"))
+	endDate, endErr := time.Parse("2006-01-02", form.Get("end"))
+	if form.Valid() {
+		if startErr != nil {
+			form.Errors.Add("start", "Dates must be given as yyyy-mm-dd")
+		}
+		if endErr != nil {
+			form.Errors.Add("end", "Dates must be given as yyyy-mm-dd")
+		}
+		if startErr == nil && endErr == nil {
+			if field, msg := stayDates(startDate, endDate); field != "" {
+				form.Errors.Add(field, msg)
+			}
+		}
+	}
+
+	adults, children := guestCounts(form)
+
+	var amenityIDs []int
+	for _, v := range form.Values["amenity"] {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			form.Errors.Add("amenity", "Invalid amenity")
+			break
+		}
+		amenityIDs = append(amenityIDs, id)
+	}
+
+	if !form.Valid() {
+		writeJSON(w, http.StatusUnprocessableEntity, apiError{Error: "Invalid search", Fields: form.Errors})
+		return
+	}
+
+	rooms, err := m.DB.SearchAvailabilityForAllRooms(r.Context(), startDate, endDate, models.RoomSearch{
+		Guests:     adults + children,
+		AmenityIDs: amenityIDs,
+	})
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	out := []apiAvailableRoom{}
+	for _, room := range rooms {
+		err := m.checkStay(r.Context(), room.ID, startDate, endDate)
+		if _, ok := stayError(err); ok {
+			continue
+		}
+		if err != nil {
+			m.apiServerError(w, err)
+			return
+		}
+
+		quote, err := m.quote(r.Context(), room, startDate, endDate)
+		if err != nil {
+			m.apiServerError(w, err)
+			return
+		}
+
+		out = append(out, apiAvailableRoom{
+			apiRoom:    newAPIRoom(room),
+			FreeUnits:  room.FreeUnits,
+			TotalPrice: quote.Total,
+			Price:      pricing.Format(quote.Total),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, out)
+}
+
+// APIPostReservation books a room, checking the same things as the make a reservation form.
+// The price comes from the room's rates.
+func (m *Repository) APIPostReservation(w http.ResponseWriter, r *http.Request) {
+	var in apiNewReservation
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "Invalid json body")
+		return
+	}
+
+	// validate the reservation like the posted form
+	values := url.Values{}
+	values.Set("first_name", in.FirstName)
+	values.Set("last_name", in.LastName)
+	values.Set("email", in.Email)
+	values.Set("phone", in.Phone)
+	values.Set("start_date", in.StartDate)
+	values.Set("end_date", in.EndDate)
+	// like the form, a reservation without guest counts is for one adult
+	if in.Adults != 0 {
+		values.Set("adults", strconv.Itoa(in.Adults))
+	}
+	if in.Children != 0 {
+		values.Set("children", strconv.Itoa(in.Children))
+	}
+
+	form := forms.New(values)
+	form.Required("first_name", "last_name", "email", "start_date", "end_date")
+	form.MinLength("first_name", 3)
+	form.IsEmail("email")
+
+	adults, children := guestCounts(form)
+
+	startDate, startErr := time.Parse("2006-01-02", in.StartDate)
+	if startErr != nil && strings.TrimSpace(in.StartDate) != "" {
+		form.Errors.Add("start_date", "Dates must be given as yyyy-mm-dd")
+	}
+	endDate, endErr := time.Parse("2006-01-02", in.EndDate)
+	if endErr != nil && strings.TrimSpace(in.EndDate) != "" {
+		form.Errors.Add("end_date", "Dates must be given as yyyy-mm-dd")
+	}
+	if startErr == nil && endErr == nil {
+		if field, msg := stayDates(startDate, endDate); field != "" {
+			form.Errors.Add(field+"_date", msg)
+		}
+	}
+
+	room, err := m.DB.GetRoomByID(r.Context(), in.RoomID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !room.Active) {
+		form.Errors.Add("room_id", "Room not found")
+	} else if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	if form.Valid() && adults+children > room.MaxOccupancy {
+		form.Errors.Add("adults", fmt.Sprintf("This room sleeps up to %d guests", room.MaxOccupancy))
+	}
+
+	if form.Valid() {
+		err = m.checkStay(r.Context(), room.ID, startDate, endDate)
+		if msg, ok := stayError(err); ok {
+			form.Errors.Add("end_date", msg)
+		} else if err != nil {
+			m.apiServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		writeJSON(w, http.StatusUnprocessableEntity, apiError{Error: "Invalid reservation", Fields: form.Errors})
+		return
+	}
+
+	quote, err := m.quote(r.Context(), room, startDate, endDate)
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	reservation := models.Reservation{
+		FirstName:  in.FirstName,
+		LastName:   in.LastName,
+		Email:      in.Email,
+		Phone:      in.Phone,
+		StartDate:  startDate,
+		EndDate:    endDate,
+		RoomID:     room.ID,
+		Adults:     adults,
+		Children:   children,
+		TotalPrice: quote.Total,
+	}
+	reservation.Room.RoomName = room.RoomName
+
+	reservation.ID, err = m.DB.InsertReservationWithRestriction(r.Context(), reservation)
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		writeAPIError(w, http.StatusConflict, "Room is not available for the requested dates")
+		return
+	}
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	m.queueWebhooks(r.Context(), webhooks.EventReservationCreated, reservation)
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/reservations/%d", reservation.ID))
+	writeJSON(w, http.StatusCreated, newAPIReservation(reservation))
+}
+
+// APIReservation sends a reservation by id
+func (m *Repository) APIReservation(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiID(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := m.DB.GetReservationById(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeAPIError(w, http.StatusNotFound, "Reservation not found")
+		return
+	}
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newAPIReservation(res))
+}
+
+// APIDeleteReservation cancels a reservation, freeing its room
+func (m *Repository) APIDeleteReservation(w http.ResponseWriter, r *http.Request) {
+	id, ok := apiID(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := m.DB.GetReservationById(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeAPIError(w, http.StatusNotFound, "Reservation not found")
+		return
+	}
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	err = m.DB.DeleteReservation(r.Context(), id)
+	if err != nil {
+		m.apiServerError(w, err)
+		return
+	}
+
+	m.queueWebhooks(r.Context(), webhooks.EventReservationDeleted, res)
+
+	w.WriteHeader(http.StatusNoContent)
+}
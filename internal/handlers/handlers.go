@@ -1,19 +1,30 @@
 package handlers
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/FilipeParreiras/Bookings/internal/access"
+	"github.com/FilipeParreiras/Bookings/internal/apikeys"
 	"github.com/FilipeParreiras/Bookings/internal/config"
 	"github.com/FilipeParreiras/Bookings/internal/driver"
 	"github.com/FilipeParreiras/Bookings/internal/forms"
 	"github.com/FilipeParreiras/Bookings/internal/helpers"
 	"github.com/FilipeParreiras/Bookings/internal/models"
+	"github.com/FilipeParreiras/Bookings/internal/pricing"
 	"github.com/FilipeParreiras/Bookings/internal/render"
 	"github.com/FilipeParreiras/Bookings/internal/repository"
 	"github.com/FilipeParreiras/Bookings/internal/repository/dbrepo"
+	"github.com/FilipeParreiras/Bookings/internal/splitstay"
+	"github.com/FilipeParreiras/Bookings/internal/stayrules"
+	"github.com/FilipeParreiras/Bookings/internal/webhooks"
 	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/bcrypt"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -28,19 +39,18 @@ type Repository struct {
 	DB  repository.DatabaseRepo
 }
 
-// NewRepo creates a new repository
+// NewRepo creates a new repository backed by the database the driver connected to
 func NewRepo(a *config.AppConfig, db *driver.DB) *Repository {
-	return &Repository{
-		App: a,
-		DB:  dbrepo.NewPostgresRepo(db.SQL, a),
+	if db.Driver == driver.SQLite {
+		return &Repository{
+			App: a,
+			DB:  dbrepo.NewSQLiteRepo(db.SQL, a),
+		}
 	}
-}
 
-// NewTestRepo creates a new repository
-func NewTestRepo(a *config.AppConfig) *Repository {
 	return &Repository{
 		App: a,
-		DB:  dbrepo.NewTestingsRepo(a),
+		DB:  dbrepo.NewPostgresRepo(db.SQL, a),
 	}
 }
 
@@ -69,7 +79,7 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	room, err := m.DB.GetRoomByID(res.RoomID)
+	room, err := m.DB.GetRoomByID(r.Context(), res.RoomID)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't find room!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -77,6 +87,20 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	res.Room.RoomName = room.RoomName
+	res.Room.MaxOccupancy = room.MaxOccupancy
+
+	quote, err := m.quote(r.Context(), room, res.StartDate, res.EndDate)
+	if errors.Is(err, pricing.ErrInvalidStay) {
+		m.App.Session.Put(r.Context(), "error", "invalid dates!")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get room rates!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	res.TotalPrice = quote.Total
 
 	m.App.Session.Put(r.Context(), "reservation", res)
 
@@ -134,6 +158,25 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// inactive rooms are hidden from guests and cannot be booked
+	room, err := m.DB.GetRoomByID(r.Context(), roomID)
+	if err != nil || !room.Active {
+		m.App.Session.Put(r.Context(), "error", "can't find room!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+
+	form.Required("first_name", "last_name", "email")
+	form.MinLength("first_name", 3)
+	form.IsEmail("email")
+
+	adults, children := guestCounts(form)
+	if form.Valid() && adults+children > room.MaxOccupancy {
+		form.Errors.Add("adults", fmt.Sprintf("This room sleeps up to %d guests", room.MaxOccupancy))
+	}
+
 	reservation := models.Reservation{
 		FirstName: r.Form.Get("first_name"),
 		LastName:  r.Form.Get("last_name"),
@@ -142,53 +185,78 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		StartDate: startDate,
 		EndDate:   endDate,
 		RoomID:    roomID,
+		Adults:    adults,
+		Children:  children,
 	}
 
-	form := forms.New(r.PostForm)
+	if !form.Valid() {
+		reservation.Room.RoomName = room.RoomName
+		reservation.Room.MaxOccupancy = room.MaxOccupancy
 
-	form.Required("first_name", "last_name", "email")
-	form.MinLength("first_name", 3)
-	form.IsEmail("email")
+		stringMap := make(map[string]string)
+		stringMap["start_date"] = sd
+		stringMap["end_date"] = ed
 
-	if !form.Valid() {
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
 		http.Error(w, "my own error message", http.StatusSeeOther)
 		render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
-			Form: form,
-			Data: data,
+			Form:      form,
+			Data:      data,
+			StringMap: stringMap,
 		})
 		return
 	}
 
-	newReservationID, err := m.DB.InsertReservation(reservation)
+	err = m.checkStay(r.Context(), roomID, startDate, endDate)
+	if msg, ok := stayError(err); ok {
+		m.App.Session.Put(r.Context(), "error", msg)
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't insert reservation into database!")
+		m.App.Session.Put(r.Context(), "error", "can't get stay rules!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	restriction := models.RoomRestriction{
-		StartDate:     startDate,
-		EndDate:       endDate,
-		RoomID:        roomID,
-		ReservationID: newReservationID,
-		RestrictionID: 1,
+	// the price comes from the room's rates, never from the posted form
+	quote, err := m.quote(r.Context(), room, startDate, endDate)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get room rates!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
 	}
 
-	err = m.DB.InsertRoomRestriction(restriction)
+	reservation.Room.ID = room.ID
+	reservation.Room.RoomName = room.RoomName
+	reservation.TotalPrice = quote.Total
+
+	reservation.ID, err = m.DB.InsertReservationWithRestriction(r.Context(), reservation)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't insert room restriction!")
+		if errors.Is(err, repository.ErrRoomUnavailable) {
+			// someone booked the room since the guest searched, so send them back to pick other dates
+			m.App.Session.Put(r.Context(), "warning",
+				"Sorry, those dates just got taken. Please search again for other dates or rooms.")
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+		m.App.Session.Put(r.Context(), "error", "can't insert reservation into database!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
+	m.queueWebhooks(r.Context(), webhooks.EventReservationCreated, reservation)
+
 	// send notifications
 	htmlMessage := fmt.Sprintf(`
 	<strong>Reservation Confirmation</strong><br><br>
 	Dear %s, <br>
-	This message confirms your reservation from %s to %s.
-`, reservation.FirstName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
+	This message confirms your reservation in %s from %s to %s for %s.<br>
+	Total for %d nights: %s
+`, reservation.FirstName, room.RoomName, reservation.StartDate.Format("2006-01-02"),
+		reservation.EndDate.Format("2006-01-02"), render.Guests(reservation.Adults, reservation.Children),
+		len(quote.Nights), pricing.Format(quote.Total))
 
 	msg := models.MailData{
 		To:       reservation.Email,
@@ -205,23 +273,36 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// Generals renders the room page
-func (m *Repository) Generals(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "generals.page.tmpl", &models.TemplateData{})
-}
+// SplitReservation renders the make a reservation page for the split stay the guest chose
+func (m *Repository) SplitReservation(w http.ResponseWriter, r *http.Request) {
+	split, ok := m.App.Session.Get(r.Context(), "split").(models.Booking)
+	if !ok || len(split.Reservations) == 0 {
+		m.App.Session.Put(r.Context(), "error", "can't get split stay from session")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["split"] = split
+	data["reservation"] = split.Reservations[0]
 
-// Majors renders the room page
-func (m *Repository) Majors(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "majors.page.tmpl", &models.TemplateData{})
+	render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
+		Form:      forms.New(nil),
+		Data:      data,
+		StringMap: splitDates(split),
+	})
 }
 
-// Availability renders the search availability page
-func (m *Repository) Availability(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{})
+// splitDates returns the arrival and departure of a split stay for the make a reservation page
+func splitDates(split models.Booking) map[string]string {
+	stringMap := make(map[string]string)
+	stringMap["start_date"] = split.Reservations[0].StartDate.Format("2006-01-02")
+	stringMap["end_date"] = split.Reservations[len(split.Reservations)-1].EndDate.Format("2006-01-02")
+	return stringMap
 }
 
-// PostAvailability renders the search availability page
-func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
+// PostSplitReservation books the split stay the guest chose, as one reservation per room linked by a booking
+func (m *Repository) PostSplitReservation(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't parse form!")
@@ -229,584 +310,2871 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	start := r.Form.Get("start")
-	end := r.Form.Get("end")
-
-	layout := "2006-01-02"
-	startDate, err := time.Parse(layout, start)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse start date!")
+	split, ok := m.App.Session.Get(r.Context(), "split").(models.Booking)
+	if !ok || len(split.Reservations) == 0 {
+		m.App.Session.Put(r.Context(), "error", "can't get split stay from session")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	endDate, err := time.Parse(layout, end)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse end date!")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+
+	form := forms.New(r.PostForm)
+
+	form.Required("first_name", "last_name", "email")
+	form.MinLength("first_name", 3)
+	form.IsEmail("email")
+
+	adults, children := guestCounts(form)
+
+	// the rooms, stay rules and prices may have changed since the guest searched
+	total := 0
+	for i, res := range split.Reservations {
+		room, err := m.DB.GetRoomByID(r.Context(), res.RoomID)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "can't find room!")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		if form.Valid() && adults+children > room.MaxOccupancy {
+			form.Errors.Add("adults", fmt.Sprintf("The %s sleeps up to %d guests", room.RoomName, room.MaxOccupancy))
+		}
+
+		err = m.checkStay(r.Context(), res.RoomID, res.StartDate, res.EndDate)
+		if msg, ok := stayError(err); ok {
+			m.App.Session.Put(r.Context(), "error", msg)
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "can't get stay rules!")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		quote, err := m.quote(r.Context(), room, res.StartDate, res.EndDate)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "can't get room rates!")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		res.FirstName = r.Form.Get("first_name")
+		res.LastName = r.Form.Get("last_name")
+		res.Phone = r.Form.Get("phone")
+		res.Email = r.Form.Get("email")
+		res.Adults = adults
+		res.Children = children
+		res.TotalPrice = quote.Total
+		res.Room.RoomName = room.RoomName
+		res.Room.MaxOccupancy = room.MaxOccupancy
+		split.Reservations[i] = res
+		total += quote.Total
+	}
+
+	if !form.Valid() {
+		data := make(map[string]interface{})
+		data["split"] = split
+		data["reservation"] = split.Reservations[0]
+
+		render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
+			Form:      form,
+			Data:      data,
+			StringMap: splitDates(split),
+		})
 		return
 	}
 
-	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	split.ID, err = m.DB.InsertBooking(r.Context(), split.Reservations)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't get availability for rooms")
+		if errors.Is(err, repository.ErrRoomUnavailable) {
+			m.App.Session.Put(r.Context(), "warning",
+				"Sorry, those dates just got taken. Please search again for other dates or rooms.")
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+		m.App.Session.Put(r.Context(), "error", "can't insert reservation into database!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	if len(rooms) == 0 {
-		// no availability
-		m.App.Session.Put(r.Context(), "error", "No availability")
-		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
-		return
+	// the webhooks get each stay with the id it was saved with
+	booking, err := m.DB.GetBookingByID(r.Context(), split.ID)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+	for _, res := range booking.Reservations {
+		m.queueWebhooks(r.Context(), webhooks.EventReservationCreated, res)
 	}
 
-	data := make(map[string]interface{})
-	data["rooms"] = rooms
-
-	res := models.Reservation{
-		StartDate: startDate,
-		EndDate:   endDate,
+	// send notifications
+	var stays strings.Builder
+	for _, res := range split.Reservations {
+		fmt.Fprintf(&stays, "%s from %s to %s<br>", res.Room.RoomName, res.StartDate.Format("2006-01-02"),
+			res.EndDate.Format("2006-01-02"))
 	}
 
-	m.App.Session.Put(r.Context(), "reservation", res)
+	first := split.Reservations[0]
+	htmlMessage := fmt.Sprintf(`
+	<strong>Reservation Confirmation</strong><br><br>
+	Dear %s, <br>
+	This message confirms your split stay for %s:<br>
+	%s
+	Total: %s
+`, first.FirstName, render.Guests(adults, children), stays.String(), pricing.Format(total))
 
-	render.Template(w, r, "choose-room.page.tmpl", &models.TemplateData{
-		Data: data,
-	})
-}
+	msg := models.MailData{
+		To:       first.Email,
+		From:     "me@here.com",
+		Subject:  "Reservation Confirmation",
+		Content:  htmlMessage,
+		Template: "basic.html",
+	}
+	m.App.MailChan <- msg
 
-type jsonResponse struct {
-	OK        bool   `json:"ok"`
-	Message   string `json:"message"`
-	RoomID    string `json:"room_id"`
-	StartDate string `json:"start_date"`
-	EndDate   string `json:"end_date"`
+	m.App.Session.Remove(r.Context(), "reservation")
+	m.App.Session.Put(r.Context(), "split", split)
+
+	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
 }
 
-// AvailabilityJSON handles request for availability and send JSON response
-func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
-	// need to parse request body
-	err := r.ParseForm()
+// quote prices a stay in a room, applying the room's rate overrides for those dates
+func (m *Repository) quote(ctx context.Context, room models.Room, start, end time.Time) (pricing.Quote, error) {
+	rates, err := m.DB.GetRoomRates(ctx, room.ID, start, end)
 	if err != nil {
-		// can't parse form, so return appropriate json
-		resp := jsonResponse{
-			OK:      false,
-			Message: "Internal server error",
-		}
-
-		out, _ := json.MarshalIndent(resp, "", "     ")
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(out)
-		return
+		return pricing.Quote{}, err
 	}
 
-	sd := r.Form.Get("start")
-	ed := r.Form.Get("end")
-
-	layout := "2006-01-02"
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
+	return pricing.Calculate(room, rates, start, end)
+}
 
-	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
+// checkStay returns a *stayrules.Violation when a stay breaks the room's stay rules,
+// stayrules.ErrInvalidStay for a stay without nights, or a database error
+func (m *Repository) checkStay(ctx context.Context, roomID int, start, end time.Time) error {
+	if !end.After(start) {
+		return stayrules.ErrInvalidStay
+	}
 
-	available, err := m.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, roomID)
+	rules, err := m.DB.GetStayRules(ctx, roomID, start, end)
 	if err != nil {
-		// got a database error, so return appropriate json
-		resp := jsonResponse{
-			OK:      false,
-			Message: "Error querying database",
-		}
+		return err
+	}
 
-		out, _ := json.MarshalIndent(resp, "", "     ")
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(out)
-		return
+	return stayrules.Check(rules, start, end)
+}
+
+// stayError returns the message for guests when err is a stay that cannot be booked
+func stayError(err error) (string, bool) {
+	var violation *stayrules.Violation
+	if errors.As(err, &violation) {
+		return fmt.Sprintf("Sorry, that stay is not possible (%s)", violation.Reason), true
 	}
-	resp := jsonResponse{
-		OK:        available,
-		Message:   "",
-		StartDate: sd,
-		EndDate:   ed,
-		RoomID:    strconv.Itoa(roomID),
+	if errors.Is(err, stayrules.ErrInvalidStay) {
+		return "Departure must be after arrival", true
 	}
+	return "", false
+}
 
-	// I removed the error check, since we handle all aspects of
-	// the json right here
-	out, _ := json.MarshalIndent(resp, "", "     ")
+// maxGuests is the most adults or children a guest can search or book for
+const maxGuests = 20
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(out)
+// guestCounts validates and returns the adults and children fields of a form. Forms without them are for one adult.
+func guestCounts(form *forms.Form) (adults, children int) {
+	adults, children = 1, 0
 
+	if strings.TrimSpace(form.Get("adults")) != "" {
+		form.IsNumber("adults", 1, maxGuests)
+		adults, _ = strconv.Atoi(strings.TrimSpace(form.Get("adults")))
+	}
+	if strings.TrimSpace(form.Get("children")) != "" {
+		form.IsNumber("children", 0, maxGuests)
+		children, _ = strconv.Atoi(strings.TrimSpace(form.Get("children")))
+	}
+
+	return adults, children
 }
 
-// Contact renders the search availability page
-func (m *Repository) Contact(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "contact.page.tmpl", &models.TemplateData{})
+// maxStayNights is the longest stay guests can search for or book
+const maxStayNights = 30
+
+// stayDates checks the dates of a search or booking: departure after arrival, arrival no earlier than today and
+// at most maxStayNights nights. It returns "start" or "end" for the date that is wrong and why, or "" when both
+// are fine.
+func stayDates(start, end time.Time) (field, msg string) {
+	switch {
+	case !end.After(start):
+		return "end", "Departure must be after arrival"
+	case start.Before(time.Now().UTC().Truncate(24 * time.Hour)):
+		return "start", "Arrival can't be in the past"
+	case end.After(start.AddDate(0, 0, maxStayNights)):
+		return "end", fmt.Sprintf("Stays can be up to %d nights", maxStayNights)
+	}
+	return "", ""
 }
 
-// ReservationSummary displays the reservation summary page
-func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request) {
-	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
-	if !ok {
-		m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+// Room renders the page of a room by its slug
+func (m *Repository) Room(w http.ResponseWriter, r *http.Request) {
+	room, err := m.DB.GetRoomBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !room.Active) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
 		return
 	}
-
-	m.App.Session.Remove(r.Context(), "reservation")
 
 	data := make(map[string]interface{})
-	data["reservation"] = reservation
-
-	sd := reservation.StartDate.Format("2006-01-02")
-	ed := reservation.EndDate.Format("2006-01-02")
-	stringMap := make(map[string]string)
-	stringMap["start_date"] = sd
-	stringMap["end_date"] = ed
+	data["room"] = room
 
-	render.Template(w, r, "reservation-summary.page.tmpl", &models.TemplateData{
-		Data:      data,
-		StringMap: stringMap,
+	render.Template(w, r, "room.page.tmpl", &models.TemplateData{
+		Data: data,
 	})
 }
 
-// ChooseRoom displays list of available rooms
-func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
-	// used to have next 6 lines
-	//roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
-	//if err != nil {
-	//	log.Println(err)
-	//	m.App.Session.Put(r.Context(), "error", "missing url parameter")
-	//	http.Redirect(w, r, "/", http.StatusSeeOther)
-	//	return
-	//}
+// Availability renders the search availability page
+func (m *Repository) Availability(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{})
+}
 
-	// changed to this, so we can test it more easily
-	// split the URL up by /, and grab the 3rd element
-	exploded := strings.Split(r.RequestURI, "/")
-	roomID, err := strconv.Atoi(exploded[2])
+// PostAvailability renders the search availability page
+func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		m.App.Session.Put(r.Context(), "error", "can't parse form!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
-	if !ok {
-		m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
+	start := r.Form.Get("start")
+	end := r.Form.Get("end")
+
+	layout := "2006-01-02"
+	startDate, err := time.Parse(layout, start)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse start date!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	endDate, err := time.Parse(layout, end)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse end date!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if field, msg := stayDates(startDate, endDate); field != "" {
+		m.App.Session.Put(r.Context(), "error", msg)
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	adults, children := guestCounts(form)
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error",
+			fmt.Sprintf("Search for 1 to %d adults and up to %d children", maxGuests, maxGuests))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	search := models.RoomSearch{Guests: adults + children}
+	for _, value := range r.Form["amenity"] {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "can't parse amenities!")
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+		search.AmenityIDs = append(search.AmenityIDs, id)
+	}
+
+	// no most to pay shows rooms at any price
+	maxPrice := 0
+	if value := strings.TrimSpace(r.Form.Get("max_price")); value != "" {
+		maxPrice, err = pricing.Parse(value)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Enter the most to pay like 300 or 300.50")
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+	}
+
+	filtered := len(search.AmenityIDs) > 0 || maxPrice > 0
+
+	available, err := m.DB.SearchAvailabilityForAllRooms(r.Context(), startDate, endDate, search)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get availability for rooms")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	// keep the rooms whose stay rules allow these dates
+	var rooms []models.Room
+	noRoomsMsg := "No availability"
+	for _, room := range available {
+		err := m.checkStay(r.Context(), room.ID, startDate, endDate)
+		if msg, ok := stayError(err); ok {
+			noRoomsMsg = msg
+			continue
+		}
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "can't get stay rules")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		rooms = append(rooms, room)
+	}
+
+	if len(rooms) == 0 && !filtered {
+		// one query for the nights of every alternative
+		avail, err := m.availabilityFor(r.Context(), startDate.AddDate(0, 0, -alternativeDays),
+			endDate.AddDate(0, 0, alternativeDays), search.Guests)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "can't get availability for rooms")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		alternatives, err := m.alternatives(r.Context(), avail, startDate, endDate)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "can't get availability for rooms")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		split, err := m.splitStay(r.Context(), avail, startDate, endDate, adults, children)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "can't get availability for rooms")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		// no availability
+		if len(alternatives) == 0 && len(split.Reservations) == 0 {
+			m.App.Session.Put(r.Context(), "error", noRoomsMsg)
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+
+		data := make(map[string]interface{})
+		data["alternatives"] = alternatives
+
+		if len(split.Reservations) > 0 {
+			total := 0
+			for _, res := range split.Reservations {
+				total += res.TotalPrice
+			}
+			m.App.Session.Put(r.Context(), "split", split)
+			data["split"] = split
+			data["split_total"] = total
+		} else {
+			m.App.Session.Remove(r.Context(), "split")
+		}
+
+		stringMap := make(map[string]string)
+		stringMap["no_rooms"] = noRoomsMsg
+		stringMap["adults"] = strconv.Itoa(adults)
+		stringMap["children"] = strconv.Itoa(children)
+
+		render.Template(w, r, "search-availability.page.tmpl", &models.TemplateData{
+			Data:      data,
+			StringMap: stringMap,
+		})
+		return
+	}
+
+	// price of the stay by room id, keeping the rooms within the most to pay
+	prices := make(map[int]int)
+	var affordable []models.Room
+	for _, room := range rooms {
+		quote, err := m.quote(r.Context(), room, startDate, endDate)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "can't get room rates")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		prices[room.ID] = quote.Total
+		if maxPrice == 0 || quote.Total <= maxPrice {
+			affordable = append(affordable, room)
+		}
+	}
+	rooms = affordable
+
+	sortResults(rooms, prices, r.Form.Get("sort"))
+
+	amenities, err := m.DB.AllAmenities(r.Context())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't get amenities")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	selected := make(map[int]bool)
+	for _, id := range search.AmenityIDs {
+		selected[id] = true
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+	data["prices"] = prices
+	data["amenities"] = amenities
+	data["selected"] = selected
+
+	stringMap := make(map[string]string)
+	stringMap["guests"] = render.Guests(adults, children)
+	stringMap["start"] = start
+	stringMap["end"] = end
+	stringMap["adults"] = strconv.Itoa(adults)
+	stringMap["children"] = strconv.Itoa(children)
+	stringMap["sort"] = r.Form.Get("sort")
+	if maxPrice > 0 {
+		stringMap["max_price"] = pricing.Format(maxPrice)
+	}
+	if len(rooms) == 0 {
+		stringMap["no_rooms"] = "No rooms match these filters"
+	}
+
+	res := models.Reservation{
+		StartDate: startDate,
+		EndDate:   endDate,
+		Adults:    adults,
+		Children:  children,
+	}
+
+	m.App.Session.Put(r.Context(), "reservation", res)
+
+	render.Template(w, r, "choose-room.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// alternativeDays is how many days earlier or later than the searched dates alternatives may start
+const alternativeDays = 3
+
+// maxShorterBy is how many nights shorter than the searched stay alternatives may be
+const maxShorterBy = 3
+
+// maxAlternatives is the most alternatives offered for a search
+const maxAlternatives = 6
+
+// availability is which units of the rooms that sleep a party are taken on each night of a date range. It comes
+// from one restrictions query, so the stays tried for alternatives do not need a query each.
+type availability struct {
+	rooms []models.Room                   // active rooms that sleep the party, in display order
+	taken map[int]map[string]map[int]bool // units taken by room id and night
+}
+
+// availabilityFor returns the availability from start to end of the active rooms that sleep guests
+func (m *Repository) availabilityFor(ctx context.Context, start, end time.Time, guests int) (availability, error) {
+	avail := availability{taken: make(map[int]map[string]map[int]bool)}
+
+	rooms, err := m.DB.AllRooms(ctx)
+	if err != nil {
+		return avail, err
+	}
+	for _, room := range rooms {
+		if room.Active && room.MaxOccupancy >= guests {
+			avail.rooms = append(avail.rooms, room)
+		}
+	}
+
+	restrictions, err := m.DB.GetRestrictionsForAllRooms(ctx, start, end)
+	if err != nil {
+		return avail, err
+	}
+
+	for _, x := range restrictions {
+		if avail.taken[x.RoomID] == nil {
+			avail.taken[x.RoomID] = make(map[string]map[int]bool)
+		}
+
+		// only the nights within the range matter
+		first, last := x.StartDate, x.EndDate
+		if first.Before(start) {
+			first = start
+		}
+		if last.After(end) {
+			last = end
+		}
+
+		for d := first; d.Before(last); d = d.AddDate(0, 0, 1) {
+			night := d.Format("2006-01-02")
+			if avail.taken[x.RoomID][night] == nil {
+				avail.taken[x.RoomID][night] = make(map[int]bool)
+			}
+			avail.taken[x.RoomID][night][x.UnitID] = true
+		}
+	}
+
+	return avail, nil
+}
+
+// freeRooms returns the rooms, in display order, with a unit free on every night from start to end
+func (a availability) freeRooms(start, end time.Time) []models.Room {
+	var free []models.Room
+	for _, room := range a.rooms {
+		// units taken on any of the nights, the other units are free for the whole stay
+		taken := make(map[int]bool)
+		for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+			for unitID := range a.taken[room.ID][d.Format("2006-01-02")] {
+				taken[unitID] = true
+			}
+		}
+
+		if len(taken) < room.Units {
+			free = append(free, room)
+		}
+	}
+
+	return free
+}
+
+// alternatives returns bookable stays close to a search that had no rooms: the same length of stay shifted by up
+// to alternativeDays days, nearest first and never starting in the past, then stays up to maxShorterBy nights
+// shorter within the searched dates, longest first. avail must cover alternativeDays around the searched dates.
+func (m *Repository) alternatives(ctx context.Context, avail availability, start, end time.Time) ([]models.Alternative, error) {
+	type window struct {
+		start, end time.Time
+	}
+
+	var windows []window
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	for d := 1; d <= alternativeDays; d++ {
+		if earlier := start.AddDate(0, 0, -d); !earlier.Before(today) {
+			windows = append(windows, window{earlier, end.AddDate(0, 0, -d)})
+		}
+		windows = append(windows, window{start.AddDate(0, 0, d), end.AddDate(0, 0, d)})
+	}
+
+	nights := int(end.Sub(start).Hours() / 24)
+	for n := nights - 1; n >= 1 && n >= nights-maxShorterBy; n-- {
+		for offset := 0; offset+n <= nights; offset++ {
+			windows = append(windows, window{start.AddDate(0, 0, offset), start.AddDate(0, 0, offset+n)})
+		}
+	}
+
+	var alternatives []models.Alternative
+	for _, w := range windows {
+		for _, room := range avail.freeRooms(w.start, w.end) {
+			err := m.checkStay(ctx, room.ID, w.start, w.end)
+			if _, ok := stayError(err); ok {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			quote, err := m.quote(ctx, room, w.start, w.end)
+			if err != nil {
+				return nil, err
+			}
+
+			alternatives = append(alternatives, models.Alternative{
+				Room:       room,
+				StartDate:  w.start,
+				EndDate:    w.end,
+				TotalPrice: quote.Total,
+			})
+			if len(alternatives) == maxAlternatives {
+				return alternatives, nil
+			}
+		}
+	}
+
+	return alternatives, nil
+}
+
+// maxSplitLegs is the most rooms a split stay moves the guest between
+const maxSplitLegs = 3
+
+// splitStay returns a booking that covers a stay no single room is free for with consecutive stays in several
+// rooms, moving the guest as few times as possible. The booking has no reservations when there is no such split,
+// or when its stays break a room's stay rules. avail must cover the searched nights.
+func (m *Repository) splitStay(ctx context.Context, avail availability, start, end time.Time, adults, children int) (models.Booking, error) {
+	var booking models.Booking
+
+	// the rooms free on each night, in display order
+	rooms := make(map[int]models.Room)
+	var free [][]int
+	for night := start; night.Before(end); night = night.AddDate(0, 0, 1) {
+		var ids []int
+		for _, room := range avail.freeRooms(night, night.AddDate(0, 0, 1)) {
+			rooms[room.ID] = room
+			ids = append(ids, room.ID)
+		}
+		free = append(free, ids)
+	}
+
+	for _, leg := range splitstay.Plan(free, maxSplitLegs) {
+		res := models.Reservation{
+			RoomID:    leg.RoomID,
+			StartDate: start.AddDate(0, 0, leg.First),
+			EndDate:   start.AddDate(0, 0, leg.Last),
+			Adults:    adults,
+			Children:  children,
+		}
+
+		err := m.checkStay(ctx, res.RoomID, res.StartDate, res.EndDate)
+		if _, ok := stayError(err); ok {
+			return models.Booking{}, nil
+		}
+		if err != nil {
+			return booking, err
+		}
+
+		quote, err := m.quote(ctx, rooms[leg.RoomID], res.StartDate, res.EndDate)
+		if err != nil {
+			return booking, err
+		}
+
+		res.TotalPrice = quote.Total
+		res.Room.ID = leg.RoomID
+		res.Room.RoomName = rooms[leg.RoomID].RoomName
+		res.Room.MaxOccupancy = rooms[leg.RoomID].MaxOccupancy
+		booking.Reservations = append(booking.Reservations, res)
+	}
+
+	return booking, nil
+}
+
+// sortResults sorts the rooms of an availability search by the stay price, low or high first, or by the most guests
+// they sleep. Any other sort keeps the display order.
+func sortResults(rooms []models.Room, prices map[int]int, by string) {
+	sort.SliceStable(rooms, func(i, j int) bool {
+		switch by {
+		case "price":
+			return prices[rooms[i].ID] < prices[rooms[j].ID]
+		case "price_desc":
+			return prices[rooms[i].ID] > prices[rooms[j].ID]
+		case "capacity":
+			return rooms[i].MaxOccupancy > rooms[j].MaxOccupancy
+		}
+		return false
+	})
+}
+
+type jsonResponse struct {
+	OK         bool   `json:"ok"`
+	Message    string `json:"message"`
+	RoomID     string `json:"room_id"`
+	StartDate  string `json:"start_date"`
+	EndDate    string `json:"end_date"`
+	TotalPrice int    `json:"total_price,omitempty"` // in cents
+	Price      string `json:"price,omitempty"`
+}
+
+// AvailabilityJSON handles request for availability and send JSON response
+func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
+	// need to parse request body
+	err := r.ParseForm()
+	if err != nil {
+		// can't parse form, so return appropriate json
+		resp := jsonResponse{
+			OK:      false,
+			Message: "Internal server error",
+		}
+
+		out, _ := json.MarshalIndent(resp, "", "     ")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
+
+	sd := r.Form.Get("start")
+	ed := r.Form.Get("end")
+
+	layout := "2006-01-02"
+	startDate, _ := time.Parse(layout, sd)
+	endDate, _ := time.Parse(layout, ed)
+
+	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
+
+	available, err := m.DB.SearchAvailabilityByDatesByRoomID(r.Context(), startDate, endDate, roomID)
+	if err != nil {
+		// got a database error, so return appropriate json
+		resp := jsonResponse{
+			OK:      false,
+			Message: "Error querying database",
+		}
+
+		out, _ := json.MarshalIndent(resp, "", "     ")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
+	resp := jsonResponse{
+		OK:        available,
+		Message:   "",
+		StartDate: sd,
+		EndDate:   ed,
+		RoomID:    strconv.Itoa(roomID),
+	}
+
+	if available {
+		var quote pricing.Quote
+		room, err := m.DB.GetRoomByID(r.Context(), roomID)
+		if err == nil {
+			err = m.checkStay(r.Context(), roomID, startDate, endDate)
+		}
+		if err == nil {
+			quote, err = m.quote(r.Context(), room, startDate, endDate)
+		}
+
+		if msg, ok := stayError(err); ok {
+			resp.OK = false
+			resp.Message = msg
+		} else if err != nil {
+			resp.OK = false
+			resp.Message = "Error querying database"
+		} else {
+			resp.TotalPrice = quote.Total
+			resp.Price = pricing.Format(quote.Total)
+		}
+	}
+
+	// I removed the error check, since we handle all aspects of
+	// the json right here
+	out, _ := json.MarshalIndent(resp, "", "     ")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+
+}
+
+// gridDay is the availability of a room, or of any room, on one night
+type gridDay struct {
+	Date      string `json:"date"`
+	FreeUnits int    `json:"free_units"`
+	Available bool   `json:"available"`
+}
+
+// gridRoom is the availability of a room on each night of a month
+type gridRoom struct {
+	RoomID      int       `json:"room_id"`
+	RoomName    string    `json:"room_name"`
+	Units       int       `json:"units"`
+	Days        []gridDay `json:"days"`
+	Unavailable []string  `json:"unavailable"`
+}
+
+type gridResponse struct {
+	OK          bool       `json:"ok"`
+	Message     string     `json:"message,omitempty"`
+	Month       string     `json:"month,omitempty"`
+	StartDate   string     `json:"start_date,omitempty"`
+	EndDate     string     `json:"end_date,omitempty"`
+	Rooms       []gridRoom `json:"rooms"`
+	Unavailable []string   `json:"unavailable"` // the nights no room in the grid is free
+}
+
+// AvailabilityGridJSON sends the availability of a room, or of all rooms, on each night of a month, so date pickers
+// can grey out the nights that are taken. The month is given as yyyy-mm and defaults to the current one.
+func (m *Repository) AvailabilityGridJSON(w http.ResponseWriter, r *http.Request) {
+	writeGrid := func(resp gridResponse) {
+		out, _ := json.MarshalIndent(resp, "", "     ")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+	}
+
+	now := time.Now()
+	firstOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if month := r.URL.Query().Get("month"); month != "" {
+		parsed, err := time.Parse("2006-01", month)
+		if err != nil {
+			writeGrid(gridResponse{Message: "Month must be given as yyyy-mm"})
+			return
+		}
+		firstOfMonth = parsed
+	}
+	nextMonth := firstOfMonth.AddDate(0, 1, 0)
+
+	roomID := 0
+	if id := r.URL.Query().Get("room_id"); id != "" {
+		var err error
+		roomID, err = strconv.Atoi(id)
+		if err != nil || roomID < 1 {
+			writeGrid(gridResponse{Message: "Invalid room"})
+			return
+		}
+	}
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		writeGrid(gridResponse{Message: "Error querying database"})
+		return
+	}
+
+	// one query for the whole month, each restriction takes its unit off the free count for its nights
+	restrictions, err := m.DB.GetRestrictionsForAllRooms(r.Context(), firstOfMonth, nextMonth)
+	if err != nil {
+		writeGrid(gridResponse{Message: "Error querying database"})
+		return
+	}
+
+	taken := make(map[int]map[string]map[int]bool)
+	for _, x := range restrictions {
+		if taken[x.RoomID] == nil {
+			taken[x.RoomID] = make(map[string]map[int]bool)
+		}
+		for d := x.StartDate; d.Before(x.EndDate); d = d.AddDate(0, 0, 1) {
+			night := d.Format("2006-01-02")
+			if taken[x.RoomID][night] == nil {
+				taken[x.RoomID][night] = make(map[int]bool)
+			}
+			taken[x.RoomID][night][x.UnitID] = true
+		}
+	}
+
+	resp := gridResponse{
+		OK:          true,
+		Month:       firstOfMonth.Format("2006-01"),
+		StartDate:   firstOfMonth.Format("2006-01-02"),
+		EndDate:     nextMonth.Format("2006-01-02"),
+		Rooms:       []gridRoom{},
+		Unavailable: []string{},
+	}
+
+	free := make(map[string]int)
+	for _, room := range rooms {
+		if !room.Active || (roomID > 0 && room.ID != roomID) {
+			continue
+		}
+
+		grid := gridRoom{
+			RoomID:      room.ID,
+			RoomName:    room.RoomName,
+			Units:       room.Units,
+			Unavailable: []string{},
+		}
+		for d := firstOfMonth; d.Before(nextMonth); d = d.AddDate(0, 0, 1) {
+			night := d.Format("2006-01-02")
+			day := gridDay{Date: night, FreeUnits: room.Units - len(taken[room.ID][night])}
+			day.Available = day.FreeUnits > 0
+			if !day.Available {
+				grid.Unavailable = append(grid.Unavailable, night)
+			}
+			free[night] += day.FreeUnits
+			grid.Days = append(grid.Days, day)
+		}
+		resp.Rooms = append(resp.Rooms, grid)
+	}
+
+	if roomID > 0 && len(resp.Rooms) == 0 {
+		writeGrid(gridResponse{Message: "Invalid room"})
+		return
+	}
+
+	for d := firstOfMonth; d.Before(nextMonth); d = d.AddDate(0, 0, 1) {
+		if night := d.Format("2006-01-02"); free[night] == 0 {
+			resp.Unavailable = append(resp.Unavailable, night)
+		}
+	}
+
+	writeGrid(resp)
+}
+
+// Contact renders the contact page
+func (m *Repository) Contact(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "contact.page.tmpl", &models.TemplateData{})
+}
+
+// ReservationSummary displays the reservation summary page
+func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+
+	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok {
+		// a split stay is summed up with its first reservation and the stays in each room
+		split, isSplit := m.App.Session.Get(r.Context(), "split").(models.Booking)
+		if !isSplit || split.ID == 0 {
+			m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		reservation = split.Reservations[0]
+		reservation.EndDate = split.Reservations[len(split.Reservations)-1].EndDate
+		reservation.TotalPrice = 0
+		for _, res := range split.Reservations {
+			reservation.TotalPrice += res.TotalPrice
+		}
+		data["split"] = split
+	}
+
+	m.App.Session.Remove(r.Context(), "reservation")
+	m.App.Session.Remove(r.Context(), "split")
+
+	data["reservation"] = reservation
+
+	sd := reservation.StartDate.Format("2006-01-02")
+	ed := reservation.EndDate.Format("2006-01-02")
+	stringMap := make(map[string]string)
+	stringMap["start_date"] = sd
+	stringMap["end_date"] = ed
+
+	render.Template(w, r, "reservation-summary.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// ChooseRoom displays list of available rooms
+func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
+	// used to have next 6 lines
+	//roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	//if err != nil {
+	//	log.Println(err)
+	//	m.App.Session.Put(r.Context(), "error", "missing url parameter")
+	//	http.Redirect(w, r, "/", http.StatusSeeOther)
+	//	return
+	//}
+
+	// changed to this, so we can test it more easily
+	// split the URL up by /, and grab the 3rd element
+	exploded := strings.Split(r.RequestURI, "/")
+	roomID, err := strconv.Atoi(exploded[2])
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
 	res.RoomID = roomID
 
-	m.App.Session.Put(r.Context(), "reservation", res)
+	m.App.Session.Put(r.Context(), "reservation", res)
+
+	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+
+}
+
+// BookRoom takes URL parameters, builds a sessional variable, and takes user to make res screen
+func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
+	roomID, _ := strconv.Atoi(r.URL.Query().Get("id"))
+	sd := r.URL.Query().Get("s")
+	ed := r.URL.Query().Get("e")
+
+	layout := "2006-01-02"
+	startDate, err := time.Parse(layout, sd)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse start date")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	endDate, err := time.Parse(layout, ed)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse end date")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	var res models.Reservation
+
+	room, err := m.DB.GetRoomByID(r.Context(), roomID)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't get room from db!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	// inactive rooms are hidden from guests and cannot be booked
+	if !room.Active {
+		m.App.Session.Put(r.Context(), "error", "can't find room!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	err = m.checkStay(r.Context(), roomID, startDate, endDate)
+	if msg, ok := stayError(err); ok {
+		m.App.Session.Put(r.Context(), "error", msg)
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't get stay rules from db!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	res.Room.RoomName = room.RoomName
+	res.RoomID = roomID
+	res.StartDate = startDate
+	res.EndDate = endDate
+
+	// alternatives to a search keep its party, links from a room page are for one adult
+	res.Adults, err = strconv.Atoi(r.URL.Query().Get("a"))
+	if err != nil || res.Adults < 1 {
+		res.Adults = 1
+	}
+	res.Children, err = strconv.Atoi(r.URL.Query().Get("c"))
+	if err != nil || res.Children < 0 {
+		res.Children = 0
+	}
+
+	m.App.Session.Put(r.Context(), "reservation", res)
+
+	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+}
+
+func (m *Repository) ShowLogin(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "login.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+	})
+}
+
+// PostShowLogin handles loggin the user in
+func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
+	log.Println("Here")
+
+	// prevents session fixation atack
+	_ = m.App.Session.RenewToken(r.Context())
+
+	err := r.ParseForm()
+	if err != nil {
+		log.Println(err)
+	}
+
+	email := r.Form.Get("email")
+	password := r.Form.Get("password")
+
+	form := forms.New(r.PostForm)
+	form.Required("email", "password")
+	form.IsEmail("email")
+	if !form.Valid() {
+		log.Println("Form not valid")
+		render.Template(w, r, "login.page.tmpl", &models.TemplateData{
+			Form: form,
+		})
+		return
+	}
+
+	id, _, err := m.DB.Authenticate(r.Context(), email, password)
+	if err != nil {
+		log.Println(err)
+		m.App.Session.Put(r.Context(), "error", "Invalid login credentials")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	// the session keeps the version it logged in with, so bumping the user's version ends it
+	user, err := m.DB.GetUserByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "user_id", id)
+	m.App.Session.Put(r.Context(), "session_version", user.SessionVersion)
+	m.App.Session.Put(r.Context(), "flash", "Logged in successfully!")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Logout logs a user out
+func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
+	_ = m.App.Session.Destroy(r.Context())
+	// renew session token
+	_ = m.App.Session.RenewToken(r.Context())
+
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// minPasswordLength is the shortest password a user can set
+const minPasswordLength = 8
+
+// ShowSetPassword shows the form to set a password with the token of an invitation or a password reset
+func (m *Repository) ShowSetPassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.passwordTokenUser(w, r)
+	if !ok {
+		return
+	}
+
+	m.renderSetPassword(w, r, user, forms.New(nil))
+}
+
+// PostSetPassword sets the password of the user with the token, which can then not be used again
+func (m *Repository) PostSetPassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := m.passwordTokenUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("password", "password_confirm")
+	if form.Get("password") != "" {
+		form.MinLength("password", minPasswordLength)
+	}
+	if form.Get("password_confirm") != "" && form.Get("password_confirm") != form.Get("password") {
+		form.Errors.Add("password_confirm", "The passwords do not match")
+	}
+
+	if !form.Valid() {
+		m.renderSetPassword(w, r, user, form)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(form.Get("password")), bcrypt.DefaultCost)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.UpdatePassword(r.Context(), user.ID, string(hashedPassword))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	_ = m.App.Session.RenewToken(r.Context())
+	m.App.Session.Put(r.Context(), "flash", "Your password is set, you can log in now")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+// passwordTokenUser returns the active user with the password token of the url. When there is none, or the
+// token expired, it sends the visitor to the login page and returns false.
+func (m *Repository) passwordTokenUser(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	hash := access.HashPasswordToken(chi.URLParam(r, "token"))
+
+	user, err := m.DB.GetUserByPasswordToken(r.Context(), hash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		helpers.ServerError(w, err)
+		return user, false
+	}
+
+	if err != nil || !user.Active || time.Now().After(user.PasswordTokenExpiresAt) {
+		m.App.Session.Put(r.Context(), "error", "This link has expired or was already used, ask an owner for a new one.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return user, false
+	}
+
+	return user, true
+}
+
+// renderSetPassword renders the set password form for the user
+func (m *Repository) renderSetPassword(w http.ResponseWriter, r *http.Request, user models.User, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["user"] = user
+
+	stringMap := make(map[string]string)
+	stringMap["token"] = chi.URLParam(r, "token")
+
+	intMap := make(map[string]int)
+	intMap["min_password_length"] = minPasswordLength
+
+	render.Template(w, r, "set-password.page.tmpl", &models.TemplateData{
+		Data:      data,
+		Form:      form,
+		StringMap: stringMap,
+		IntMap:    intMap,
+	})
+}
+
+// AdminDashboard
+func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "admin-dashboard.page.tmpl", &models.TemplateData{})
+}
+
+// AdminNewReservations shows all new reservations in admin tool
+func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
+	reservations, err := m.DB.AllNewReservations(r.Context())
+
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservations"] = reservations
+
+	render.Template(w, r, "admin-new-reservations.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminAllReservations shows all reservations in admin tool
+func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
+	log.Println("Show All")
+	reservations, err := m.DB.AllReservations(r.Context())
+
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservations"] = reservations
+
+	render.Template(w, r, "admin-all-reservations.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowReservation shows the reservation in the admin tool
+func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
+
+	// grab the url
+	exploded := strings.Split(r.RequestURI, "/")
+	id, err := strconv.Atoi(exploded[4])
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	src := exploded[3]
+
+	stringMap := make(map[string]string)
+	stringMap["src"] = src
+
+	year := r.URL.Query().Get("y")
+	month := r.URL.Query().Get("m")
+
+	stringMap["month"] = month
+	stringMap["year"] = year
+
+	// get reservation from database
+	res, err := m.DB.GetReservationById(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+
+	// the other stays of a split stay
+	if res.BookingID > 0 {
+		booking, err := m.DB.GetBookingByID(r.Context(), res.BookingID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		data["booking"] = booking
+	}
+
+	render.Template(w, r, "admin-reservations-show.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      forms.New(nil),
+	})
+}
+
+// AdminShowReservation shows the reservation in the admin tool
+func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// grab the url
+	exploded := strings.Split(r.RequestURI, "/")
+	id, err := strconv.Atoi(exploded[4])
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	src := exploded[3]
+
+	stringMap := make(map[string]string)
+	stringMap["src"] = src
+
+	reservation, err := m.DB.GetReservationById(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	reservation.FirstName = r.Form.Get("first_name")
+	reservation.LastName = r.Form.Get("last_name")
+	reservation.Email = r.Form.Get("email")
+	reservation.Phone = r.Form.Get("phone")
+
+	err = m.DB.UpdateReservation(r.Context(), reservation)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.queueWebhooks(r.Context(), webhooks.EventReservationUpdated, reservation)
+
+	month := r.Form.Get("month")
+	year := r.Form.Get("year")
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved!")
+
+	if year == "" {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	}
+
+}
+
+// AdminCalendarReservations displays the reservation calendar
+func (m *Repository) AdminCalendarReservations(w http.ResponseWriter, r *http.Request) {
+	// assume that there is no month or year specified
+	now := time.Now()
+
+	if r.URL.Query().Get("y") != "" {
+		year, _ := strconv.Atoi(r.URL.Query().Get("y"))
+		month, _ := strconv.Atoi(r.URL.Query().Get("m"))
+		now = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	m.renderCalendar(w, r, now, forms.New(nil))
+}
+
+// renderCalendar shows the reservation calendar for the month of now, with the block range form. The
+// calendar shows the free units of each room type, or the reservations and blocks of every unit with
+// ?view=units.
+func (m *Repository) renderCalendar(w http.ResponseWriter, r *http.Request, now time.Time, form *forms.Form) {
+	data := make(map[string]interface{})
+	data["now"] = now
+
+	next := now.AddDate(0, 1, 0)
+	last := now.AddDate(0, -1, 0)
+
+	nextMonth := next.Format("01")
+	nextMonthYear := next.Format("2006")
+
+	lastMonth := last.Format("01")
+	lastMonthYear := last.Format("2006")
+
+	stringMap := make(map[string]string)
+	stringMap["next_month"] = nextMonth
+	stringMap["next_month_year"] = nextMonthYear
+	stringMap["last_month"] = lastMonth
+	stringMap["last_month_year"] = lastMonthYear
+
+	stringMap["this_month"] = now.Format("01")
+	stringMap["this_month_year"] = now.Format("2006")
+
+	stringMap["view"] = "types"
+	if r.URL.Query().Get("view") == "units" {
+		stringMap["view"] = "units"
+	}
+
+	// get the first and last days of the month
+	currentYear, currentMonth, _ := now.Date()
+	currentLocation := now.Location()
+	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
+	// add one month and take one day off
+	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+
+	intMap := make(map[string]int)
+	intMap["days_in_month"] = lastOfMonth.Day()
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data["rooms"] = rooms
+
+	restrictions, err := m.DB.AllRestrictions(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// reservations are made by guests, every other type can be used to block a room
+	var blockTypes []models.Restriction
+	for _, x := range restrictions {
+		if !x.ForReservations {
+			blockTypes = append(blockTypes, x)
+		}
+	}
+	data["block_types"] = blockTypes
+
+	for _, x := range rooms {
+		units, err := m.DB.AllRoomUnits(r.Context(), x.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		// create maps, the free units of the room on each night and the reservations and blocks of each unit
+		freeMap := make(map[string]int)
+		reservationMaps := make(map[int]map[string]int)
+		blockMaps := make(map[int]map[string]int)
+		blockInfos := make(map[int]map[string]models.RoomRestriction)
+		var blocks []models.RoomRestriction
+
+		for d := firstOfMonth; d.After(lastOfMonth) == false; d = d.AddDate(0, 0, 1) {
+			freeMap[d.Format("2006-01-2")] = len(units)
+		}
+
+		for _, u := range units {
+			reservationMaps[u.ID] = make(map[string]int)
+			blockMaps[u.ID] = make(map[string]int)
+			blockInfos[u.ID] = make(map[string]models.RoomRestriction)
+
+			for d := firstOfMonth; d.After(lastOfMonth) == false; d = d.AddDate(0, 0, 1) {
+				reservationMaps[u.ID][d.Format("2006-01-2")] = 0
+				blockMaps[u.ID][d.Format("2006-01-2")] = 0
+			}
+		}
+
+		// get all the restrictions for the current room
+		restrictions, err := m.DB.GetRestrictions(r.Context(), x.ID, firstOfMonth, lastOfMonth)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		occupied := 0
+		for _, y := range restrictions {
+			// a unit has at most one restriction a night, so each one takes a unit off the free count whatever its
+			// type, and only the types that count toward occupancy add to the occupancy figure
+			for d := y.StartDate; d.Before(y.EndDate); d = d.AddDate(0, 0, 1) {
+				if d.Before(firstOfMonth) || d.After(lastOfMonth) {
+					continue
+				}
+				freeMap[d.Format("2006-01-2")]--
+				if y.Restriction.CountsTowardOccupancy {
+					occupied++
+				}
+			}
+
+			if y.Restriction.ForReservations {
+				// it's a reservation
+				for d := y.StartDate; d.After(y.EndDate) == false; d = d.AddDate(0, 0, 1) {
+					reservationMaps[y.UnitID][d.Format("2006-01-2")] = y.ReservationID
+				}
+			} else {
+				// it's a block, mark every night of it that is shown this month
+				for d := y.StartDate; d.Before(y.EndDate); d = d.AddDate(0, 0, 1) {
+					if d.Before(firstOfMonth) || d.After(lastOfMonth) {
+						continue
+					}
+					blockMaps[y.UnitID][d.Format("2006-01-2")] = y.ID
+					blockInfos[y.UnitID][d.Format("2006-01-2")] = y
+				}
+				blocks = append(blocks, y)
+			}
+		}
+
+		data[fmt.Sprintf("units_%d", x.ID)] = units
+		data[fmt.Sprintf("free_map_%d", x.ID)] = freeMap
+		data[fmt.Sprintf("blocks_%d", x.ID)] = blocks
+		data[fmt.Sprintf("occupied_%d", x.ID)] = occupied
+		data[fmt.Sprintf("capacity_%d", x.ID)] = len(units) * lastOfMonth.Day()
+
+		for _, u := range units {
+			data[fmt.Sprintf("reservation_map_%d", u.ID)] = reservationMaps[u.ID]
+			data[fmt.Sprintf("block_map_%d", u.ID)] = blockMaps[u.ID]
+			data[fmt.Sprintf("block_info_%d", u.ID)] = blockInfos[u.ID]
+
+			//store the blockMap for this unit in the session
+			m.App.Session.Put(r.Context(), fmt.Sprintf("block_map_%d", u.ID), blockMaps[u.ID])
+		}
+	}
+
+	render.Template(w, r, "admin-calendar-reservations.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		IntMap:    intMap,
+		Form:      form,
+	})
+}
+
+// AdminProcessReservation marks a reservation aas processed
+func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	src := chi.URLParam(r, "src")
+	err := m.DB.UpdateProcessedForReservation(r.Context(), id, 1)
+	if err == nil {
+		var reservation models.Reservation
+		reservation, err = m.DB.GetReservationById(r.Context(), id)
+		if err == nil {
+			m.queueWebhooks(r.Context(), webhooks.EventReservationProcessed, reservation)
+		}
+	}
+	if err != nil {
+		log.Println(err)
+	}
+
+	year := r.URL.Query().Get("y")
+	month := r.URL.Query().Get("m")
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation marked as processed")
+
+	if year == "" {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	}
+}
+
+// AdminProcessReservation deletes a reservation
+func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	src := chi.URLParam(r, "src")
+	// the webhooks get the reservation as it was before it was deleted
+	reservation, err := m.DB.GetReservationById(r.Context(), id)
+	if err == nil {
+		err = m.DB.DeleteReservation(r.Context(), id)
+		if err == nil {
+			m.queueWebhooks(r.Context(), webhooks.EventReservationDeleted, reservation)
+		}
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Println(err)
+	}
+
+	year := r.URL.Query().Get("y")
+	month := r.URL.Query().Get("m")
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
+
+	if year == "" {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	}
+
+}
+
+// AdminPostCalendarReservations handles post of reservation calendar
+func (m *Repository) AdminPostCalendarReservations(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	year, _ := strconv.Atoi(r.Form.Get("y"))
+	month, _ := strconv.Atoi(r.Form.Get("m"))
+
+	// process blocks
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var units []models.RoomUnit
+	for _, x := range rooms {
+		roomUnits, err := m.DB.AllRoomUnits(r.Context(), x.ID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		units = append(units, roomUnits...)
+	}
+
+	form := forms.New(r.PostForm)
+	for _, x := range units {
+		// Get the block map from the session. Loop through entire map, if we have an entry in the map that
+		// does not exist in our posted data, and if the restriction id > 0, then it is a block we need to remove.
+		currentMap, ok := m.App.Session.Get(r.Context(), fmt.Sprintf("block_map_%d", x.ID)).(map[string]int)
+		if !ok {
+			// the unit was added after the calendar was shown
+			continue
+		}
+		for name, value := range currentMap {
+			// ok will be false if the value is not in the map
+			if val, ok := currentMap[name]; ok {
+				// only pay atention to values > 0, and that are not in the form post
+				// the rest are just placeholders for days without blocks
+				if val > 0 {
+					if !form.Has(fmt.Sprintf("remove_block_%d_%s", x.ID, name)) {
+						// delete the restriction by id
+						log.Println("Deleted")
+						err := m.DB.DeleteBlockByID(r.Context(), value)
+						if err != nil {
+							log.Println(err)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// now handle new blocks
+	for name, _ := range r.PostForm {
+		if strings.HasPrefix(name, "add_block") {
+			exploded := strings.Split(name, "_")
+			unitID, _ := strconv.Atoi(exploded[2])
+			t, _ := time.Parse("2006-01-2", exploded[3])
+			// insert a new block
+			err := m.DB.InsertBlockForUnit(r.Context(), unitID, t)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%d&m=%d&view=units", year, month), http.StatusSeeOther)
+}
+
+// AdminPostBlockRoom blocks a room for a range of dates from the reservation calendar
+func (m *Repository) AdminPostBlockRoom(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	year, _ := strconv.Atoi(r.Form.Get("y"))
+	month, _ := strconv.Atoi(r.Form.Get("m"))
+	now := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+
+	block := models.RoomRestriction{
+		Reason: strings.TrimSpace(r.Form.Get("reason")),
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_id", "restriction_id", "start_date", "end_date")
+
+	block.RoomID, _ = strconv.Atoi(r.Form.Get("room_id"))
+	if _, err := m.DB.GetRoomByID(r.Context(), block.RoomID); err != nil {
+		form.Errors.Add("room_id", "Choose a room")
+	}
+
+	// no unit blocks whichever unit of the room is free
+	block.UnitID, _ = strconv.Atoi(r.Form.Get("unit_id"))
+	if block.UnitID > 0 {
+		units, err := m.DB.AllRoomUnits(r.Context(), block.RoomID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		found := false
+		for _, u := range units {
+			found = found || u.ID == block.UnitID
+		}
+		if !found {
+			form.Errors.Add("unit_id", "Choose a unit of this room")
+		}
+	}
+
+	block.RestrictionID, _ = strconv.Atoi(r.Form.Get("restriction_id"))
+	restriction, err := m.DB.GetRestrictionByID(r.Context(), block.RestrictionID)
+	if err != nil || restriction.ForReservations {
+		form.Errors.Add("restriction_id", "Choose why the room is blocked")
+	}
+
+	layout := "2006-01-02"
+	block.StartDate, err = time.Parse(layout, r.Form.Get("start_date"))
+	if err != nil {
+		form.Errors.Add("start_date", "Enter a date like 2050-08-01")
+	}
+
+	block.EndDate, err = time.Parse(layout, r.Form.Get("end_date"))
+	if err != nil {
+		form.Errors.Add("end_date", "Enter a date like 2050-08-05")
+	} else if !block.EndDate.After(block.StartDate) {
+		form.Errors.Add("end_date", "The block must end after it starts")
+	}
+
+	if !form.Valid() {
+		m.renderCalendar(w, r, now, form)
+		return
+	}
+
+	err = m.DB.InsertBlock(r.Context(), block)
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		if block.UnitID == 0 {
+			form.Errors.Add("start_date", "Every unit of the room is reserved or blocked for some of those nights")
+		} else {
+			form.Errors.Add("start_date", "The unit is already reserved or blocked for some of those nights")
+		}
+		m.renderCalendar(w, r, now, form)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Room blocked")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%d&m=%d", year, month), http.StatusSeeOther)
+}
+
+// AdminRooms lists the rooms in display order
+func (m *Repository) AdminRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-rooms.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowRoom shows the form to edit a room, or to add one when the id is 0
+func (m *Repository) AdminShowRoom(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	room := models.Room{Active: true, MaxOccupancy: 2}
+	if id > 0 {
+		room, err = m.DB.GetRoomByID(r.Context(), id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	m.renderRoom(w, r, room, forms.New(nil))
+}
+
+// renderRoom renders the room form with every amenity, checking the ones the room has
+func (m *Repository) renderRoom(w http.ResponseWriter, r *http.Request, room models.Room, form *forms.Form) {
+	amenities, err := m.DB.AllAmenities(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	selected := make(map[int]bool)
+	for _, a := range room.Amenities {
+		selected[a.ID] = true
+	}
+
+	data := make(map[string]interface{})
+	data["room"] = room
+	data["amenities"] = amenities
+	data["selected"] = selected
+
+	render.Template(w, r, "admin-room-show.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// AdminPostRoom adds or updates a room
+func (m *Repository) AdminPostRoom(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	room := models.Room{
+		ID:          id,
+		RoomName:    strings.TrimSpace(r.Form.Get("room_name")),
+		Slug:        strings.TrimSpace(r.Form.Get("slug")),
+		Description: strings.TrimSpace(r.Form.Get("description")),
+		Active:      r.Form.Get("active") != "",
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_name", "slug", "nightly_rate", "max_occupancy")
+	form.IsSlug("slug")
+	form.IsNumber("max_occupancy", 1, 2*maxGuests)
+	room.MaxOccupancy, _ = strconv.Atoi(strings.TrimSpace(r.Form.Get("max_occupancy")))
+
+	room.NightlyRate, err = pricing.Parse(r.Form.Get("nightly_rate"))
+	if err != nil {
+		form.Errors.Add("nightly_rate", "Enter an amount like 120 or 120.50")
+	}
+
+	// no weekend rate charges the nightly rate every night
+	if strings.TrimSpace(r.Form.Get("weekend_rate")) != "" {
+		room.WeekendRate, err = pricing.Parse(r.Form.Get("weekend_rate"))
+		if err != nil {
+			form.Errors.Add("weekend_rate", "Enter an amount like 120 or 120.50, or leave it empty")
+		}
+	}
+
+	// one image path per line
+	for _, line := range strings.Split(r.Form.Get("images"), "\n") {
+		if image := strings.TrimSpace(line); image != "" {
+			room.Images = append(room.Images, image)
+		}
+	}
+
+	for _, value := range r.Form["amenity"] {
+		amenityID, err := strconv.Atoi(value)
+		if err != nil {
+			form.Errors.Add("amenity", "Choose amenities from the list")
+			continue
+		}
+		room.Amenities = append(room.Amenities, models.Amenity{ID: amenityID})
+	}
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	for _, x := range rooms {
+		if x.ID != room.ID && x.Slug == room.Slug {
+			form.Errors.Add("slug", "Another room already uses this slug")
+		}
+	}
+
+	if !form.Valid() {
+		m.renderRoom(w, r, room, form)
+		return
+	}
+
+	if room.ID == 0 {
+		_, err = m.DB.InsertRoom(r.Context(), room)
+	} else {
+		err = m.DB.UpdateRoom(r.Context(), room)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Room saved")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// AdminToggleRoom deactivates an active room, or activates an inactive one
+func (m *Repository) AdminToggleRoom(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	room, err := m.DB.GetRoomByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.UpdateRoomActive(r.Context(), id, !room.Active)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if room.Active {
+		m.App.Session.Put(r.Context(), "flash", "Room deactivated")
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Room activated")
+	}
+
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// AdminMoveRoom moves a room one place up or down in the display order
+func (m *Repository) AdminMoveRoom(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	direction := chi.URLParam(r, "direction")
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var ids []int
+	for _, x := range rooms {
+		ids = append(ids, x.ID)
+	}
+
+	for i := range ids {
+		if ids[i] != id {
+			continue
+		}
+		if direction == "up" && i > 0 {
+			ids[i-1], ids[i] = ids[i], ids[i-1]
+		} else if direction == "down" && i < len(ids)-1 {
+			ids[i+1], ids[i] = ids[i], ids[i+1]
+		}
+		break
+	}
+
+	err = m.DB.UpdateRoomOrder(r.Context(), ids)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// AdminDeleteRoom deletes a room, unless it has future reservations
+func (m *Repository) AdminDeleteRoom(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	err := m.DB.DeleteRoom(r.Context(), id)
+	if errors.Is(err, repository.ErrRoomHasReservations) {
+		m.App.Session.Put(r.Context(), "error", "This room has upcoming reservations. Deactivate it instead.")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Room deleted")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
+
+// AdminRoomRates shows the rate overrides of a room and the price of its next nights
+func (m *Repository) AdminRoomRates(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderRoomRates(w, r, id, forms.New(nil))
+}
+
+// AdminPostRoomRate adds a rate override to a room
+func (m *Repository) AdminPostRoomRate(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rate := models.RoomRate{
+		RoomID: id,
+		Name:   strings.TrimSpace(r.Form.Get("name")),
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "start_date", "end_date", "nightly_rate")
+
+	layout := "2006-01-02"
+	rate.StartDate, err = time.Parse(layout, r.Form.Get("start_date"))
+	if err != nil {
+		form.Errors.Add("start_date", "Enter a date like 2050-12-24")
+	}
+
+	rate.EndDate, err = time.Parse(layout, r.Form.Get("end_date"))
+	if err != nil {
+		form.Errors.Add("end_date", "Enter a date like 2050-12-26")
+	} else if !rate.EndDate.After(rate.StartDate) {
+		form.Errors.Add("end_date", "The rate must end after it starts")
+	}
+
+	rate.NightlyRate, err = pricing.Parse(r.Form.Get("nightly_rate"))
+	if err != nil {
+		form.Errors.Add("nightly_rate", "Enter an amount like 120 or 120.50")
+	}
+
+	if strings.TrimSpace(r.Form.Get("weekend_rate")) != "" {
+		rate.WeekendRate, err = pricing.Parse(r.Form.Get("weekend_rate"))
+		if err != nil {
+			form.Errors.Add("weekend_rate", "Enter an amount like 120 or 120.50, or leave it empty")
+		}
+	}
+
+	if !form.Valid() {
+		m.renderRoomRates(w, r, id, form)
+		return
+	}
+
+	_, err = m.DB.InsertRoomRate(r.Context(), rate)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Rate added")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d/rates", id), http.StatusSeeOther)
+}
+
+// AdminDeleteRoomRate deletes a rate override
+func (m *Repository) AdminDeleteRoomRate(w http.ResponseWriter, r *http.Request) {
+	roomID, _ := strconv.Atoi(chi.URLParam(r, "room_id"))
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	err := m.DB.DeleteRoomRate(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Rate deleted")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d/rates", roomID), http.StatusSeeOther)
+}
+
+// renderRoomRates renders the rate calendar of a room with the add rate form
+func (m *Repository) renderRoomRates(w http.ResponseWriter, r *http.Request, roomID int, form *forms.Form) {
+	room, err := m.DB.GetRoomByID(r.Context(), roomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rates, err := m.DB.AllRoomRates(r.Context(), roomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// what the next 30 nights cost
+	today := time.Now().Truncate(24 * time.Hour)
+	calendar, err := pricing.Calculate(room, rates, today, today.AddDate(0, 0, 30))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["room"] = room
+	data["rates"] = rates
+	data["calendar"] = calendar.Nights
+
+	render.Template(w, r, "admin-room-rates.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// AdminRoomUnits shows the units of a room
+func (m *Repository) AdminRoomUnits(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderRoomUnits(w, r, id, forms.New(nil))
+}
+
+// AdminPostRoomUnit adds one or more units to a room. Several units are numbered after the name.
+func (m *Repository) AdminPostRoomUnit(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	name := strings.TrimSpace(r.Form.Get("name"))
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+
+	quantity := 1
+	if value := strings.TrimSpace(r.Form.Get("quantity")); value != "" {
+		quantity, err = strconv.Atoi(value)
+		if err != nil || quantity < 1 || quantity > 50 {
+			form.Errors.Add("quantity", "Enter a number from 1 to 50")
+		}
+	}
+
+	if !form.Valid() {
+		m.renderRoomUnits(w, r, id, form)
+		return
+	}
+
+	for i := 1; i <= quantity; i++ {
+		unit := models.RoomUnit{RoomID: id, Name: name}
+		if quantity > 1 {
+			unit.Name = fmt.Sprintf("%s %d", name, i)
+		}
+
+		_, err = m.DB.InsertRoomUnit(r.Context(), unit)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Units added")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d/units", id), http.StatusSeeOther)
+}
+
+// AdminDeleteRoomUnit deletes a unit without future reservations
+func (m *Repository) AdminDeleteRoomUnit(w http.ResponseWriter, r *http.Request) {
+	roomID, _ := strconv.Atoi(chi.URLParam(r, "room_id"))
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	err := m.DB.DeleteRoomUnit(r.Context(), id)
+	if errors.Is(err, repository.ErrRoomHasReservations) {
+		m.App.Session.Put(r.Context(), "error", "This unit has upcoming reservations and cannot be deleted.")
+		http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d/units", roomID), http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Unit deleted")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d/units", roomID), http.StatusSeeOther)
+}
+
+// renderRoomUnits renders the units of a room with the add units form
+func (m *Repository) renderRoomUnits(w http.ResponseWriter, r *http.Request, roomID int, form *forms.Form) {
+	room, err := m.DB.GetRoomByID(r.Context(), roomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	units, err := m.DB.AllRoomUnits(r.Context(), roomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["room"] = room
+	data["units"] = units
+
+	render.Template(w, r, "admin-room-units.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// AdminStayRules shows the stay rules of a room
+func (m *Repository) AdminStayRules(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderStayRules(w, r, id, forms.New(nil))
+}
+
+// AdminPostStayRule adds a stay rule to a room
+func (m *Repository) AdminPostStayRule(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
 
-	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
 
-}
+	rule := models.StayRule{
+		RoomID: id,
+		Name:   strings.TrimSpace(r.Form.Get("name")),
+	}
 
-// BookRoom takes URL parameters, builds a sessional variable, and takes user to make res screen
-func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
-	roomID, _ := strconv.Atoi(r.URL.Query().Get("id"))
-	sd := r.URL.Query().Get("s")
-	ed := r.URL.Query().Get("e")
+	form := forms.New(r.PostForm)
+	form.Required("name", "start_date", "end_date")
 
 	layout := "2006-01-02"
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
+	rule.StartDate, err = time.Parse(layout, r.Form.Get("start_date"))
+	if err != nil {
+		form.Errors.Add("start_date", "Enter a date like 2050-08-01")
+	}
 
-	var res models.Reservation
+	rule.EndDate, err = time.Parse(layout, r.Form.Get("end_date"))
+	if err != nil {
+		form.Errors.Add("end_date", "Enter a date like 2050-09-01")
+	} else if !rule.EndDate.After(rule.StartDate) {
+		form.Errors.Add("end_date", "The rule must end after it starts")
+	}
+
+	// empty means no limit
+	for field, nights := range map[string]*int{"min_nights": &rule.MinNights, "max_nights": &rule.MaxNights} {
+		value := strings.TrimSpace(r.Form.Get(field))
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			form.Errors.Add(field, "Enter a number of nights, or leave it empty")
+			continue
+		}
+		*nights = n
+	}
+
+	if rule.MinNights > 0 && rule.MaxNights > 0 && rule.MaxNights < rule.MinNights {
+		form.Errors.Add("max_nights", "The maximum cannot be less than the minimum")
+	}
 
-	room, err := m.DB.GetRoomByID(roomID)
+	rule.ClosedToArrival = weekdaysMask(r.Form["arrival_days"])
+	rule.ClosedToDeparture = weekdaysMask(r.Form["departure_days"])
+
+	if rule.MinNights == 0 && rule.MaxNights == 0 && rule.ClosedToArrival == 0 && rule.ClosedToDeparture == 0 {
+		form.Errors.Add("name", "Set a minimum or maximum stay, or close some days to arrival or departure")
+	}
+
+	if !form.Valid() {
+		m.renderStayRules(w, r, id, form)
+		return
+	}
+
+	_, err = m.DB.InsertStayRule(r.Context(), rule)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "Can't get room from db!")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		helpers.ServerError(w, err)
 		return
 	}
 
-	res.Room.RoomName = room.RoomName
-	res.RoomID = roomID
-	res.StartDate = startDate
-	res.EndDate = endDate
+	m.App.Session.Put(r.Context(), "flash", "Stay rule added")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d/rules", id), http.StatusSeeOther)
+}
 
-	m.App.Session.Put(r.Context(), "reservation", res)
+// AdminDeleteStayRule deletes a stay rule
+func (m *Repository) AdminDeleteStayRule(w http.ResponseWriter, r *http.Request) {
+	roomID, _ := strconv.Atoi(chi.URLParam(r, "room_id"))
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
 
-	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+	err := m.DB.DeleteStayRule(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Stay rule deleted")
+	http.Redirect(w, r, fmt.Sprintf("/admin/rooms/%d/rules", roomID), http.StatusSeeOther)
 }
 
-func (m *Repository) ShowLogin(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "login.page.tmpl", &models.TemplateData{
-		Form: forms.New(nil),
+// weekdaysMask turns posted weekday numbers, 0 for Sunday, into a weekdays bitmask
+func weekdaysMask(days []string) int {
+	var weekdays []time.Weekday
+	for _, day := range days {
+		d, err := strconv.Atoi(day)
+		if err == nil && d >= 0 && d <= 6 {
+			weekdays = append(weekdays, time.Weekday(d))
+		}
+	}
+
+	return stayrules.Mask(weekdays...)
+}
+
+// renderStayRules renders the stay rules of a room with the add rule form
+func (m *Repository) renderStayRules(w http.ResponseWriter, r *http.Request, roomID int, form *forms.Form) {
+	room, err := m.DB.GetRoomByID(r.Context(), roomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rules, err := m.DB.AllStayRules(r.Context(), roomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var weekdays []string
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		weekdays = append(weekdays, d.String())
+	}
+
+	data := make(map[string]interface{})
+	data["room"] = room
+	data["rules"] = rules
+	data["weekdays"] = weekdays
+
+	render.Template(w, r, "admin-room-rules.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
 	})
 }
 
-// PostShowLogin handles loggin the user in
-func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
-	log.Println("Here")
+// AdminRestrictions lists the restriction types rooms can be reserved or blocked with
+func (m *Repository) AdminRestrictions(w http.ResponseWriter, r *http.Request) {
+	restrictions, err := m.DB.AllRestrictions(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
 
-	// prevents session fixation atack
-	_ = m.App.Session.RenewToken(r.Context())
+	data := make(map[string]interface{})
+	data["restrictions"] = restrictions
+
+	render.Template(w, r, "admin-restrictions.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowRestriction shows the form to edit a restriction type, or to add one when the id is 0
+func (m *Repository) AdminShowRestriction(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	restriction := models.Restriction{Colour: "#6c757d"}
+	if id > 0 {
+		restriction, err = m.DB.GetRestrictionByID(r.Context(), id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	data := make(map[string]interface{})
+	data["restriction"] = restriction
+
+	render.Template(w, r, "admin-restriction-show.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
 
+// AdminPostRestriction adds or updates a restriction type
+func (m *Repository) AdminPostRestriction(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
-		log.Println(err)
+		helpers.ServerError(w, err)
+		return
 	}
 
-	email := r.Form.Get("email")
-	password := r.Form.Get("password")
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	restriction := models.Restriction{
+		ID:                    id,
+		RestrictionName:       strings.TrimSpace(r.Form.Get("restriction_name")),
+		Colour:                strings.ToLower(r.Form.Get("colour")),
+		CountsTowardOccupancy: r.Form.Get("counts_toward_occupancy") != "",
+	}
 
 	form := forms.New(r.PostForm)
-	form.Required("email", "password")
-	form.IsEmail("email")
+	form.Required("restriction_name", "colour")
+	form.IsColour("colour")
+
+	restrictions, err := m.DB.AllRestrictions(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	for _, x := range restrictions {
+		if x.ID == restriction.ID {
+			restriction.ForReservations = x.ForReservations
+		} else if strings.EqualFold(x.RestrictionName, restriction.RestrictionName) {
+			form.Errors.Add("restriction_name", "Another restriction type already uses this name")
+		}
+	}
+
 	if !form.Valid() {
-		log.Println("Form not valid")
-		render.Template(w, r, "login.page.tmpl", &models.TemplateData{
+		data := make(map[string]interface{})
+		data["restriction"] = restriction
+
+		render.Template(w, r, "admin-restriction-show.page.tmpl", &models.TemplateData{
+			Data: data,
 			Form: form,
 		})
 		return
 	}
 
-	id, _, err := m.DB.Authenticate(email, password)
+	if restriction.ID == 0 {
+		_, err = m.DB.InsertRestriction(r.Context(), restriction)
+	} else {
+		err = m.DB.UpdateRestriction(r.Context(), restriction)
+	}
 	if err != nil {
-		log.Println(err)
-		m.App.Session.Put(r.Context(), "error", "Invalid login credentials")
-		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		helpers.ServerError(w, err)
+		return
 	}
 
-	m.App.Session.Put(r.Context(), "user_id", id)
-	m.App.Session.Put(r.Context(), "flash", "Logged in successfully!")
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	m.App.Session.Put(r.Context(), "flash", "Restriction type saved")
+	http.Redirect(w, r, "/admin/restrictions", http.StatusSeeOther)
 }
 
-// Logout logs a user out
-func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
-	_ = m.App.Session.Destroy(r.Context())
-	// renew session token
-	_ = m.App.Session.RenewToken(r.Context())
+// AdminDeleteRestriction deletes a restriction type that no reservation or block uses
+func (m *Repository) AdminDeleteRestriction(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
 
-	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+	err := m.DB.DeleteRestriction(r.Context(), id)
+	if errors.Is(err, repository.ErrRestrictionInUse) {
+		m.App.Session.Put(r.Context(), "error", "This restriction type is still in use and cannot be deleted.")
+		http.Redirect(w, r, "/admin/restrictions", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Restriction type deleted")
+	http.Redirect(w, r, "/admin/restrictions", http.StatusSeeOther)
 }
 
-// AdminDashboard
-func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "admin-dashboard.page.tmpl", &models.TemplateData{})
+// AdminAPIKeys lists the api keys with the form to create one
+func (m *Repository) AdminAPIKeys(w http.ResponseWriter, r *http.Request) {
+	m.renderAPIKeys(w, r, forms.New(nil), "")
+}
+
+// AdminPostAPIKey creates an api key and shows it, the only time it can be seen
+func (m *Repository) AdminPostAPIKey(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "scope")
+	if form.Get("scope") != "" && !apikeys.ValidScope(form.Get("scope")) {
+		form.Errors.Add("scope", "Choose read or write")
+	}
+
+	if !form.Valid() {
+		m.renderAPIKeys(w, r, form, "")
+		return
+	}
+
+	key, prefix, hash, err := apikeys.Generate()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	_, err = m.DB.InsertAPIKey(r.Context(), models.APIKey{
+		Name:    strings.TrimSpace(form.Get("name")),
+		Prefix:  prefix,
+		KeyHash: hash,
+		Scope:   form.Get("scope"),
+	})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderAPIKeys(w, r, forms.New(nil), key)
+}
+
+// AdminRevokeAPIKey stops an api key from being used
+func (m *Repository) AdminRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+
+	err := m.DB.RevokeAPIKey(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "API key revoked")
+	http.Redirect(w, r, "/admin/api-keys", http.StatusSeeOther)
+}
+
+// renderAPIKeys renders the api keys with the create key form, and the key just created if there is one
+func (m *Repository) renderAPIKeys(w http.ResponseWriter, r *http.Request, form *forms.Form, newKey string) {
+	keys, err := m.DB.AllAPIKeys(r.Context())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["keys"] = keys
+
+	stringMap := make(map[string]string)
+	stringMap["new_key"] = newKey
+
+	render.Template(w, r, "admin-api-keys.page.tmpl", &models.TemplateData{
+		Data:      data,
+		Form:      form,
+		StringMap: stringMap,
+	})
+}
+
+// webhookPayload is the body of a webhook request
+type webhookPayload struct {
+	Event       string         `json:"event"`
+	OccurredAt  time.Time      `json:"occurred_at"`
+	Reservation apiReservation `json:"reservation"`
+}
+
+// queueWebhooks queues an event about a reservation for the webhooks subscribed to it. The change it reports is
+// already saved, so a failure is only logged.
+func (m *Repository) queueWebhooks(ctx context.Context, event string, res models.Reservation) {
+	payload, err := json.Marshal(webhookPayload{
+		Event:       event,
+		OccurredAt:  time.Now().UTC(),
+		Reservation: newAPIReservation(res),
+	})
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	_, err = m.DB.InsertWebhookDeliveries(ctx, event, string(payload))
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+}
+
+// AdminWebhooks lists the webhooks with the form to add one
+func (m *Repository) AdminWebhooks(w http.ResponseWriter, r *http.Request) {
+	m.renderWebhooks(w, r, forms.New(nil), "")
+}
+
+// AdminPostWebhook adds a webhook and shows its secret, the only time it can be seen
+func (m *Repository) AdminPostWebhook(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("url")
+	if form.Get("url") != "" {
+		form.IsURL("url")
+	}
+
+	events := form.Values["event"]
+	if len(events) == 0 {
+		form.Errors.Add("event", "Choose at least one event")
+	}
+	for _, event := range events {
+		if !webhooks.ValidEvent(event) {
+			form.Errors.Add("event", fmt.Sprintf("Unknown event %s", event))
+		}
+	}
+
+	if !form.Valid() {
+		m.renderWebhooks(w, r, form, "")
+		return
+	}
+
+	secret, err := webhooks.GenerateSecret()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	_, err = m.DB.InsertWebhook(r.Context(), models.Webhook{
+		URL:    strings.TrimSpace(form.Get("url")),
+		Secret: secret,
+		Events: events,
+	})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderWebhooks(w, r, forms.New(nil), secret)
 }
 
-// AdminNewReservations shows all new reservations in admin tool
-func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllNewReservations()
+// AdminDeleteWebhook deletes a webhook and its deliveries
+func (m *Repository) AdminDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
 
+	err := m.DB.DeleteWebhook(r.Context(), id)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	data := make(map[string]interface{})
-	data["reservations"] = reservations
-
-	render.Template(w, r, "admin-new-reservations.page.tmpl", &models.TemplateData{
-		Data: data,
-	})
+	m.App.Session.Put(r.Context(), "flash", "Webhook deleted")
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
 }
 
-// AdminAllReservations shows all reservations in admin tool
-func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
-	log.Println("Show All")
-	reservations, err := m.DB.AllReservations()
-
+// renderWebhooks renders the webhooks with the add webhook form, and the secret of the webhook just added if
+// there is one
+func (m *Repository) renderWebhooks(w http.ResponseWriter, r *http.Request, form *forms.Form, newSecret string) {
+	hooks, err := m.DB.AllWebhooks(r.Context())
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
+	checked := make(map[string]bool)
+	for _, event := range form.Values["event"] {
+		checked[event] = true
+	}
+
 	data := make(map[string]interface{})
-	data["reservations"] = reservations
+	data["webhooks"] = hooks
+	data["events"] = webhooks.Events
+	data["checked"] = checked
 
-	render.Template(w, r, "admin-all-reservations.page.tmpl", &models.TemplateData{
-		Data: data,
+	stringMap := make(map[string]string)
+	stringMap["new_secret"] = newSecret
+
+	render.Template(w, r, "admin-webhooks.page.tmpl", &models.TemplateData{
+		Data:      data,
+		Form:      form,
+		StringMap: stringMap,
 	})
 }
 
-// AdminShowReservation shows the reservation in the admin tool
-func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
+// webhookLogSize is how many deliveries the delivery log shows
+const webhookLogSize = 100
 
-	// grab the url
-	exploded := strings.Split(r.RequestURI, "/")
-	id, err := strconv.Atoi(exploded[4])
+// AdminWebhookDeliveries shows the latest webhook deliveries and how they went
+func (m *Repository) AdminWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := m.DB.RecentWebhookDeliveries(r.Context(), webhookLogSize)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	src := exploded[3]
-
-	stringMap := make(map[string]string)
-	stringMap["src"] = src
+	data := make(map[string]interface{})
+	data["deliveries"] = deliveries
 
-	year := r.URL.Query().Get("y")
-	month := r.URL.Query().Get("m")
+	intMap := make(map[string]int)
+	intMap["max_attempts"] = webhooks.MaxAttempts
 
-	stringMap["month"] = month
-	stringMap["year"] = year
+	render.Template(w, r, "admin-webhook-deliveries.page.tmpl", &models.TemplateData{
+		Data:   data,
+		IntMap: intMap,
+	})
+}
 
-	// get reservation from database
-	res, err := m.DB.GetReservationById(id)
+// AdminUsers lists the staff who can log in to the admin area
+func (m *Repository) AdminUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := m.DB.AllUsers(r.Context())
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
 	data := make(map[string]interface{})
-	data["reservation"] = res
+	data["users"] = users
 
-	render.Template(w, r, "admin-reservations-show.page.tmpl", &models.TemplateData{
-		StringMap: stringMap,
-		Data:      data,
-		Form:      forms.New(nil),
+	render.Template(w, r, "admin-users.page.tmpl", &models.TemplateData{
+		Data: data,
 	})
 }
 
-// AdminShowReservation shows the reservation in the admin tool
-func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+// AdminShowUser shows the form to edit a user, or to invite one when the id is 0
+func (m *Repository) AdminShowUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	// grab the url
-	exploded := strings.Split(r.RequestURI, "/")
-	id, err := strconv.Atoi(exploded[4])
-	if err != nil {
-		helpers.ServerError(w, err)
-		return
+	user := models.User{AccessLevel: int(access.ReadOnly), Active: true}
+	if id > 0 {
+		user, err = m.DB.GetUserByID(r.Context(), id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
 	}
 
-	src := exploded[3]
+	m.renderUser(w, r, user, forms.New(nil))
+}
 
-	stringMap := make(map[string]string)
-	stringMap["src"] = src
+// renderUser renders the user form with every role
+func (m *Repository) renderUser(w http.ResponseWriter, r *http.Request, user models.User, form *forms.Form) {
+	current, _ := access.UserFrom(r.Context())
+
+	data := make(map[string]interface{})
+	data["user"] = user
+	data["roles"] = access.Roles
+
+	intMap := make(map[string]int)
+	intMap["current_user_id"] = current.ID
+
+	render.Template(w, r, "admin-user-show.page.tmpl", &models.TemplateData{
+		Data:   data,
+		Form:   form,
+		IntMap: intMap,
+	})
+}
 
-	reservation, err := m.DB.GetReservationById(id)
+// AdminPostUser invites a user, who gets an email to set their password, or updates the names, email and role
+// of one. Owners cannot change their own role, so there is always an owner left.
+func (m *Repository) AdminPostUser(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	reservation.FirstName = r.Form.Get("first_name")
-	reservation.LastName = r.Form.Get("last_name")
-	reservation.Email = r.Form.Get("email")
-	reservation.Phone = r.Form.Get("phone")
-
-	err = m.DB.UpdateReservation(reservation)
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	month := r.Form.Get("month")
-	year := r.Form.Get("year")
-
-	m.App.Session.Put(r.Context(), "flash", "Changes saved!")
-
-	if year == "" {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
-	} else {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	user := models.User{ID: id, Active: true}
+	if id > 0 {
+		user, err = m.DB.GetUserByID(r.Context(), id)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
 	}
+	previousLevel := user.AccessLevel
 
-}
-
-// AdminCalendarReservations displays the reservation calendar
-func (m *Repository) AdminCalendarReservations(w http.ResponseWriter, r *http.Request) {
-	// assume that there is no month or year specified
-	now := time.Now()
+	user.FirstName = strings.TrimSpace(r.Form.Get("first_name"))
+	user.LastName = strings.TrimSpace(r.Form.Get("last_name"))
+	user.Email = strings.TrimSpace(r.Form.Get("email"))
+	user.AccessLevel, _ = strconv.Atoi(r.Form.Get("access_level"))
 
-	if r.URL.Query().Get("y") != "" {
-		year, _ := strconv.Atoi(r.URL.Query().Get("y"))
-		month, _ := strconv.Atoi(r.URL.Query().Get("m"))
-		now = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email", "access_level")
+	form.IsEmail("email")
+	if _, ok := access.RoleFor(user.AccessLevel); !ok {
+		form.Errors.Add("access_level", "Choose a role from the list")
 	}
 
-	data := make(map[string]interface{})
-	data["now"] = now
-
-	next := now.AddDate(0, 1, 0)
-	last := now.AddDate(0, -1, 0)
-
-	nextMonth := next.Format("01")
-	nextMonthYear := next.Format("2006")
-
-	lastMonth := last.Format("01")
-	lastMonthYear := last.Format("2006")
-
-	stringMap := make(map[string]string)
-	stringMap["next_month"] = nextMonth
-	stringMap["next_month_year"] = nextMonthYear
-	stringMap["last_month"] = lastMonth
-	stringMap["last_month_year"] = lastMonthYear
-
-	stringMap["this_month"] = now.Format("01")
-	stringMap["this_month_year"] = now.Format("2006")
-
-	// get the first and last days of the month
-	currentYear, currentMonth, _ := now.Date()
-	currentLocation := now.Location()
-	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
-	// add one month and take one day off
-	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
-
-	intMap := make(map[string]int)
-	intMap["days_in_month"] = lastOfMonth.Day()
+	current, _ := access.UserFrom(r.Context())
+	if id > 0 && id == current.ID && user.AccessLevel != previousLevel {
+		form.Errors.Add("access_level", "You cannot change your own role")
+	}
 
-	rooms, err := m.DB.AllRooms()
-	if err != nil {
-		helpers.ServerError(w, err)
+	if !form.Valid() {
+		m.renderUser(w, r, user, form)
 		return
 	}
 
-	data["rooms"] = rooms
-
-	for _, x := range rooms {
-		// create maps
-		reservationMap := make(map[string]int)
-		blockMap := make(map[string]int)
-
-		for d := firstOfMonth; d.After(lastOfMonth) == false; d = d.AddDate(0, 0, 1) {
-			reservationMap[d.Format("2006-01-2")] = 0
-			blockMap[d.Format("2006-01-2")] = 0
-		}
-
-		// get all the restrictions for the current room
-		restrictions, err := m.DB.GetRestrictions(x.ID, firstOfMonth, lastOfMonth)
+	var token string
+	if id == 0 {
+		token, user.PasswordTokenHash, err = access.GeneratePasswordToken()
 		if err != nil {
 			helpers.ServerError(w, err)
 			return
 		}
+		user.PasswordTokenExpiresAt = time.Now().Add(access.PasswordTokenLifetime)
 
-		for _, y := range restrictions {
-			if y.ReservationID > 0 {
-				// it's a reservation
-				for d := y.StartDate; d.After(y.EndDate) == false; d = d.AddDate(0, 0, 1) {
-					reservationMap[d.Format("2006-01-2")] = y.ReservationID
-				}
-			} else {
-				// it's a block
-				blockMap[y.StartDate.Format("2006-01-2")] = y.ID
-			}
-		}
-
-		data[fmt.Sprintf("reservation_map_%d", x.ID)] = reservationMap
-		data[fmt.Sprintf("block_map_%d", x.ID)] = blockMap
+		_, err = m.DB.InsertUser(r.Context(), user)
+	} else {
+		err = m.DB.UpdateUser(r.Context(), user)
+	}
+	if errors.Is(err, repository.ErrEmailTaken) {
+		form.Errors.Add("email", "Another user already has this email")
+		m.renderUser(w, r, user, form)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
 
-		//store the blockMap for this room in the session
-		m.App.Session.Put(r.Context(), fmt.Sprintf("block_map_%d", x.ID), blockMap)
+	if id == 0 {
+		m.sendPasswordLink(user, token, "You are invited to Bookings",
+			"You are invited to manage reservations at Bookings.")
+		m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Invitation sent to %s", user.Email))
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "User saved")
 	}
 
-	render.Template(w, r, "admin-calendar-reservations.page.tmpl", &models.TemplateData{
-		StringMap: stringMap,
-		Data:      data,
-		IntMap:    intMap,
-	})
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
 }
 
-// AdminProcessReservation marks a reservation aas processed
-func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
+// AdminToggleUser deactivates an active user, who is logged out and cannot log in again, or activates an
+// inactive one
+func (m *Repository) AdminToggleUser(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	src := chi.URLParam(r, "src")
-	err := m.DB.UpdateProcessedForReservation(id, 1)
-	if err != nil {
-		log.Println(err)
+
+	if current, _ := access.UserFrom(r.Context()); current.ID == id {
+		m.App.Session.Put(r.Context(), "error", "You cannot deactivate yourself")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
 	}
 
-	year := r.URL.Query().Get("y")
-	month := r.URL.Query().Get("m")
+	user, err := m.DB.GetUserByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
 
-	m.App.Session.Put(r.Context(), "flash", "Reservation marked as processed")
+	err = m.DB.UpdateUserActive(r.Context(), id, !user.Active)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
 
-	if year == "" {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	if user.Active {
+		m.App.Session.Put(r.Context(), "flash", "User deactivated")
 	} else {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+		m.App.Session.Put(r.Context(), "flash", "User activated")
 	}
+
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
 }
 
-// AdminProcessReservation deletes a reservation
-func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
+// AdminResetUserPassword clears the password of a user, logging them out, and emails them a link to set a new one
+func (m *Repository) AdminResetUserPassword(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	src := chi.URLParam(r, "src")
-	_ = m.DB.DeleteReservation(id)
-
-	year := r.URL.Query().Get("y")
-	month := r.URL.Query().Get("m")
-
-	m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
 
-	if year == "" {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
-	} else {
-		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	if current, _ := access.UserFrom(r.Context()); current.ID == id {
+		m.App.Session.Put(r.Context(), "error", "You cannot reset your own password")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
 	}
 
-}
-
-// AdminPostCalendarReservations handles post of reservation calendar
-func (m *Repository) AdminPostCalendarReservations(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	user, err := m.DB.GetUserByID(r.Context(), id)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	year, _ := strconv.Atoi(r.Form.Get("y"))
-	month, _ := strconv.Atoi(r.Form.Get("m"))
-
-	// process blocks
-	rooms, err := m.DB.AllRooms()
+	token, hash, err := access.GeneratePasswordToken()
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	form := forms.New(r.PostForm)
-	for _, x := range rooms {
-		// Get the block map from the session. Loop through entire map, if we have an entry in the map that
-		// does not exist in our posted data, and if the restriction id > 0, then it is a block we need to remove.
-		currentMap := m.App.Session.Get(r.Context(), fmt.Sprintf("block_map_%d", x.ID)).(map[string]int)
-		for name, value := range currentMap {
-			// ok will be false if the value is not in the map
-			if val, ok := currentMap[name]; ok {
-				// only pay atention to values > 0, and that are not in the form post
-				// the rest are just placeholders for days without blocks
-				if val > 0 {
-					if !form.Has(fmt.Sprintf("remove_block_%d_%s", x.ID, name)) {
-						// delete the restriction by id
-						log.Println("Deleted")
-						err := m.DB.DeleteBlockByID(value)
-						if err != nil {
-							log.Println(err)
-						}
-					}
-				}
-			}
-		}
+	err = m.DB.ResetPassword(r.Context(), id, hash, time.Now().Add(access.PasswordTokenLifetime))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
 	}
 
-	// now handle new blocks
-	for name, _ := range r.PostForm {
-		if strings.HasPrefix(name, "add_block") {
-			exploded := strings.Split(name, "_")
-			roomID, _ := strconv.Atoi(exploded[2])
-			t, _ := time.Parse("2006-01-2", exploded[3])
-			// insert a new block
-			err := m.DB.InsertBlockForRoom(roomID, t)
-			if err != nil {
-				log.Println(err)
-			}
-		}
-	}
+	m.sendPasswordLink(user, token, "Set a new Bookings password",
+		"Your Bookings password was reset by an owner.")
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Password reset, a link to set a new one was sent to %s",
+		user.Email))
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
 
-	m.App.Session.Put(r.Context(), "flash", "Changes saved")
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%d&m=%d", year, month), http.StatusSeeOther)
+// sendPasswordLink emails a user the link to set their password with token, on the configured base url
+func (m *Repository) sendPasswordLink(user models.User, token, subject, intro string) {
+	link := fmt.Sprintf("%s/user/set-password/%s", m.App.BaseURL, token)
+
+	htmlMessage := fmt.Sprintf(`
+	<strong>%s</strong><br><br>
+	Dear %s, <br>
+	%s Set your password at <a href="%s">%s</a>.<br>
+	The link can be used once, within %d hours.
+`, subject, user.FirstName, intro, link, link, int(access.PasswordTokenLifetime.Hours()))
+
+	msg := models.MailData{
+		To:       user.Email,
+		From:     "me@here.com",
+		Subject:  subject,
+		Content:  htmlMessage,
+		Template: "basic.html",
+	}
+	m.App.MailChan <- msg
 }
@@ -3,13 +3,21 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/FilipeParreiras/Bookings/internal/access"
+	"github.com/FilipeParreiras/Bookings/internal/config"
 	"github.com/FilipeParreiras/Bookings/internal/models"
+	"github.com/FilipeParreiras/Bookings/internal/stayrules"
+	"github.com/FilipeParreiras/Bookings/internal/webhooks"
+	"github.com/go-chi/chi/v5"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 type postData struct {
@@ -27,6 +35,8 @@ var theTests = []struct {
 	{"about", "/about", "GET", http.StatusOK},
 	{"generals-quarters", "/generals-quarters", "GET", http.StatusOK},
 	{"majors-suite", "/majors-suite", "GET", http.StatusOK},
+	{"room", "/rooms/generals-quarters", "GET", http.StatusOK},
+	{"unknown room", "/rooms/colonels-cabin", "GET", http.StatusNotFound},
 	{"search-availability", "/search-availability", "GET", http.StatusOK},
 	{"contact", "/contact", "GET", http.StatusOK},
 	{"make-res", "/make-reservation", "GET", http.StatusOK},
@@ -61,9 +71,47 @@ func TestHandlers(t *testing.T) {
 	}
 }
 
+func TestRepository_Room(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/rooms/majors-suite", nil)
+	request = request.WithContext(withURLParams(getConstext(request), map[string]string{"slug": "majors-suite"}))
+	responseRecorder := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.Room).ServeHTTP(responseRecorder, request)
+
+	if responseRecorder.Code != http.StatusOK {
+		t.Errorf("Room handler returned %d, wanted %d", responseRecorder.Code, http.StatusOK)
+	}
+
+	body := responseRecorder.Body.String()
+	for _, expected := range []string{"Major&#39;s Suite", "Private bathroom", "/static/images/marjors-suite.png", `href="/rooms/generals-quarters"`} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("room page does not contain %s", expected)
+		}
+	}
+
+	// inactive rooms are not shown to guests
+	id, err := testDB.InsertRoom(context.Background(), models.Room{RoomName: "Closed Room", Slug: "closed-room"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeleteRoom(context.Background(), id)
+
+	request, _ = http.NewRequest("GET", "/rooms/closed-room", nil)
+	request = request.WithContext(withURLParams(getConstext(request), map[string]string{"slug": "closed-room"}))
+	responseRecorder = httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.Room).ServeHTTP(responseRecorder, request)
+
+	if responseRecorder.Code != http.StatusNotFound {
+		t.Errorf("Room handler returned %d for an inactive room, wanted %d", responseRecorder.Code, http.StatusNotFound)
+	}
+}
+
 func TestRepository_Reservation(t *testing.T) {
 	reservation := models.Reservation{
-		RoomID: 1,
+		RoomID:    1,
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
 		Room: models.Room{
 			ID:       1,
 			RoomName: "General's Quarters",
@@ -95,8 +143,8 @@ func TestRepository_Reservation(t *testing.T) {
 	responseRecorder = httptest.NewRecorder()
 
 	handler.ServeHTTP(responseRecorder, request)
-	if responseRecorder.Code != http.StatusTemporaryRedirect {
-		t.Errorf("Reservation handler retured wrong response code: got %d, wanted %d", responseRecorder.Code, http.StatusTemporaryRedirect)
+	if responseRecorder.Code != http.StatusSeeOther {
+		t.Errorf("Reservation handler retured wrong response code: got %d, wanted %d", responseRecorder.Code, http.StatusSeeOther)
 	}
 
 	// test with non-existing room
@@ -108,8 +156,8 @@ func TestRepository_Reservation(t *testing.T) {
 	session.Put(ctx, "reservation", reservation)
 
 	handler.ServeHTTP(responseRecorder, request)
-	if responseRecorder.Code != http.StatusTemporaryRedirect {
-		t.Errorf("Reservation handler retured wrong response code: got %d, wanted %d", responseRecorder.Code, http.StatusTemporaryRedirect)
+	if responseRecorder.Code != http.StatusSeeOther {
+		t.Errorf("Reservation handler retured wrong response code: got %d, wanted %d", responseRecorder.Code, http.StatusSeeOther)
 	}
 
 }
@@ -139,6 +187,412 @@ func TestRepository_PostReservation(t *testing.T) {
 		t.Errorf("Reservation handler retured wrong response code: got %d, wanted %d", responseRecorder.Code,
 			http.StatusSeeOther)
 	}
+
+	// one night in the General's Quarters
+	saved, _ := session.Get(ctx, "reservation").(models.Reservation)
+	if saved.TotalPrice != 12000 {
+		t.Errorf("reservation total is %d, wanted 12000", saved.TotalPrice)
+	}
+
+	// test case where the dates were taken after the guest searched: the same room and dates again
+	request, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
+	ctx = getConstext(request)
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	responseRecorder = httptest.NewRecorder()
+
+	handler.ServeHTTP(responseRecorder, request)
+
+	if responseRecorder.Code != http.StatusSeeOther {
+		t.Errorf("Reservation handler retured wrong response code: got %d, wanted %d", responseRecorder.Code,
+			http.StatusSeeOther)
+	}
+
+	if location := responseRecorder.Header().Get("Location"); location != "/search-availability" {
+		t.Errorf("Reservation handler redirected to %s instead of /search-availability when dates were taken",
+			location)
+	}
+
+	// test case where the party is too big for the room, which shows the form again
+	request, _ = http.NewRequest("POST", "/make-reservation",
+		strings.NewReader(strings.Replace(reqBody, "2050-01-01", "2050-02-01", 1)+"&adults=2&children=1"))
+	ctx = getConstext(request)
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	responseRecorder = httptest.NewRecorder()
+
+	handler.ServeHTTP(responseRecorder, request)
+
+	if location := responseRecorder.Header().Get("Location"); location != "" {
+		t.Errorf("Reservation handler redirected to %s instead of showing the form for too many guests", location)
+	}
+
+	if !strings.Contains(responseRecorder.Body.String(), "sleeps up to 2 guests") {
+		t.Error("Reservation handler did not say how many guests the room sleeps")
+	}
+
+	// test case where the room was deactivated
+	if err := testDB.UpdateRoomActive(context.Background(), 1, false); err != nil {
+		t.Fatal(err)
+	}
+	request, _ = http.NewRequest("POST", "/make-reservation",
+		strings.NewReader(strings.Replace(reqBody, "2050-01-01", "2050-02-01", 1)))
+	ctx = getConstext(request)
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	responseRecorder = httptest.NewRecorder()
+
+	handler.ServeHTTP(responseRecorder, request)
+	_ = testDB.UpdateRoomActive(context.Background(), 1, true)
+
+	if location := responseRecorder.Header().Get("Location"); location != "/" {
+		t.Errorf("Reservation handler redirected to %s instead of / for an inactive room", location)
+	}
+
+	// test case where the database fails
+	testDB.FailOn("InsertReservationWithRestriction", errors.New("connection reset"))
+	defer testDB.ClearFailures()
+
+	reqBody = strings.Replace(reqBody, "room_id=1", "room_id=2", 1)
+	request, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
+	ctx = getConstext(request)
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	responseRecorder = httptest.NewRecorder()
+
+	handler.ServeHTTP(responseRecorder, request)
+
+	if location := responseRecorder.Header().Get("Location"); location != "/" {
+		t.Errorf("Reservation handler redirected to %s instead of / when the database failed", location)
+	}
+}
+
+func TestRepository_PostAvailability(t *testing.T) {
+	var tests = []struct {
+		name             string
+		start            string
+		end              string
+		guests           string
+		failure          error
+		expectedCode     int
+		expectedLocation string
+	}{
+		{"rooms available", "2050-06-01", "2050-06-05", "", nil, http.StatusOK, ""},
+		{"alternatives", "2050-06-10", "2050-06-12", "", nil, http.StatusOK, ""},
+		{"no availability", "2050-06-10", "2050-06-12", "&adults=5", nil, http.StatusSeeOther, "/search-availability"},
+		{"database error", "2050-06-01", "2050-06-05", "", errors.New("connection reset"), http.StatusSeeOther, "/"},
+		{"invalid start date", "invalid", "2050-06-05", "", nil, http.StatusSeeOther, "/"},
+		{"room for a family", "2050-06-01", "2050-06-05", "&adults=2&children=2", nil, http.StatusOK, ""},
+		{"too many guests", "2050-06-01", "2050-06-05", "&adults=4&children=1", nil, http.StatusSeeOther, "/search-availability"},
+		{"no adults", "2050-06-01", "2050-06-05", "&adults=0&children=2", nil, http.StatusSeeOther, "/search-availability"},
+		{"past arrival", "2020-06-01", "2020-06-05", "", nil, http.StatusSeeOther, "/search-availability"},
+		{"longest stay", "2050-06-13", "2050-07-13", "", nil, http.StatusOK, ""},
+		{"too long", "2050-06-13", "2050-07-14", "", nil, http.StatusSeeOther, "/search-availability"},
+	}
+
+	// book every room for the "alternatives" and "no availability" cases
+	for _, roomID := range []int{1, 2} {
+		_, err := testDB.InsertReservationWithRestriction(context.Background(), models.Reservation{
+			FirstName: "John",
+			LastName:  "Smith",
+			Email:     "john@smith.com",
+			StartDate: time.Date(2050, 6, 10, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 6, 12, 0, 0, 0, 0, time.UTC),
+			RoomID:    roomID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, e := range tests {
+		if e.failure != nil {
+			testDB.FailOn("SearchAvailabilityForAllRooms", e.failure)
+		}
+
+		reqBody := fmt.Sprintf("start=%s&end=%s%s", e.start, e.end, e.guests)
+		request, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(reqBody))
+		ctx := getConstext(request)
+		request = request.WithContext(ctx)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		responseRecorder := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.PostAvailability).ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedCode, responseRecorder.Code)
+		}
+
+		if location := responseRecorder.Header().Get("Location"); location != e.expectedLocation {
+			t.Errorf("%s: expected redirect to %q but got %q", e.name, e.expectedLocation, location)
+		}
+
+		testDB.ClearFailures()
+	}
+}
+
+func TestRepository_PostAvailabilityAlternatives(t *testing.T) {
+	// every room is taken on the 8th and from the 10th to the 12th
+	for _, roomID := range []int{1, 2} {
+		for _, stay := range [][2]int{{8, 9}, {10, 12}} {
+			_, err := testDB.InsertReservationWithRestriction(context.Background(), models.Reservation{
+				FirstName: "John",
+				LastName:  "Smith",
+				Email:     "john@smith.com",
+				StartDate: time.Date(2050, 8, stay[0], 0, 0, 0, 0, time.UTC),
+				EndDate:   time.Date(2050, 8, stay[1], 0, 0, 0, 0, time.UTC),
+				RoomID:    roomID,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var tests = []struct {
+		name     string
+		start    string
+		end      string
+		expected []string
+		missing  []string
+	}{
+		{"shifted stays", "2050-08-10", "2050-08-12",
+			[]string{"id=2&s=2050-08-12&e=2050-08-14", "id=2&s=2050-08-13&e=2050-08-15"},
+			[]string{"s=2050-08-08", "s=2050-08-07", "s=2050-08-11", "id=1&"}},
+		{"shorter stay", "2050-08-08", "2050-08-12",
+			[]string{"id=2&s=2050-08-09&e=2050-08-10"},
+			[]string{"s=2050-08-08", "s=2050-08-10", "s=2050-08-11", "id=1&"}},
+	}
+
+	for _, e := range tests {
+		reqBody := fmt.Sprintf("start=%s&end=%s&adults=2&children=1", e.start, e.end)
+		request, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(reqBody))
+		request = request.WithContext(getConstext(request))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		responseRecorder := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.PostAvailability).ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Fatalf("%s: expected %d but got %d", e.name, http.StatusOK, responseRecorder.Code)
+		}
+
+		body := responseRecorder.Body.String()
+		for _, text := range e.expected {
+			if !strings.Contains(body, text) {
+				t.Errorf("%s: expected an alternative with %q", e.name, text)
+			}
+		}
+		for _, text := range e.missing {
+			if strings.Contains(body, text) {
+				t.Errorf("%s: did not expect an alternative with %q", e.name, text)
+			}
+		}
+		if !strings.Contains(body, "a=2&c=1") {
+			t.Errorf("%s: alternatives do not keep the party", e.name)
+		}
+	}
+
+	// the one free night is more than maxShorterBy nights shorter than this search, so it is not offered
+	reqBody := "start=2050-08-07&end=2050-08-13&adults=2&children=1"
+	request, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(reqBody))
+	request = request.WithContext(getConstext(request))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	responseRecorder := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.PostAvailability).ServeHTTP(responseRecorder, request)
+
+	if location := responseRecorder.Header().Get("Location"); location != "/search-availability" {
+		t.Errorf("expected no alternatives for a much longer search but got %d %q", responseRecorder.Code, location)
+	}
+}
+
+func TestRepository_BookRoom(t *testing.T) {
+	var tests = []struct {
+		name             string
+		url              string
+		expectedLocation string
+	}{
+		{"valid", "/book-room?id=1&s=2050-04-01&e=2050-04-03", "/make-reservation"},
+		{"missing start date", "/book-room?id=1&e=2050-04-03", "/"},
+		{"invalid end date", "/book-room?id=1&s=2050-04-01&e=tomorrow", "/"},
+		{"unknown room", "/book-room?id=99&s=2050-04-01&e=2050-04-03", "/"},
+		{"inactive room", "/book-room?id=2&s=2050-04-01&e=2050-04-03", "/"},
+	}
+
+	if err := testDB.UpdateRoomActive(context.Background(), 2, false); err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.UpdateRoomActive(context.Background(), 2, true)
+
+	for _, e := range tests {
+		request, _ := http.NewRequest("GET", e.url, nil)
+		ctx := getConstext(request)
+		request = request.WithContext(ctx)
+		responseRecorder := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.BookRoom).ServeHTTP(responseRecorder, request)
+
+		if location := responseRecorder.Header().Get("Location"); location != e.expectedLocation {
+			t.Errorf("%s: expected to be sent to %s but got %s", e.name, e.expectedLocation, location)
+		}
+		if _, saved := session.Get(ctx, "reservation").(models.Reservation); saved != (e.expectedLocation != "/") {
+			t.Errorf("%s: expected a reservation in the session to be %t", e.name, !saved)
+		}
+	}
+}
+
+func TestRepository_SplitStay(t *testing.T) {
+	// the General's Quarters is taken from the 3rd and the Major's Suite until the 3rd
+	for _, stay := range []struct{ roomID, start, end int }{{1, 3, 5}, {2, 1, 3}} {
+		_, err := testDB.InsertReservationWithRestriction(context.Background(), models.Reservation{
+			FirstName: "John",
+			LastName:  "Smith",
+			Email:     "john@smith.com",
+			StartDate: time.Date(2050, 9, stay.start, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 9, stay.end, 0, 0, 0, 0, time.UTC),
+			RoomID:    stay.roomID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the search suggests moving rooms on the 3rd
+	reqBody := "start=2050-09-01&end=2050-09-05&adults=2"
+	request, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(reqBody))
+	ctx := getConstext(request)
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	responseRecorder := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.PostAvailability).ServeHTTP(responseRecorder, request)
+
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("search returned %d, wanted %d", responseRecorder.Code, http.StatusOK)
+	}
+	if !strings.Contains(responseRecorder.Body.String(), "/make-split-reservation") {
+		t.Error("search does not offer the split stay")
+	}
+
+	split, _ := session.Get(ctx, "split").(models.Booking)
+	if len(split.Reservations) != 2 {
+		t.Fatalf("split stay has %d reservations, wanted 2", len(split.Reservations))
+	}
+	first, second := split.Reservations[0], split.Reservations[1]
+	if first.RoomID != 1 || first.EndDate.Format("2006-01-02") != "2050-09-03" ||
+		second.RoomID != 2 || second.StartDate.Format("2006-01-02") != "2050-09-03" {
+		t.Errorf("unexpected split stay %+v", split.Reservations)
+	}
+
+	// the make a reservation page lists both stays
+	request, _ = http.NewRequest("GET", "/make-split-reservation", nil)
+	ctx = getConstext(request)
+	request = request.WithContext(ctx)
+	session.Put(ctx, "split", split)
+	responseRecorder = httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.SplitReservation).ServeHTTP(responseRecorder, request)
+
+	if responseRecorder.Code != http.StatusOK {
+		t.Errorf("split reservation page returned %d, wanted %d", responseRecorder.Code, http.StatusOK)
+	}
+
+	var tests = []struct {
+		name             string
+		party            string
+		expectedCode     int
+		expectedLocation string
+	}{
+		{"too many guests for the first room", "adults=3&children=1", http.StatusOK, ""},
+		{"booked", "adults=2", http.StatusSeeOther, "/reservation-summary"},
+		{"taken since the search", "adults=2", http.StatusSeeOther, "/search-availability"},
+	}
+
+	for _, e := range tests {
+		reqBody = "first_name=John&last_name=Smith&email=john@smith.com&phone=123456789&" + e.party
+		request, _ = http.NewRequest("POST", "/make-split-reservation", strings.NewReader(reqBody))
+		ctx = getConstext(request)
+		request = request.WithContext(ctx)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		session.Put(ctx, "split", split)
+		responseRecorder = httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.PostSplitReservation).ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedCode, responseRecorder.Code)
+		}
+		if location := responseRecorder.Header().Get("Location"); location != e.expectedLocation {
+			t.Errorf("%s: expected location %q but got %q", e.name, e.expectedLocation, location)
+		}
+
+		if e.name == "booked" {
+			booked, _ := session.Get(ctx, "split").(models.Booking)
+			saved, err := testDB.GetBookingByID(context.Background(), booked.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(saved.Reservations) != 2 {
+				t.Errorf("booking has %d reservations, wanted 2", len(saved.Reservations))
+			}
+		}
+	}
+}
+
+func TestRepository_PostAvailabilityFilters(t *testing.T) {
+	var tests = []struct {
+		name     string
+		filters  string
+		expected []string
+		missing  []string
+	}{
+		{"ocean view", "&amenity=1", []string{"/choose-room/1"}, []string{"/choose-room/2"}},
+		{"pet-friendly and private bathroom", "&amenity=6&amenity=2", []string{"/choose-room/2"}, []string{"/choose-room/1"}},
+		{"most to pay", "&max_price=400", []string{"/choose-room/2"}, []string{"/choose-room/1"}},
+		{"nothing matches", "&max_price=1", []string{"No rooms match these filters"}, nil},
+	}
+
+	for _, e := range tests {
+		reqBody := "start=2050-06-01&end=2050-06-05" + e.filters
+		request, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(reqBody))
+		request = request.WithContext(getConstext(request))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		responseRecorder := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.PostAvailability).ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Errorf("%s: expected %d but got %d", e.name, http.StatusOK, responseRecorder.Code)
+		}
+
+		body := responseRecorder.Body.String()
+		for _, text := range e.expected {
+			if !strings.Contains(body, text) {
+				t.Errorf("%s: expected %q in the results", e.name, text)
+			}
+		}
+		for _, text := range e.missing {
+			if strings.Contains(body, text) {
+				t.Errorf("%s: did not expect %q in the results", e.name, text)
+			}
+		}
+	}
+
+	// the cheaper Major's Suite comes first when sorting by price
+	request, _ := http.NewRequest("POST", "/search-availability",
+		strings.NewReader("start=2050-06-01&end=2050-06-05&sort=price"))
+	request = request.WithContext(getConstext(request))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	responseRecorder := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.PostAvailability).ServeHTTP(responseRecorder, request)
+
+	body := responseRecorder.Body.String()
+	cheaper, dearer := strings.Index(body, "/choose-room/2"), strings.Index(body, "/choose-room/1")
+	if cheaper < 0 || dearer < 0 || cheaper > dearer {
+		t.Error("rooms not sorted by price")
+	}
 }
 
 func TestRepository_AvailabilityJSON(t *testing.T) {
@@ -171,6 +625,158 @@ func TestRepository_AvailabilityJSON(t *testing.T) {
 	if err != nil {
 		t.Error("failed to parse json")
 	}
+
+	// second case -> the room is free on other dates
+	reqBody = "start=2050-02-01&end=2050-02-02&room_id=1"
+	req, _ = http.NewRequest("POST", "/search-availability-json", strings.NewReader(reqBody))
+	req = req.WithContext(getConstext(req))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	responseRecorder = httptest.NewRecorder()
+
+	handler.ServeHTTP(responseRecorder, req)
+
+	err = json.Unmarshal([]byte(responseRecorder.Body.String()), &j)
+	if err != nil {
+		t.Error("failed to parse json")
+	}
+	if !j.OK {
+		t.Error("room shown as unavailable when it is free")
+	}
+	if j.TotalPrice != 12000 || j.Price != "120.00" {
+		t.Errorf("expected a price of 120.00 but got %d (%s)", j.TotalPrice, j.Price)
+	}
+
+	// the same night with a seasonal rate
+	rateID, err := testDB.InsertRoomRate(context.Background(), models.RoomRate{
+		RoomID:      1,
+		Name:        "Winter",
+		StartDate:   time.Date(2050, 1, 15, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2050, 3, 1, 0, 0, 0, 0, time.UTC),
+		NightlyRate: 9000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeleteRoomRate(context.Background(), rateID)
+
+	req, _ = http.NewRequest("POST", "/search-availability-json", strings.NewReader(reqBody))
+	req = req.WithContext(getConstext(req))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	responseRecorder = httptest.NewRecorder()
+
+	handler.ServeHTTP(responseRecorder, req)
+
+	j = jsonResponse{}
+	err = json.Unmarshal([]byte(responseRecorder.Body.String()), &j)
+	if err != nil {
+		t.Error("failed to parse json")
+	}
+	if j.TotalPrice != 9000 {
+		t.Errorf("expected the seasonal price of 9000 but got %d", j.TotalPrice)
+	}
+
+	// third case -> the database fails
+	testDB.FailOn("SearchAvailabilityByDatesByRoomID", errors.New("connection reset"))
+	defer testDB.ClearFailures()
+
+	req, _ = http.NewRequest("POST", "/search-availability-json", strings.NewReader(reqBody))
+	req = req.WithContext(getConstext(req))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	responseRecorder = httptest.NewRecorder()
+
+	handler.ServeHTTP(responseRecorder, req)
+
+	err = json.Unmarshal([]byte(responseRecorder.Body.String()), &j)
+	if err != nil {
+		t.Error("failed to parse json")
+	}
+	if j.OK || j.Message == "" {
+		t.Error("database error not reported in json")
+	}
+}
+
+func TestRepository_AvailabilityGridJSON(t *testing.T) {
+	// the General's Quarters is taken on the 10th and 11th, the Major's Suite on the 11th and 12th
+	for _, stay := range []struct{ roomID, start, end int }{{1, 10, 12}, {2, 11, 13}} {
+		_, err := testDB.InsertReservationWithRestriction(context.Background(), models.Reservation{
+			FirstName: "John",
+			LastName:  "Smith",
+			Email:     "john@smith.com",
+			StartDate: time.Date(2050, 11, stay.start, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 11, stay.end, 0, 0, 0, 0, time.UTC),
+			RoomID:    stay.roomID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tests = []struct {
+		name        string
+		query       string
+		ok          bool
+		rooms       int
+		unavailable []string
+	}{
+		{"all rooms", "?month=2050-11", true, 2, []string{"2050-11-11"}},
+		{"one room", "?month=2050-11&room_id=1", true, 1, []string{"2050-11-10", "2050-11-11"}},
+		{"bad month", "?month=november", false, 0, nil},
+		{"unknown room", "?month=2050-11&room_id=100", false, 0, nil},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/availability-grid-json"+e.query, nil)
+		req = req.WithContext(getConstext(req))
+		responseRecorder := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AvailabilityGridJSON).ServeHTTP(responseRecorder, req)
+
+		var j gridResponse
+		err := json.Unmarshal(responseRecorder.Body.Bytes(), &j)
+		if err != nil {
+			t.Fatalf("%s: failed to parse json", e.name)
+		}
+		if j.OK != e.ok {
+			t.Errorf("%s: expected ok to be %t but got %t", e.name, e.ok, j.OK)
+		}
+		if len(j.Rooms) != e.rooms {
+			t.Errorf("%s: expected %d rooms but got %d", e.name, e.rooms, len(j.Rooms))
+			continue
+		}
+		if !e.ok {
+			continue
+		}
+
+		if len(j.Rooms[0].Days) != 30 {
+			t.Errorf("%s: expected 30 nights but got %d", e.name, len(j.Rooms[0].Days))
+		}
+		unavailable := j.Unavailable
+		if e.rooms == 1 {
+			unavailable = j.Rooms[0].Unavailable
+		}
+		if strings.Join(unavailable, ",") != strings.Join(e.unavailable, ",") {
+			t.Errorf("%s: expected %v unavailable but got %v", e.name, e.unavailable, unavailable)
+		}
+	}
+
+	// the database fails
+	testDB.FailOn("GetRestrictionsForAllRooms", errors.New("connection reset"))
+	defer testDB.ClearFailures()
+
+	req, _ := http.NewRequest("GET", "/availability-grid-json?month=2050-11", nil)
+	req = req.WithContext(getConstext(req))
+	responseRecorder := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.AvailabilityGridJSON).ServeHTTP(responseRecorder, req)
+
+	var j gridResponse
+	err := json.Unmarshal(responseRecorder.Body.Bytes(), &j)
+	if err != nil {
+		t.Fatal("failed to parse json")
+	}
+	if j.OK {
+		t.Error("grid is ok when the database fails")
+	}
 }
 
 func getConstext(request *http.Request) context.Context {
@@ -181,3 +787,1030 @@ func getConstext(request *http.Request) context.Context {
 
 	return ctx
 }
+
+func TestRepository_AdminPostRoom(t *testing.T) {
+	var tests = []struct {
+		name             string
+		id               string
+		reqBody          string
+		expectedCode     int
+		expectedLocation string
+	}{
+		{"new room", "0", "room_name=Colonel's Cabin&slug=colonels-cabin&nightly_rate=80&max_occupancy=2&active=1&images=/static/images/a.png", http.StatusSeeOther, "/admin/rooms"},
+		{"missing name", "0", "room_name=&slug=captains-cabin", http.StatusOK, ""},
+		{"invalid slug", "0", "room_name=Captain's Cabin&slug=Captains Cabin", http.StatusOK, ""},
+		{"slug taken", "0", "room_name=Captain's Cabin&slug=majors-suite&nightly_rate=80", http.StatusOK, ""},
+		{"invalid rate", "0", "room_name=Captain's Cabin&slug=captains-cabin&nightly_rate=eighty", http.StatusOK, ""},
+		{"no occupancy", "0", "room_name=Captain's Cabin&slug=captains-cabin&nightly_rate=80&max_occupancy=0", http.StatusOK, ""},
+		{"edit room", "2", "room_name=Major's Suite&slug=majors-suite&nightly_rate=95.00&max_occupancy=4&active=1", http.StatusSeeOther, "/admin/rooms"},
+	}
+
+	for _, e := range tests {
+		request, _ := http.NewRequest("POST", "/admin/rooms/"+e.id, strings.NewReader(e.reqBody))
+		request = request.WithContext(withURLParams(getConstext(request), map[string]string{"id": e.id}))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		responseRecorder := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminPostRoom).ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedCode, responseRecorder.Code)
+		}
+
+		if location := responseRecorder.Header().Get("Location"); location != e.expectedLocation {
+			t.Errorf("%s: expected redirect to %q but got %q", e.name, e.expectedLocation, location)
+		}
+	}
+}
+
+func TestRepository_AdminDeleteRoom(t *testing.T) {
+	id, err := testDB.InsertRoom(context.Background(), models.Room{RoomName: "Booked Room", Slug: "booked-room", Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = testDB.InsertReservationWithRestriction(context.Background(), models.Reservation{
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@smith.com",
+		StartDate: time.Date(2050, 8, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 8, 2, 0, 0, 0, 0, time.UTC),
+		RoomID:    id,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request, _ := http.NewRequest("GET", fmt.Sprintf("/admin/delete-room/%d/do", id), nil)
+	ctx := getConstext(request)
+	request = request.WithContext(withURLParams(ctx, map[string]string{"id": fmt.Sprint(id)}))
+	responseRecorder := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.AdminDeleteRoom).ServeHTTP(responseRecorder, request)
+
+	if responseRecorder.Code != http.StatusSeeOther {
+		t.Errorf("AdminDeleteRoom returned %d, wanted %d", responseRecorder.Code, http.StatusSeeOther)
+	}
+
+	if session.GetString(ctx, "error") == "" {
+		t.Error("no error shown when deleting a room with future reservations")
+	}
+
+	if _, err := testDB.GetRoomByID(context.Background(), id); err != nil {
+		t.Error("room with future reservations was deleted")
+	}
+}
+
+// withURLParams adds chi url parameters to a context, as the router does
+func withURLParams(ctx context.Context, params map[string]string) context.Context {
+	routeContext := chi.NewRouteContext()
+	for key, value := range params {
+		routeContext.URLParams.Add(key, value)
+	}
+
+	return context.WithValue(ctx, chi.RouteCtxKey, routeContext)
+}
+
+func TestRepository_AdminPostRoomRate(t *testing.T) {
+	var tests = []struct {
+		name         string
+		reqBody      string
+		expectedCode int
+	}{
+		{"valid rate", "name=Summer&start_date=2051-06-15&end_date=2051-09-15&nightly_rate=150&weekend_rate=", http.StatusSeeOther},
+		{"missing name", "name=&start_date=2051-06-15&end_date=2051-09-15&nightly_rate=150", http.StatusOK},
+		{"ends before it starts", "name=Summer&start_date=2051-09-15&end_date=2051-06-15&nightly_rate=150", http.StatusOK},
+		{"invalid date", "name=Summer&start_date=15/06/2051&end_date=2051-09-15&nightly_rate=150", http.StatusOK},
+		{"invalid weekend rate", "name=Summer&start_date=2051-06-15&end_date=2051-09-15&nightly_rate=150&weekend_rate=x", http.StatusOK},
+	}
+
+	for _, e := range tests {
+		request, _ := http.NewRequest("POST", "/admin/rooms/2/rates", strings.NewReader(e.reqBody))
+		request = request.WithContext(withURLParams(getConstext(request), map[string]string{"id": "2"}))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		responseRecorder := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminPostRoomRate).ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedCode, responseRecorder.Code)
+		}
+	}
+
+	rates, _ := testDB.AllRoomRates(context.Background(), 2)
+	if len(rates) != 1 || rates[0].NightlyRate != 15000 {
+		t.Errorf("expected one summer rate for room 2 but got %+v", rates)
+	}
+}
+
+func TestRepository_AdminPostRoomUnit(t *testing.T) {
+	roomID, err := testDB.InsertRoom(context.Background(), models.Room{RoomName: "Doubles", Slug: "doubles", Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name         string
+		reqBody      string
+		expectedCode int
+	}{
+		{"numbered units", "name=Double&quantity=3", http.StatusSeeOther},
+		{"missing name", "name=&quantity=1", http.StatusOK},
+		{"too many", "name=Double&quantity=51", http.StatusOK},
+		{"invalid quantity", "name=Double&quantity=x", http.StatusOK},
+	}
+
+	for _, e := range tests {
+		request, _ := http.NewRequest("POST", fmt.Sprintf("/admin/rooms/%d/units", roomID), strings.NewReader(e.reqBody))
+		request = request.WithContext(withURLParams(getConstext(request), map[string]string{"id": strconv.Itoa(roomID)}))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		responseRecorder := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminPostRoomUnit).ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedCode, responseRecorder.Code)
+		}
+	}
+
+	units, _ := testDB.AllRoomUnits(context.Background(), roomID)
+	if len(units) != 4 || units[1].Name != "Double 1" || units[3].Name != "Double 3" {
+		t.Errorf("expected the first unit and three numbered units but got %+v", units)
+	}
+}
+
+func TestRepository_StayRules(t *testing.T) {
+	// three night minimum in every room, and no arrivals on 2050-10-10 in the General's Quarters
+	rules := []models.StayRule{
+		{RoomID: 1, Name: "Closed", StartDate: time.Date(2050, 10, 10, 0, 0, 0, 0, time.UTC),
+			EndDate: time.Date(2050, 10, 11, 0, 0, 0, 0, time.UTC), ClosedToArrival: stayrules.EveryDay},
+	}
+
+	rooms, _ := testDB.AllRooms(context.Background())
+	for _, room := range rooms {
+		rules = append(rules, models.StayRule{RoomID: room.ID, Name: "October",
+			StartDate: time.Date(2050, 10, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 11, 1, 0, 0, 0, 0, time.UTC), MinNights: 3})
+	}
+
+	for _, rule := range rules {
+		id, err := testDB.InsertStayRule(context.Background(), rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer testDB.DeleteStayRule(context.Background(), id)
+	}
+
+	var searches = []struct {
+		name             string
+		start            string
+		end              string
+		expectedCode     int
+		expectedLocation string
+	}{
+		{"long enough", "2050-10-01", "2050-10-04", http.StatusOK, ""},
+		{"too short, with alternatives in September", "2050-10-01", "2050-10-03", http.StatusOK, ""},
+		{"zero nights", "2050-10-01", "2050-10-01", http.StatusSeeOther, "/search-availability"},
+		{"reversed", "2050-10-04", "2050-10-01", http.StatusSeeOther, "/search-availability"},
+	}
+
+	for _, e := range searches {
+		reqBody := fmt.Sprintf("start=%s&end=%s", e.start, e.end)
+		request, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(reqBody))
+		request = request.WithContext(getConstext(request))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		responseRecorder := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.PostAvailability).ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != e.expectedCode {
+			t.Errorf("search %s: expected %d but got %d", e.name, e.expectedCode, responseRecorder.Code)
+		}
+		if location := responseRecorder.Header().Get("Location"); location != e.expectedLocation {
+			t.Errorf("search %s: expected redirect to %q but got %q", e.name, e.expectedLocation, location)
+		}
+	}
+
+	// the closed arrival day only hides the General's Quarters
+	request, _ := http.NewRequest("POST", "/search-availability",
+		strings.NewReader("start=2050-10-10&end=2050-10-14"))
+	request = request.WithContext(getConstext(request))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	responseRecorder := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.PostAvailability).ServeHTTP(responseRecorder, request)
+
+	if body := responseRecorder.Body.String(); strings.Contains(body, `/choose-room/1"`) ||
+		!strings.Contains(body, `/choose-room/2"`) {
+		t.Error("expected only the Major's Suite to be offered on a closed arrival day")
+	}
+
+	// checking a single room
+	req, _ := http.NewRequest("POST", "/search-availability-json",
+		strings.NewReader("start=2050-10-01&end=2050-10-02&room_id=2"))
+	req = req.WithContext(getConstext(req))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	responseRecorder = httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.AvailabilityJSON).ServeHTTP(responseRecorder, req)
+
+	var j jsonResponse
+	_ = json.Unmarshal(responseRecorder.Body.Bytes(), &j)
+	if j.OK || !strings.Contains(j.Message, "at least 3 nights") {
+		t.Errorf("expected the minimum stay in the json message but got %+v", j)
+	}
+
+	// booking straight from a room page
+	request, _ = http.NewRequest("GET", "/book-room?id=2&s=2050-10-01&e=2050-10-02", nil)
+	request = request.WithContext(getConstext(request))
+	responseRecorder = httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.BookRoom).ServeHTTP(responseRecorder, request)
+
+	if location := responseRecorder.Header().Get("Location"); location != "/search-availability" {
+		t.Errorf("BookRoom redirected to %q instead of /search-availability for a short stay", location)
+	}
+
+	// posting the reservation form
+	reqBody := "start_date=2050-10-01&end_date=2050-10-02&first_name=John&last_name=Smith&email=john@smith.com&room_id=2"
+	request, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
+	request = request.WithContext(getConstext(request))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	responseRecorder = httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.PostReservation).ServeHTTP(responseRecorder, request)
+
+	if location := responseRecorder.Header().Get("Location"); location != "/search-availability" {
+		t.Errorf("PostReservation redirected to %q instead of /search-availability for a short stay", location)
+	}
+}
+
+func TestRepository_AdminPostStayRule(t *testing.T) {
+	var tests = []struct {
+		name         string
+		reqBody      string
+		expectedCode int
+	}{
+		{"minimum stay", "name=August&start_date=2051-08-01&end_date=2051-09-01&min_nights=3", http.StatusSeeOther},
+		{"no sunday arrivals", "name=Sundays&start_date=2051-01-01&end_date=2052-01-01&arrival_days=0", http.StatusSeeOther},
+		{"no limits", "name=Nothing&start_date=2051-08-01&end_date=2051-09-01", http.StatusOK},
+		{"max below min", "name=August&start_date=2051-08-01&end_date=2051-09-01&min_nights=5&max_nights=3", http.StatusOK},
+		{"invalid nights", "name=August&start_date=2051-08-01&end_date=2051-09-01&min_nights=three", http.StatusOK},
+		{"ends before it starts", "name=August&start_date=2051-09-01&end_date=2051-08-01&min_nights=3", http.StatusOK},
+	}
+
+	for _, e := range tests {
+		request, _ := http.NewRequest("POST", "/admin/rooms/2/rules", strings.NewReader(e.reqBody))
+		request = request.WithContext(withURLParams(getConstext(request), map[string]string{"id": "2"}))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		responseRecorder := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminPostStayRule).ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedCode, responseRecorder.Code)
+		}
+	}
+
+	rules, _ := testDB.AllStayRules(context.Background(), 2)
+	if len(rules) != 2 || rules[0].ClosedToArrival != 1 || rules[1].MinNights != 3 {
+		t.Errorf("unexpected stay rules for room 2: %+v", rules)
+	}
+
+	for _, rule := range rules {
+		_ = testDB.DeleteStayRule(context.Background(), rule.ID)
+	}
+}
+
+func TestRepository_AdminPostBlockRoom(t *testing.T) {
+	var tests = []struct {
+		name         string
+		reqBody      string
+		expectedCode int
+	}{
+		{"maintenance", "y=2052&m=06&room_id=2&restriction_id=3&start_date=2052-06-10&end_date=2052-06-14&reason=Repainting", http.StatusSeeOther},
+		{"overlapping block", "y=2052&m=06&room_id=2&restriction_id=4&start_date=2052-06-13&end_date=2052-06-15", http.StatusOK},
+		{"reservation type", "y=2052&m=06&room_id=2&restriction_id=1&start_date=2052-06-20&end_date=2052-06-21", http.StatusOK},
+		{"unknown room", "y=2052&m=06&room_id=100&restriction_id=3&start_date=2052-06-20&end_date=2052-06-21", http.StatusOK},
+		{"ends before it starts", "y=2052&m=06&room_id=2&restriction_id=3&start_date=2052-06-21&end_date=2052-06-20", http.StatusOK},
+		{"missing dates", "y=2052&m=06&room_id=2&restriction_id=3", http.StatusOK},
+	}
+
+	for _, e := range tests {
+		request, _ := http.NewRequest("POST", "/admin/block-room", strings.NewReader(e.reqBody))
+		request = request.WithContext(getConstext(request))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		responseRecorder := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminPostBlockRoom).ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedCode, responseRecorder.Code)
+		}
+	}
+
+	start := time.Date(2052, 6, 1, 0, 0, 0, 0, time.UTC)
+	blocks, _ := testDB.GetRestrictions(context.Background(), 2, start, start.AddDate(0, 1, -1))
+	if len(blocks) != 1 || blocks[0].Reason != "Repainting" || blocks[0].EndDate.Day() != 14 {
+		t.Fatalf("expected one maintenance block but got %+v", blocks)
+	}
+
+	// every night of the block is shown on the units calendar with its type and reason
+	request, _ := http.NewRequest("GET", "/admin/reservations-calendar?y=2052&m=06&view=units", nil)
+	request = request.WithContext(getConstext(request))
+	responseRecorder := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.AdminCalendarReservations).ServeHTTP(responseRecorder, request)
+
+	body := responseRecorder.Body.String()
+	if n := strings.Count(body, `title="Maintenance: Repainting"`); n != 4 {
+		t.Errorf("expected four blocked nights on the calendar but found %d", n)
+	}
+	if !strings.Contains(body, "background-color: #0dcaf0") {
+		t.Error("blocked nights are not shown in the colour of their restriction type")
+	}
+
+	_ = testDB.DeleteBlockByID(context.Background(), blocks[0].ID)
+}
+
+func TestRepository_AdminPostRestriction(t *testing.T) {
+	var tests = []struct {
+		name         string
+		id           string
+		reqBody      string
+		expectedCode int
+	}{
+		{"new type", "0", "restriction_name=Deep Clean&colour=%23198754&counts_toward_occupancy=1", http.StatusSeeOther},
+		{"missing name", "0", "restriction_name=&colour=%23198754", http.StatusOK},
+		{"invalid colour", "0", "restriction_name=Renovation&colour=green", http.StatusOK},
+		{"name taken", "0", "restriction_name=maintenance&colour=%23198754", http.StatusOK},
+		{"edit type", "3", "restriction_name=Maintenance&colour=%230DCAF0", http.StatusSeeOther},
+	}
+
+	for _, e := range tests {
+		request, _ := http.NewRequest("POST", "/admin/restrictions/"+e.id, strings.NewReader(e.reqBody))
+		request = request.WithContext(withURLParams(getConstext(request), map[string]string{"id": e.id}))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		responseRecorder := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminPostRestriction).ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedCode, responseRecorder.Code)
+		}
+	}
+
+	restrictions, _ := testDB.AllRestrictions(context.Background())
+	added := restrictions[len(restrictions)-1]
+	if len(restrictions) != 5 || added.RestrictionName != "Deep Clean" || !added.CountsTowardOccupancy {
+		t.Errorf("unexpected restriction types %+v", restrictions)
+	}
+	if restrictions[2].Colour != "#0dcaf0" {
+		t.Errorf("expected the colour to be stored in lowercase but got %q", restrictions[2].Colour)
+	}
+
+	// the reservations type cannot be deleted, an unused type can
+	for _, e := range []struct {
+		id      int
+		deleted bool
+	}{{1, false}, {added.ID, true}} {
+		request, _ := http.NewRequest("GET", fmt.Sprintf("/admin/delete-restriction/%d/do", e.id), nil)
+		ctx := getConstext(request)
+		request = request.WithContext(withURLParams(ctx, map[string]string{"id": fmt.Sprint(e.id)}))
+		responseRecorder := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminDeleteRestriction).ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != http.StatusSeeOther {
+			t.Errorf("AdminDeleteRestriction returned %d, wanted %d", responseRecorder.Code, http.StatusSeeOther)
+		}
+
+		_, err := testDB.GetRestrictionByID(context.Background(), e.id)
+		if deleted := err != nil; deleted != e.deleted {
+			t.Errorf("restriction type %d: expected deleted to be %t", e.id, e.deleted)
+		}
+		if !e.deleted && session.GetString(ctx, "error") == "" {
+			t.Errorf("no error shown when deleting restriction type %d", e.id)
+		}
+	}
+}
+
+func TestRepository_API(t *testing.T) {
+	serve := func(method, target, body string, handler http.HandlerFunc, params map[string]string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, target, strings.NewReader(body))
+		request = request.WithContext(withURLParams(request.Context(), params))
+		responseRecorder := httptest.NewRecorder()
+		handler.ServeHTTP(responseRecorder, request)
+
+		// every response must be the one the OpenAPI document describes
+		err := apiDocument.ValidateResponse(method, request.URL.Path, responseRecorder.Code,
+			responseRecorder.Body.Bytes())
+		if err != nil {
+			t.Errorf("response does not match the document: %v", err)
+		}
+		return responseRecorder
+	}
+
+	// rooms
+	responseRecorder := serve("GET", "/api/v1/rooms", "", Repo.APIRooms, nil)
+	var rooms []apiRoom
+	if err := json.Unmarshal(responseRecorder.Body.Bytes(), &rooms); err != nil {
+		t.Fatal("failed to parse json")
+	}
+	all, _ := testDB.AllRooms(context.Background())
+	active := 0
+	for _, room := range all {
+		if room.Active {
+			active++
+		}
+	}
+	if responseRecorder.Code != http.StatusOK || len(rooms) != active {
+		t.Errorf("rooms returned %d with %d rooms, wanted %d with %d", responseRecorder.Code, len(rooms),
+			http.StatusOK, active)
+	}
+
+	var roomTests = []struct {
+		id           string
+		expectedCode int
+	}{
+		{"1", http.StatusOK},
+		{"100", http.StatusNotFound},
+		{"general", http.StatusNotFound},
+	}
+	for _, e := range roomTests {
+		responseRecorder = serve("GET", "/api/v1/rooms/"+e.id, "", Repo.APIRoom, map[string]string{"id": e.id})
+		if responseRecorder.Code != e.expectedCode {
+			t.Errorf("room %s returned %d, wanted %d", e.id, responseRecorder.Code, e.expectedCode)
+		}
+	}
+
+	// availability
+	var availabilityTests = []struct {
+		name         string
+		query        string
+		expectedCode int
+		generals     bool // whether the General's Quarters, which sleeps 2, is available
+	}{
+		{"couple", "?start=2050-12-01&end=2050-12-03", http.StatusOK, true},
+		{"big party", "?start=2050-12-01&end=2050-12-03&adults=3", http.StatusOK, false},
+		{"missing dates", "?start=2050-12-01", http.StatusUnprocessableEntity, false},
+		{"departure first", "?start=2050-12-03&end=2050-12-01", http.StatusUnprocessableEntity, false},
+		{"past arrival", "?start=2020-12-01&end=2020-12-03", http.StatusUnprocessableEntity, false},
+		{"too long", "?start=2050-12-01&end=2051-01-01", http.StatusUnprocessableEntity, false},
+	}
+	for _, e := range availabilityTests {
+		responseRecorder = serve("GET", "/api/v1/availability"+e.query, "", Repo.APIAvailability, nil)
+		if responseRecorder.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedCode, responseRecorder.Code)
+			continue
+		}
+		if e.expectedCode != http.StatusOK {
+			continue
+		}
+		var available []apiAvailableRoom
+		if err := json.Unmarshal(responseRecorder.Body.Bytes(), &available); err != nil {
+			t.Fatalf("%s: failed to parse json", e.name)
+		}
+		generals := false
+		for _, room := range available {
+			if room.ID == 1 {
+				generals = true
+			}
+			if room.TotalPrice == 0 {
+				t.Errorf("%s: %s has no price", e.name, room.Name)
+			}
+		}
+		if generals != e.generals {
+			t.Errorf("%s: expected the General's Quarters available to be %t", e.name, e.generals)
+		}
+	}
+
+	// reservations
+	valid := `{"room_id": 1, "start_date": "2050-12-01", "end_date": "2050-12-03", "first_name": "John",
+		"last_name": "Smith", "email": "john@smith.com", "adults": 2}`
+	var reservationTests = []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{"booked", valid, http.StatusCreated},
+		{"taken", valid, http.StatusConflict},
+		{"not json", "first_name=John", http.StatusBadRequest},
+		{"unknown field", `{"room_id": 1, "total_price": 1, "discount": 10}`, http.StatusBadRequest},
+		{"invalid", `{"room_id": 1, "start_date": "2050-12-05", "end_date": "2050-12-06", "email": "john"}`,
+			http.StatusUnprocessableEntity},
+		{"too many guests", strings.Replace(valid, `"adults": 2`, `"adults": 3`, 1), http.StatusUnprocessableEntity},
+		{"unknown room", strings.Replace(valid, `"room_id": 1`, `"room_id": 100`, 1), http.StatusUnprocessableEntity},
+		{"past arrival", strings.Replace(strings.Replace(valid, "2050-12-01", "2020-12-01", 1), "2050-12-03",
+			"2020-12-03", 1), http.StatusUnprocessableEntity},
+		{"too long", strings.Replace(valid, "2050-12-03", "2051-01-01", 1), http.StatusUnprocessableEntity},
+	}
+
+	var booked apiReservation
+	for _, e := range reservationTests {
+		responseRecorder = serve("POST", "/api/v1/reservations", e.body, Repo.APIPostReservation, nil)
+		if responseRecorder.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedCode, responseRecorder.Code)
+		}
+		if e.name == "booked" {
+			if err := json.Unmarshal(responseRecorder.Body.Bytes(), &booked); err != nil {
+				t.Fatal("failed to parse json")
+			}
+			if booked.ID == 0 || booked.TotalPrice == 0 {
+				t.Errorf("unexpected reservation %+v", booked)
+			}
+		}
+		if e.name == "invalid" {
+			var apiErr apiError
+			if err := json.Unmarshal(responseRecorder.Body.Bytes(), &apiErr); err != nil {
+				t.Fatal("failed to parse json")
+			}
+			if len(apiErr.Fields["email"]) == 0 || len(apiErr.Fields["first_name"]) == 0 {
+				t.Errorf("invalid fields missing from %+v", apiErr)
+			}
+		}
+		if e.name == "past arrival" || e.name == "too long" {
+			var apiErr apiError
+			if err := json.Unmarshal(responseRecorder.Body.Bytes(), &apiErr); err != nil {
+				t.Fatal("failed to parse json")
+			}
+			field := map[string]string{"past arrival": "start_date", "too long": "end_date"}[e.name]
+			if len(apiErr.Fields[field]) == 0 {
+				t.Errorf("%s: %s missing from %+v", e.name, field, apiErr)
+			}
+		}
+	}
+
+	id := strconv.Itoa(booked.ID)
+	params := map[string]string{"id": id}
+
+	responseRecorder = serve("GET", "/api/v1/reservations/"+id, "", Repo.APIReservation, params)
+	if responseRecorder.Code != http.StatusOK {
+		t.Errorf("reservation returned %d, wanted %d", responseRecorder.Code, http.StatusOK)
+	}
+
+	responseRecorder = serve("DELETE", "/api/v1/reservations/"+id, "", Repo.APIDeleteReservation, params)
+	if responseRecorder.Code != http.StatusNoContent {
+		t.Errorf("cancelling returned %d, wanted %d", responseRecorder.Code, http.StatusNoContent)
+	}
+
+	for _, handler := range []http.HandlerFunc{Repo.APIReservation, Repo.APIDeleteReservation} {
+		responseRecorder = serve("GET", "/api/v1/reservations/"+id, "", handler, params)
+		if responseRecorder.Code != http.StatusNotFound {
+			t.Errorf("cancelled reservation returned %d, wanted %d", responseRecorder.Code, http.StatusNotFound)
+		}
+	}
+
+	// the database fails
+	testDB.FailOn("AllRooms", errors.New("connection reset"))
+	defer testDB.ClearFailures()
+
+	responseRecorder = serve("GET", "/api/v1/rooms", "", Repo.APIRooms, nil)
+	if responseRecorder.Code != http.StatusInternalServerError {
+		t.Errorf("rooms returned %d when the database fails, wanted %d", responseRecorder.Code,
+			http.StatusInternalServerError)
+	}
+}
+
+func TestRepository_AdminPostAPIKey(t *testing.T) {
+	var tests = []struct {
+		name    string
+		reqBody string
+		created bool
+	}{
+		{"read key", "name=Channel+manager&scope=read", true},
+		{"missing name", "name=&scope=write", false},
+		{"unknown scope", "name=Script&scope=admin", false},
+	}
+
+	for _, e := range tests {
+		request, _ := http.NewRequest("POST", "/admin/api-keys", strings.NewReader(e.reqBody))
+		request = request.WithContext(getConstext(request))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		responseRecorder := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminPostAPIKey).ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Errorf("%s: expected %d but got %d", e.name, http.StatusOK, responseRecorder.Code)
+		}
+		if created := strings.Contains(responseRecorder.Body.String(), `<code id="new-key">`); created != e.created {
+			t.Errorf("%s: expected a new key shown to be %t", e.name, e.created)
+		}
+	}
+
+	keys, _ := testDB.AllAPIKeys(context.Background())
+	if len(keys) != 1 || keys[0].Name != "Channel manager" || keys[0].Scope != "read" {
+		t.Fatalf("expected one read key but got %+v", keys)
+	}
+
+	request, _ := http.NewRequest("POST", fmt.Sprintf("/admin/revoke-api-key/%d/do", keys[0].ID), nil)
+	request = request.WithContext(withURLParams(getConstext(request), map[string]string{"id": strconv.Itoa(keys[0].ID)}))
+	responseRecorder := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.AdminRevokeAPIKey).ServeHTTP(responseRecorder, request)
+
+	if responseRecorder.Code != http.StatusSeeOther {
+		t.Errorf("revoking returned %d, wanted %d", responseRecorder.Code, http.StatusSeeOther)
+	}
+	keys, _ = testDB.AllAPIKeys(context.Background())
+	if keys[0].RevokedAt.IsZero() {
+		t.Error("key was not revoked")
+	}
+}
+
+func TestRepository_AdminPostWebhook(t *testing.T) {
+	var tests = []struct {
+		name    string
+		reqBody string
+		created bool
+	}{
+		{"all events", "url=https://channel.example.com/hooks&event=reservation.created&event=reservation.updated" +
+			"&event=reservation.processed&event=reservation.deleted", true},
+		{"missing url", "url=&event=reservation.created", false},
+		{"not a url", "url=channel.example.com&event=reservation.created", false},
+		{"no events", "url=https://channel.example.com/hooks", false},
+		{"unknown event", "url=https://channel.example.com/hooks&event=room.created", false},
+	}
+
+	for _, e := range tests {
+		request, _ := http.NewRequest("POST", "/admin/webhooks", strings.NewReader(e.reqBody))
+		request = request.WithContext(getConstext(request))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		responseRecorder := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.AdminPostWebhook).ServeHTTP(responseRecorder, request)
+
+		if responseRecorder.Code != http.StatusOK {
+			t.Errorf("%s: expected %d but got %d", e.name, http.StatusOK, responseRecorder.Code)
+		}
+		if created := strings.Contains(responseRecorder.Body.String(), `<code id="new-secret">`); created != e.created {
+			t.Errorf("%s: expected a new secret shown to be %t", e.name, e.created)
+		}
+	}
+
+	hooks, _ := testDB.AllWebhooks(context.Background())
+	if len(hooks) != 1 || hooks[0].URL != "https://channel.example.com/hooks" || len(hooks[0].Events) != 4 {
+		t.Fatalf("expected one webhook for every event but got %+v", hooks)
+	}
+
+	request, _ := http.NewRequest("POST", fmt.Sprintf("/admin/delete-webhook/%d/do", hooks[0].ID), nil)
+	request = request.WithContext(withURLParams(getConstext(request), map[string]string{"id": strconv.Itoa(hooks[0].ID)}))
+	responseRecorder := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.AdminDeleteWebhook).ServeHTTP(responseRecorder, request)
+
+	if responseRecorder.Code != http.StatusSeeOther {
+		t.Errorf("deleting returned %d, wanted %d", responseRecorder.Code, http.StatusSeeOther)
+	}
+	hooks, _ = testDB.AllWebhooks(context.Background())
+	if len(hooks) != 0 {
+		t.Error("webhook was not deleted")
+	}
+}
+
+func TestRepository_ReservationWebhooks(t *testing.T) {
+	ctx := context.Background()
+
+	var received []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r)
+	}))
+	defer server.Close()
+
+	hookID, err := testDB.InsertWebhook(ctx, models.Webhook{
+		URL:    server.URL,
+		Secret: "whsec_test",
+		Events: webhooks.Events,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.DeleteWebhook(ctx, hookID)
+
+	id, err := testDB.InsertReservationWithRestriction(ctx, models.Reservation{
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@smith.com",
+		StartDate: time.Date(2050, 3, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 3, 3, 0, 0, 0, 0, time.UTC),
+		RoomID:    1,
+		Adults:    1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]string{"id": strconv.Itoa(id), "src": "all"}
+
+	// updated
+	reqBody := "first_name=Jane&last_name=Smith&email=jane@smith.com&phone=555"
+	request, _ := http.NewRequest("POST", fmt.Sprintf("/admin/reservations/all/%d", id), strings.NewReader(reqBody))
+	request.RequestURI = fmt.Sprintf("/admin/reservations/all/%d", id)
+	request = request.WithContext(getConstext(request))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	http.HandlerFunc(Repo.AdminPostShowReservation).ServeHTTP(httptest.NewRecorder(), request)
+
+	// processed
+	request, _ = http.NewRequest("GET", fmt.Sprintf("/admin/process-reservation/all/%d/do", id), nil)
+	request = request.WithContext(withURLParams(getConstext(request), params))
+	http.HandlerFunc(Repo.AdminProcessReservation).ServeHTTP(httptest.NewRecorder(), request)
+
+	// deleted
+	request, _ = http.NewRequest("GET", fmt.Sprintf("/admin/delete-reservation/all/%d/do", id), nil)
+	request = request.WithContext(withURLParams(getConstext(request), params))
+	http.HandlerFunc(Repo.AdminDeleteReservation).ServeHTTP(httptest.NewRecorder(), request)
+
+	deliveries, _ := testDB.RecentWebhookDeliveries(ctx, 10)
+	var events []string
+	for _, d := range deliveries {
+		if d.WebhookID != hookID {
+			continue
+		}
+		events = append(events, d.Event)
+
+		var payload webhookPayload
+		if err := json.Unmarshal([]byte(d.Payload), &payload); err != nil {
+			t.Fatal("failed to parse json")
+		}
+		if payload.Event != d.Event || payload.Reservation.ID != id || payload.Reservation.FirstName != "Jane" {
+			t.Errorf("unexpected payload %s", d.Payload)
+		}
+	}
+	if strings.Join(events, ",") != "reservation.deleted,reservation.processed,reservation.updated" {
+		t.Fatalf("expected the deleted, processed and updated events but got %v", events)
+	}
+
+	// the sender posts them, signed
+	sent, err := webhooks.NewSender(testDB, app.ErrorLog).DeliverDue(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != 3 || len(received) != 3 {
+		t.Fatalf("expected 3 deliveries sent but sent %d and received %d", sent, len(received))
+	}
+	if received[0].Header.Get("X-Bookings-Event") != "reservation.updated" ||
+		!strings.HasPrefix(received[0].Header.Get("X-Bookings-Signature"), "sha256=") {
+		t.Errorf("unexpected request %v", received[0].Header)
+	}
+
+	// and the delivery log shows how they went
+	request, _ = http.NewRequest("GET", "/admin/webhook-deliveries", nil)
+	request = request.WithContext(getConstext(request))
+	responseRecorder := httptest.NewRecorder()
+
+	http.HandlerFunc(Repo.AdminWebhookDeliveries).ServeHTTP(responseRecorder, request)
+
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("AdminWebhookDeliveries returned %d, wanted %d", responseRecorder.Code, http.StatusOK)
+	}
+	if !strings.Contains(responseRecorder.Body.String(), "reservation.processed") ||
+		!strings.Contains(responseRecorder.Body.String(), "Delivered") {
+		t.Error("the delivery log does not show the deliveries")
+	}
+}
+
+func TestRepository_APIOpenAPI(t *testing.T) {
+	request, _ := http.NewRequest("GET", "/api/openapi.json", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.APIOpenAPI)
+	handler.ServeHTTP(responseRecorder, request)
+
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("APIOpenAPI returned %d, wanted %d", responseRecorder.Code, http.StatusOK)
+	}
+
+	var document struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(responseRecorder.Body.Bytes(), &document); err != nil {
+		t.Fatal("failed to parse json")
+	}
+	if !strings.HasPrefix(document.OpenAPI, "3.") || len(document.Paths) != len(apiDocument.Paths) {
+		t.Errorf("unexpected document %s", responseRecorder.Body.String())
+	}
+}
+
+func TestRepository_AdminUsers(t *testing.T) {
+	ctx := context.Background()
+
+	ownerID, err := testDB.AddUser(models.User{
+		FirstName: "Olivia", LastName: "Owner", Email: "olivia@users.example.com", AccessLevel: 4,
+	}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner, _ := testDB.GetUserByID(ctx, ownerID)
+
+	// serve runs a handler as the owner
+	serve := func(handler http.HandlerFunc, method, reqBody string, params map[string]string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, "/admin/users", strings.NewReader(reqBody))
+		request = request.WithContext(access.WithUser(withURLParams(getConstext(request), params), owner))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		responseRecorder := httptest.NewRecorder()
+
+		handler.ServeHTTP(responseRecorder, request)
+
+		return responseRecorder
+	}
+
+	var tests = []struct {
+		name         string
+		id           int
+		reqBody      string
+		expectedCode int
+		expectedBody string
+	}{
+		{"invite", 0, "first_name=Dan&last_name=Desk&email=dan@users.example.com&access_level=2",
+			http.StatusSeeOther, ""},
+		{"missing email", 0, "first_name=Dan&last_name=Desk&email=&access_level=2", http.StatusOK, ""},
+		{"unknown role", 0, "first_name=Dan&last_name=Desk&email=daniel@users.example.com&access_level=9",
+			http.StatusOK, "Choose a role from the list"},
+		{"taken email", 0, "first_name=Dan&last_name=Desk&email=olivia@users.example.com&access_level=2",
+			http.StatusOK, "Another user already has this email"},
+		{"own role", ownerID, "first_name=Olivia&last_name=Owner&email=olivia@users.example.com&access_level=3",
+			http.StatusOK, "You cannot change your own role"},
+		{"own names", ownerID, "first_name=Liv&last_name=Owner&email=olivia@users.example.com&access_level=4",
+			http.StatusSeeOther, ""},
+	}
+
+	for _, e := range tests {
+		response := serve(Repo.AdminPostUser, "POST", e.reqBody, map[string]string{"id": strconv.Itoa(e.id)})
+
+		if response.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedCode, response.Code)
+		}
+		if e.expectedBody != "" && !strings.Contains(response.Body.String(), e.expectedBody) {
+			t.Errorf("%s: expected the page to say %q", e.name, e.expectedBody)
+		}
+	}
+
+	owner, _ = testDB.GetUserByID(ctx, ownerID)
+	if owner.FirstName != "Liv" || owner.AccessLevel != 4 {
+		t.Errorf("unexpected owner %+v", owner)
+	}
+
+	var desk models.User
+	users, _ := testDB.AllUsers(ctx)
+	for _, u := range users {
+		if u.Email == "dan@users.example.com" {
+			desk = u
+		}
+	}
+	if desk.ID == 0 || desk.AccessLevel != 2 || !desk.Active || desk.Password != "" || desk.PasswordTokenHash == "" ||
+		!desk.PasswordTokenExpiresAt.After(time.Now()) {
+		t.Fatalf("unexpected invited user %+v", desk)
+	}
+
+	// editing a user changes only them
+	response := serve(Repo.AdminPostUser, "POST",
+		"first_name=Dan&last_name=Desk&email=dan@users.example.com&access_level=3",
+		map[string]string{"id": strconv.Itoa(desk.ID)})
+	if response.Code != http.StatusSeeOther {
+		t.Errorf("editing returned %d, wanted %d", response.Code, http.StatusSeeOther)
+	}
+	desk, _ = testDB.GetUserByID(ctx, desk.ID)
+	owner, _ = testDB.GetUserByID(ctx, ownerID)
+	if desk.AccessLevel != 3 || owner.AccessLevel != 4 {
+		t.Errorf("expected a manager and an owner but got %d and %d", desk.AccessLevel, owner.AccessLevel)
+	}
+
+	for _, page := range []struct {
+		name    string
+		handler http.HandlerFunc
+		id      int
+	}{
+		{"users", Repo.AdminUsers, 0},
+		{"invite", Repo.AdminShowUser, 0},
+		{"user", Repo.AdminShowUser, desk.ID},
+		{"own user", Repo.AdminShowUser, ownerID},
+	} {
+		response := serve(page.handler, "GET", "", map[string]string{"id": strconv.Itoa(page.id)})
+		if response.Code != http.StatusOK {
+			t.Errorf("%s page returned %d, wanted %d", page.name, response.Code, http.StatusOK)
+		}
+	}
+
+	response = serve(Repo.AdminShowUser, "GET", "", map[string]string{"id": strconv.Itoa(desk.ID)})
+	if !strings.Contains(response.Body.String(), `value="3" selected`) {
+		t.Error("the user's role is not selected")
+	}
+
+	// owners cannot lock themselves out
+	serve(Repo.AdminToggleUser, "POST", "", map[string]string{"id": strconv.Itoa(ownerID)})
+	serve(Repo.AdminResetUserPassword, "POST", "", map[string]string{"id": strconv.Itoa(ownerID)})
+	owner, _ = testDB.GetUserByID(ctx, ownerID)
+	if !owner.Active || owner.Password == "" {
+		t.Errorf("the owner deactivated or reset themselves: %+v", owner)
+	}
+
+	response = serve(Repo.AdminToggleUser, "POST", "", map[string]string{"id": strconv.Itoa(desk.ID)})
+	if response.Code != http.StatusSeeOther {
+		t.Errorf("deactivating returned %d, wanted %d", response.Code, http.StatusSeeOther)
+	}
+	if desk, _ = testDB.GetUserByID(ctx, desk.ID); desk.Active {
+		t.Error("user was not deactivated")
+	}
+	serve(Repo.AdminToggleUser, "POST", "", map[string]string{"id": strconv.Itoa(desk.ID)})
+	if desk, _ = testDB.GetUserByID(ctx, desk.ID); !desk.Active {
+		t.Error("user was not activated")
+	}
+
+	managerID, err := testDB.AddUser(models.User{
+		FirstName: "Mia", LastName: "Manager", Email: "mia@users.example.com", AccessLevel: 3,
+	}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response = serve(Repo.AdminResetUserPassword, "POST", "", map[string]string{"id": strconv.Itoa(managerID)})
+	if response.Code != http.StatusSeeOther {
+		t.Errorf("resetting returned %d, wanted %d", response.Code, http.StatusSeeOther)
+	}
+	manager, _ := testDB.GetUserByID(ctx, managerID)
+	if manager.Password != "" || manager.PasswordTokenHash == "" || !manager.PasswordTokenExpiresAt.After(time.Now()) {
+		t.Errorf("password was not reset: %+v", manager)
+	}
+}
+
+func TestRepository_sendPasswordLink(t *testing.T) {
+	mail := make(chan models.MailData, 1)
+	m := &Repository{App: &config.AppConfig{BaseURL: "https://bookings.example.com", MailChan: mail}, DB: testDB}
+
+	m.sendPasswordLink(models.User{FirstName: "Dan", Email: "dan@links.example.com"}, "abc123",
+		"Set a new Bookings password", "Your Bookings password was reset by an owner.")
+
+	msg := <-mail
+	if msg.To != "dan@links.example.com" ||
+		!strings.Contains(msg.Content, `href="https://bookings.example.com/user/set-password/abc123"`) {
+		t.Errorf("the email does not link to the configured site: %+v", msg)
+	}
+}
+
+func TestRepository_SetPassword(t *testing.T) {
+	ctx := context.Background()
+
+	id, err := testDB.AddUser(models.User{
+		FirstName: "Fran", LastName: "Front", Email: "fran@users.example.com", AccessLevel: 2,
+	}, "old password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, hash, _ := access.GeneratePasswordToken()
+	if err := testDB.ResetPassword(ctx, id, hash, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(handler http.HandlerFunc, method, token, reqBody string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, "/user/set-password/"+token, strings.NewReader(reqBody))
+		request = request.WithContext(withURLParams(getConstext(request), map[string]string{"token": token}))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		responseRecorder := httptest.NewRecorder()
+
+		handler.ServeHTTP(responseRecorder, request)
+
+		return responseRecorder
+	}
+
+	if response := serve(Repo.ShowSetPassword, "GET", token, ""); response.Code != http.StatusOK {
+		t.Errorf("set password page returned %d, wanted %d", response.Code, http.StatusOK)
+	}
+	if response := serve(Repo.ShowSetPassword, "GET", "unknown", ""); response.Code != http.StatusSeeOther ||
+		response.Header().Get("Location") != "/user/login" {
+		t.Errorf("an unknown token returned %d to %s", response.Code, response.Header().Get("Location"))
+	}
+
+	var tests = []struct {
+		name         string
+		reqBody      string
+		expectedCode int
+	}{
+		{"missing confirmation", "password=new+password&password_confirm=", http.StatusOK},
+		{"too short", "password=short&password_confirm=short", http.StatusOK},
+		{"no match", "password=new+password&password_confirm=other+password", http.StatusOK},
+		{"valid", "password=new+password&password_confirm=new+password", http.StatusSeeOther},
+		{"used token", "password=new+password&password_confirm=new+password", http.StatusSeeOther},
+	}
+
+	for _, e := range tests {
+		if response := serve(Repo.PostSetPassword, "POST", token, e.reqBody); response.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedCode, response.Code)
+		}
+	}
+
+	if loggedIn, _, err := testDB.Authenticate(ctx, "fran@users.example.com", "new password"); err != nil || loggedIn != id {
+		t.Errorf("could not log in with the new password: %v", err)
+	}
+
+	// expired tokens cannot be used
+	token, hash, _ = access.GeneratePasswordToken()
+	_ = testDB.ResetPassword(ctx, id, hash, time.Now().Add(-time.Minute))
+	response := serve(Repo.PostSetPassword, "POST", token, "password=new+password&password_confirm=new+password")
+	if response.Code != http.StatusSeeOther {
+		t.Errorf("an expired token returned %d, wanted %d", response.Code, http.StatusSeeOther)
+	}
+	if user, _ := testDB.GetUserByID(ctx, id); user.Password != "" {
+		t.Error("an expired token set a password")
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/FilipeParreiras/Bookings/internal/openapi"
+	"net/http"
+)
+
+// apiDocument describes the /api/v1 routes with the types their handlers read and write
+var apiDocument = newAPIDocument()
+
+// APIDocument returns the OpenAPI document of the api
+func APIDocument() *openapi.Document {
+	return apiDocument
+}
+
+func newAPIDocument() *openapi.Document {
+	d := openapi.New("Bookings API", "1.0.0",
+		fmt.Sprintf("Rooms, availability and reservations. Dates are yyyy-mm-dd and prices are in cents. "+
+			"Stays start today or later and last up to %d nights.", maxStayNights))
+
+	d.Components.SecuritySchemes["apiKey"] = openapi.SecurityScheme{
+		Type:        "http",
+		Scheme:      "bearer",
+		Description: "An api key created by an admin. Read keys can only make GET requests.",
+	}
+	d.Security = []map[string][]string{{"apiKey": {}}}
+
+	room := d.Component("Room", apiRoom{})
+	availableRoom := d.Component("AvailableRoom", apiAvailableRoom{})
+	newReservation := d.Component("NewReservation", apiNewReservation{})
+	reservation := d.Component("Reservation", apiReservation{})
+	apiErr := d.Component("Error", apiError{})
+
+	body := func(description string, schema *openapi.Schema) openapi.Response {
+		return openapi.Response{
+			Description: description,
+			Content:     map[string]openapi.MediaType{"application/json": {Schema: schema}},
+		}
+	}
+	responses := func(ok openapi.Response, status string, codes ...string) map[string]openapi.Response {
+		r := map[string]openapi.Response{
+			status: ok,
+			"401":  body("The api key is missing, unknown or revoked", apiErr),
+			"500":  body("Internal server error", apiErr),
+		}
+		for _, e := range codes {
+			switch e {
+			case "400":
+				r[e] = body("The body is not json or has unknown fields", apiErr)
+			case "403":
+				r[e] = body("The api key can only read", apiErr)
+			case "404":
+				r[e] = body("Not found", apiErr)
+			case "409":
+				r[e] = body("The room was taken for the dates", apiErr)
+			case "422":
+				r[e] = body("Invalid parameters or body, by field", apiErr)
+			}
+		}
+		return r
+	}
+	id := openapi.Parameter{Name: "id", In: "path", Required: true, Schema: &openapi.Schema{Type: "integer"}}
+	date := func(name, description string) openapi.Parameter {
+		return openapi.Parameter{Name: name, In: "query", Required: true, Description: description,
+			Schema: &openapi.Schema{Type: "string", Format: "date"}}
+	}
+	minimum := func(n int) *int { return &n }
+
+	d.Add(http.MethodGet, "/api/v1/rooms", &openapi.Operation{
+		OperationID: "listRooms",
+		Summary:     "Lists the rooms guests can book",
+		Responses:   responses(body("The rooms, in display order", &openapi.Schema{Type: "array", Items: room}), "200"),
+	})
+
+	d.Add(http.MethodGet, "/api/v1/rooms/{id}", &openapi.Operation{
+		OperationID: "getRoom",
+		Summary:     "Shows a room",
+		Parameters:  []openapi.Parameter{id},
+		Responses:   responses(body("The room", room), "200", "404", "422"),
+	})
+
+	d.Add(http.MethodGet, "/api/v1/availability", &openapi.Operation{
+		OperationID: "searchAvailability",
+		Summary:     "Lists the rooms free for a stay, with its price",
+		Parameters: []openapi.Parameter{
+			date("start", "Arrival"),
+			date("end", "Departure"),
+			{Name: "adults", In: "query", Description: "1 when not given",
+				Schema: &openapi.Schema{Type: "integer", Minimum: minimum(1)}},
+			{Name: "children", In: "query", Schema: &openapi.Schema{Type: "integer", Minimum: minimum(0)}},
+			{Name: "amenity", In: "query", Description: "Rooms must have every amenity given",
+				Schema: &openapi.Schema{Type: "array", Items: &openapi.Schema{Type: "integer"}}},
+		},
+		Responses: responses(body("The free rooms", &openapi.Schema{Type: "array", Items: availableRoom}), "200",
+			"422"),
+	})
+
+	d.Add(http.MethodPost, "/api/v1/reservations", &openapi.Operation{
+		OperationID: "createReservation",
+		Summary:     "Books a room, priced from its rates",
+		RequestBody: &openapi.RequestBody{
+			Required: true,
+			Content:  map[string]openapi.MediaType{"application/json": {Schema: newReservation}},
+		},
+		Responses: responses(body("The reservation", reservation), "201", "400", "403", "409", "422"),
+	})
+
+	d.Add(http.MethodGet, "/api/v1/reservations/{id}", &openapi.Operation{
+		OperationID: "getReservation",
+		Summary:     "Shows a reservation",
+		Parameters:  []openapi.Parameter{id},
+		Responses:   responses(body("The reservation", reservation), "200", "404", "422"),
+	})
+
+	d.Add(http.MethodDelete, "/api/v1/reservations/{id}", &openapi.Operation{
+		OperationID: "cancelReservation",
+		Summary:     "Cancels a reservation, freeing its room",
+		Parameters:  []openapi.Parameter{id},
+		Responses:   responses(openapi.Response{Description: "Cancelled"}, "204", "403", "404", "422"),
+	})
+
+	return d
+}
+
+// APIOpenAPI sends the OpenAPI document of the api
+func (m *Repository) APIOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, apiDocument)
+}
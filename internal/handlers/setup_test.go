@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"github.com/FilipeParreiras/Bookings/internal/config"
 	"github.com/FilipeParreiras/Bookings/internal/models"
+	"github.com/FilipeParreiras/Bookings/internal/pricing"
 	"github.com/FilipeParreiras/Bookings/internal/render"
+	"github.com/FilipeParreiras/Bookings/internal/repository/dbrepo/memrepo"
+	"github.com/FilipeParreiras/Bookings/internal/stayrules"
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -21,13 +24,18 @@ import (
 
 var app config.AppConfig
 var session *scs.SessionManager
+var testDB *memrepo.Repo
 var pathToTemplates = "./../../templates"
 
 var functions = template.FuncMap{
-	"humanDate":  render.HumanDate,
-	"formatDate": render.FormatDate,
-	"iterate":    render.Iterate,
-	"add":        render.Add,
+	"humanDate":   render.HumanDate,
+	"formatDate":  render.FormatDate,
+	"iterate":     render.Iterate,
+	"add":         render.Add,
+	"formatPrice": pricing.Format,
+	"weekdays":    stayrules.DayNames,
+	"guests":      render.Guests,
+	"roleName":    render.RoleName,
 }
 
 func TestMain(m *testing.M) {
@@ -36,10 +44,12 @@ func TestMain(m *testing.M) {
 	gob.Register(models.User{})
 	gob.Register(models.Room{})
 	gob.Register(models.Restriction{})
+	gob.Register(models.Booking{})
 	gob.Register(map[string]int{})
 
 	// change this to true when in production
 	app.InProduction = false
+	app.BaseURL = "http://localhost:8080"
 
 	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	app.InfoLog = infoLog
@@ -72,12 +82,22 @@ func TestMain(m *testing.M) {
 
 	repo := NewTestRepo(&app)
 	NewHandlers(repo)
+	testDB = repo.DB.(*memrepo.Repo)
 
 	render.NewRenderer(&app)
+	render.NewMenu(repo.DB)
 
 	os.Exit(m.Run())
 }
 
+// NewTestRepo creates a new repository backed by an in-memory database
+func NewTestRepo(a *config.AppConfig) *Repository {
+	return &Repository{
+		App: a,
+		DB:  memrepo.New(a),
+	}
+}
+
 func listenForMail() {
 	go func() {
 		for {
@@ -96,12 +116,16 @@ func getRoutes() http.Handler {
 
 	mux.Get("/", Repo.Home)
 	mux.Get("/about", Repo.About)
-	mux.Get("/generals-quarters", Repo.Generals)
-	mux.Get("/majors-suite", Repo.Majors)
+	mux.Get("/rooms/{slug}", Repo.Room)
+
+	// the room pages used to live at the root
+	mux.Handle("/generals-quarters", http.RedirectHandler("/rooms/generals-quarters", http.StatusMovedPermanently))
+	mux.Handle("/majors-suite", http.RedirectHandler("/rooms/majors-suite", http.StatusMovedPermanently))
 
 	mux.Get("/search-availability", Repo.Availability)
 	mux.Post("/search-availability", Repo.PostAvailability)
 	mux.Post("/search-availability-json", Repo.AvailabilityJSON)
+	mux.Get("/availability-grid-json", Repo.AvailabilityGridJSON)
 
 	mux.Get("/contact", Repo.Contact)
 
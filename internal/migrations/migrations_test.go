@@ -0,0 +1,164 @@
+package migrations
+
+import (
+	"context"
+	"github.com/FilipeParreiras/Bookings/internal/driver"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_add_rooms.up.sql":      {Data: []byte("create table rooms (id int)")},
+		"0002_add_rooms.down.sql":    {Data: []byte("drop table rooms")},
+		"0001_add_users.up.sql":      {Data: []byte("create table users (id int)")},
+		"0001_add_users.down.sql":    {Data: []byte("drop table users")},
+		"README.md":                  {Data: []byte("not a migration")},
+		"0010_add_bookings.up.sql":   {Data: []byte("create table bookings (id int)")},
+		"0010_add_bookings.down.sql": {Data: []byte("drop table bookings")},
+	}
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrations) != 3 {
+		t.Fatalf("expected 3 migrations but got %d", len(migrations))
+	}
+
+	expected := []int{1, 2, 10}
+	for i, m := range migrations {
+		if m.Version != expected[i] {
+			t.Errorf("migration %d: expected version %d but got %d", i, expected[i], m.Version)
+		}
+	}
+
+	if migrations[0].Name != "add_users" || migrations[0].Down != "drop table users" {
+		t.Errorf("migration 1 was not read correctly: %+v", migrations[0])
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	var tests = []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{"missing down", fstest.MapFS{
+			"0001_add_users.up.sql": {Data: []byte("create table users (id int)")},
+		}},
+		{"missing up", fstest.MapFS{
+			"0001_add_users.down.sql": {Data: []byte("drop table users")},
+		}},
+		{"no version", fstest.MapFS{
+			"add_users.up.sql": {Data: []byte("create table users (id int)")},
+		}},
+		{"no direction", fstest.MapFS{
+			"0001_add_users.sql": {Data: []byte("create table users (id int)")},
+		}},
+		{"two names", fstest.MapFS{
+			"0001_add_users.up.sql":    {Data: []byte("create table users (id int)")},
+			"0001_add_people.down.sql": {Data: []byte("drop table users")},
+		}},
+	}
+
+	for _, e := range tests {
+		_, err := Load(e.fsys)
+		if err == nil {
+			t.Errorf("%s: expected an error but did not get one", e.name)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	postgres, err := New(nil, Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(postgres.Migrations) == 0 {
+		t.Error("no embedded postgres migrations found")
+	}
+
+	sqlite, err := New(nil, SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sqlite.Migrations) != len(postgres.Migrations) {
+		t.Fatalf("postgres has %d migrations but sqlite has %d", len(postgres.Migrations), len(sqlite.Migrations))
+	}
+
+	for i := range postgres.Migrations {
+		p, s := postgres.Migrations[i], sqlite.Migrations[i]
+		if p.Version != s.Version || p.Name != s.Name {
+			t.Errorf("migration %04d_%s has no sqlite counterpart (got %04d_%s)", p.Version, p.Name, s.Version, s.Name)
+		}
+	}
+
+	_, err = New(nil, "oracle")
+	if err == nil {
+		t.Error("created a migrator for an unknown dialect")
+	}
+}
+
+func TestMigrator_SQLite(t *testing.T) {
+	db, err := driver.ConnectSQLite(filepath.Join(t.TempDir(), "migrations.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL.Close()
+
+	m, err := New(db.SQL, SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(m.Migrations) {
+		t.Errorf("expected %d migrations applied but got %d", len(m.Migrations), len(applied))
+	}
+
+	applied, err = m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("up applied %d migrations a second time", len(applied))
+	}
+
+	rolledBack, err := m.Down(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rolledBack) != 1 || rolledBack[0].Version != m.Migrations[len(m.Migrations)-1].Version {
+		t.Errorf("down did not roll back the latest migration: %+v", rolledBack)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range statuses {
+		if s.Applied != (i < len(statuses)-1) {
+			t.Errorf("migration %04d_%s has the wrong status", s.Version, s.Name)
+		}
+	}
+
+	// every down file must undo its up file cleanly
+	_, err = m.Down(ctx, len(m.Migrations))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
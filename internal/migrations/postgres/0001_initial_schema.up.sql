@@ -0,0 +1,63 @@
+create table users
+(
+    id           serial primary key,
+    first_name   varchar(255) not null default '',
+    last_name    varchar(255) not null default '',
+    email        varchar(255) not null,
+    password     varchar(60)  not null,
+    access_level integer      not null default 1,
+    created_at   timestamp    not null default now(),
+    updated_at   timestamp    not null default now()
+);
+
+create unique index users_email_idx on users (email);
+
+create table rooms
+(
+    id         serial primary key,
+    room_name  varchar(255) not null,
+    created_at timestamp    not null default now(),
+    updated_at timestamp    not null default now()
+);
+
+create table restrictions
+(
+    id               serial primary key,
+    restriction_name varchar(255) not null,
+    created_at       timestamp    not null default now(),
+    updated_at       timestamp    not null default now()
+);
+
+create table reservations
+(
+    id         serial primary key,
+    first_name varchar(255) not null default '',
+    last_name  varchar(255) not null default '',
+    email      varchar(255) not null,
+    phone      varchar(255) not null default '',
+    start_date date         not null,
+    end_date   date         not null,
+    room_id    integer      not null references rooms (id) on delete cascade on update cascade,
+    processed  integer      not null default 0,
+    created_at timestamp    not null default now(),
+    updated_at timestamp    not null default now()
+);
+
+create index reservations_email_idx on reservations (email);
+create index reservations_last_name_idx on reservations (last_name);
+
+create table room_restrictions
+(
+    id             serial primary key,
+    start_date     date      not null,
+    end_date       date      not null,
+    room_id        integer   not null references rooms (id) on delete cascade on update cascade,
+    reservation_id integer references reservations (id) on delete cascade on update cascade,
+    restriction_id integer   not null references restrictions (id) on delete cascade on update cascade,
+    created_at     timestamp not null default now(),
+    updated_at     timestamp not null default now()
+);
+
+create index room_restrictions_start_date_end_date_idx on room_restrictions (start_date, end_date);
+create index room_restrictions_room_id_idx on room_restrictions (room_id);
+create index room_restrictions_reservation_id_idx on room_restrictions (reservation_id);
@@ -0,0 +1,11 @@
+insert into restrictions (id, restriction_name)
+values (1, 'Reservation'),
+       (2, 'Owner Block');
+
+select setval('restrictions_id_seq', (select max(id) from restrictions));
+
+insert into rooms (id, room_name)
+values (1, 'General''s Quarters'),
+       (2, 'Major''s Suite');
+
+select setval('rooms_id_seq', (select max(id) from rooms));
@@ -0,0 +1,8 @@
+-- btree_gist lets the exclusion constraint compare room_id with = inside a gist index
+create extension if not exists btree_gist;
+
+-- a room can never have two restrictions (reservations or blocks) covering the same night;
+-- daterange is half open, so a stay may start on the day the previous one ends
+alter table room_restrictions
+    add constraint room_restrictions_no_overlap
+        exclude using gist (room_id with =, daterange(start_date, end_date) with &&);
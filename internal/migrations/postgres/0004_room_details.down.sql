@@ -0,0 +1,8 @@
+drop table if exists room_images;
+
+drop index if exists rooms_slug_idx;
+
+alter table rooms drop column active;
+alter table rooms drop column sort_order;
+alter table rooms drop column description;
+alter table rooms drop column slug;
@@ -0,0 +1,3 @@
+drop table if exists room_amenities;
+
+drop table if exists amenities;
@@ -0,0 +1,16 @@
+alter table rooms add column weekend_rate integer not null default 0;
+
+create table room_rates
+(
+    id           serial primary key,
+    room_id      integer      not null references rooms (id) on delete cascade on update cascade,
+    name         varchar(255) not null,
+    start_date   date         not null,
+    end_date     date         not null,
+    nightly_rate integer      not null,
+    weekend_rate integer      not null default 0,
+    created_at   timestamp    not null default now(),
+    updated_at   timestamp    not null default now()
+);
+
+create index room_rates_room_id_start_date_end_date_idx on room_rates (room_id, start_date, end_date);
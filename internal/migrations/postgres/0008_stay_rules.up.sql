@@ -0,0 +1,17 @@
+-- closed_to_arrival and closed_to_departure are weekday bitmasks, bit 0 is Sunday and 127 is every day
+create table stay_rules
+(
+    id                  serial primary key,
+    room_id             integer      not null references rooms (id) on delete cascade on update cascade,
+    name                varchar(255) not null,
+    start_date          date         not null,
+    end_date            date         not null,
+    min_nights          integer      not null default 0,
+    max_nights          integer      not null default 0,
+    closed_to_arrival   integer      not null default 0,
+    closed_to_departure integer      not null default 0,
+    created_at          timestamp    not null default now(),
+    updated_at          timestamp    not null default now()
+);
+
+create index stay_rules_room_id_start_date_end_date_idx on stay_rules (room_id, start_date, end_date);
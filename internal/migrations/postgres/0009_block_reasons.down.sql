@@ -0,0 +1,5 @@
+delete from restrictions where id in (3, 4);
+
+select setval('restrictions_id_seq', (select max(id) from restrictions));
+
+alter table room_restrictions drop column reason;
@@ -0,0 +1,10 @@
+alter table room_restrictions drop constraint if exists room_restrictions_no_overlap;
+
+drop index if exists room_restrictions_unit_id_idx;
+alter table room_restrictions drop column if exists unit_id;
+
+drop table if exists room_units;
+
+alter table room_restrictions
+    add constraint room_restrictions_no_overlap
+        exclude using gist (room_id with =, daterange(start_date, end_date) with &&);
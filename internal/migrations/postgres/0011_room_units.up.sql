@@ -0,0 +1,33 @@
+-- a room is a room type and its units are the physical rooms guests stay in,
+-- so twelve identical doubles are one room with twelve units
+create table room_units
+(
+    id         serial primary key,
+    room_id    integer      not null references rooms (id) on delete cascade on update cascade,
+    name       varchar(255) not null,
+    sort_order integer      not null default 0,
+    created_at timestamp    not null default now(),
+    updated_at timestamp    not null default now()
+);
+
+create index room_units_room_id_idx on room_units (room_id);
+
+insert into room_units (room_id, name, sort_order)
+select id, room_name, 1
+from rooms
+order by id;
+
+alter table room_restrictions add column unit_id integer references room_units (id) on delete cascade on update cascade;
+
+update room_restrictions
+set unit_id = (select u.id from room_units u where u.room_id = room_restrictions.room_id);
+
+alter table room_restrictions alter column unit_id set not null;
+
+create index room_restrictions_unit_id_idx on room_restrictions (unit_id);
+
+-- a unit, rather than a whole room type, can never have two restrictions covering the same night
+alter table room_restrictions drop constraint if exists room_restrictions_no_overlap;
+alter table room_restrictions
+    add constraint room_restrictions_no_overlap
+        exclude using gist (unit_id with =, daterange(start_date, end_date) with &&);
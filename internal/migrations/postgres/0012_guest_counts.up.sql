@@ -0,0 +1,5 @@
+alter table rooms add column max_occupancy integer not null default 2;
+alter table reservations add column adults integer not null default 1;
+alter table reservations add column children integer not null default 0;
+
+update rooms set max_occupancy = 4 where slug = 'majors-suite';
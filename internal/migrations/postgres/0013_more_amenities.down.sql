@@ -0,0 +1,4 @@
+delete from room_amenities
+where amenity_id in (select id from amenities where name in ('Bathtub', 'Accessible', 'Pet-friendly'));
+
+delete from amenities where name in ('Bathtub', 'Accessible', 'Pet-friendly');
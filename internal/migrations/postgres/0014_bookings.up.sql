@@ -0,0 +1,11 @@
+-- a booking links the reservations of a split stay, one per room the guest stays in
+create table bookings
+(
+    id         serial primary key,
+    created_at timestamp not null default now(),
+    updated_at timestamp not null default now()
+);
+
+alter table reservations add column booking_id integer references bookings (id) on delete set null on update cascade;
+
+create index reservations_booking_id_idx on reservations (booking_id);
@@ -0,0 +1,29 @@
+-- webhooks tell other systems about reservations, each event is queued as a delivery for every endpoint
+-- subscribed to it and retried until the endpoint accepts it
+create table webhooks
+(
+    id         serial primary key,
+    url        varchar(2048) not null,
+    secret     varchar(255)  not null,
+    events     varchar(255)  not null,
+    created_at timestamp     not null default now(),
+    updated_at timestamp     not null default now()
+);
+
+create table webhook_deliveries
+(
+    id              serial primary key,
+    webhook_id      integer      not null references webhooks (id) on delete cascade,
+    event           varchar(64)  not null,
+    payload         text         not null,
+    status          varchar(16)  not null check (status in ('pending', 'delivered', 'failed')),
+    attempts        integer      not null default 0,
+    status_code     integer      not null default 0,
+    error           text         not null default '',
+    next_attempt_at timestamp    not null,
+    delivered_at    timestamp,
+    created_at      timestamp    not null default now(),
+    updated_at      timestamp    not null default now()
+);
+
+create index webhook_deliveries_due_idx on webhook_deliveries (status, next_attempt_at);
@@ -0,0 +1,3 @@
+-- bumped when a user is deactivated, has their password reset or sets a password, which ends the sessions
+-- logged in before
+alter table users add column session_version integer not null default 1;
@@ -0,0 +1,5 @@
+drop table if exists room_restrictions;
+drop table if exists reservations;
+drop table if exists restrictions;
+drop table if exists rooms;
+drop table if exists users;
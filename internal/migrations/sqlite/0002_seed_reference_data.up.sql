@@ -0,0 +1,7 @@
+insert into restrictions (id, restriction_name)
+values (1, 'Reservation'),
+       (2, 'Owner Block');
+
+insert into rooms (id, room_name)
+values (1, 'General''s Quarters'),
+       (2, 'Major''s Suite');
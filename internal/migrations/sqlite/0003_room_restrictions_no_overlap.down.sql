@@ -0,0 +1,2 @@
+drop trigger if exists room_restrictions_no_overlap_insert;
+drop trigger if exists room_restrictions_no_overlap_update;
@@ -0,0 +1,26 @@
+-- sqlite has no exclusion constraints, so these triggers stop a room from having two restrictions
+-- (reservations or blocks) covering the same night; a stay may start on the day the previous one ends
+create trigger room_restrictions_no_overlap_insert
+    before insert
+    on room_restrictions
+    when exists(select 1
+                from room_restrictions
+                where room_id = new.room_id
+                  and new.start_date < end_date
+                  and new.end_date > start_date)
+begin
+    select raise(abort, 'room_restrictions_no_overlap');
+end;
+
+create trigger room_restrictions_no_overlap_update
+    before update of start_date, end_date, room_id
+    on room_restrictions
+    when exists(select 1
+                from room_restrictions
+                where room_id = new.room_id
+                  and id <> new.id
+                  and new.start_date < end_date
+                  and new.end_date > start_date)
+begin
+    select raise(abort, 'room_restrictions_no_overlap');
+end;
@@ -0,0 +1,33 @@
+alter table rooms add column slug varchar(255) not null default '';
+alter table rooms add column description text not null default '';
+alter table rooms add column sort_order integer not null default 0;
+alter table rooms add column active boolean not null default true;
+
+update rooms set sort_order = id;
+update rooms set slug = 'generals-quarters' where id = 1 and room_name = 'General''s Quarters';
+update rooms set slug = 'majors-suite' where id = 2 and room_name = 'Major''s Suite';
+update rooms set slug = 'room-' || id where slug = '';
+
+update rooms
+set description = 'Your home away from home, set on the majestic waters of the Atlantic Ocean, this will be a vacation to remember.'
+where id in (1, 2);
+
+create unique index rooms_slug_idx on rooms (slug);
+
+create table room_images
+(
+    id         integer primary key autoincrement,
+    room_id    integer      not null references rooms (id) on delete cascade on update cascade,
+    image_path varchar(255) not null,
+    sort_order integer      not null default 0,
+    created_at timestamp    not null default current_timestamp,
+    updated_at timestamp    not null default current_timestamp
+);
+
+create index room_images_room_id_idx on room_images (room_id);
+
+insert into room_images (room_id, image_path, sort_order)
+select id, '/static/images/generals-quarters.png', 1 from rooms where slug = 'generals-quarters';
+
+insert into room_images (room_id, image_path, sort_order)
+select id, '/static/images/marjors-suite.png', 1 from rooms where slug = 'majors-suite';
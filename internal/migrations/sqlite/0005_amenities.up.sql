@@ -0,0 +1,27 @@
+create table amenities
+(
+    id         integer primary key autoincrement,
+    name       varchar(255) not null,
+    created_at timestamp    not null default current_timestamp,
+    updated_at timestamp    not null default current_timestamp
+);
+
+create unique index amenities_name_idx on amenities (name);
+
+create table room_amenities
+(
+    room_id    integer not null references rooms (id) on delete cascade on update cascade,
+    amenity_id integer not null references amenities (id) on delete cascade on update cascade,
+    primary key (room_id, amenity_id)
+);
+
+insert into amenities (name)
+values ('Ocean view'),
+       ('Private bathroom'),
+       ('Free Wi-Fi');
+
+insert into room_amenities (room_id, amenity_id)
+select r.id, a.id from rooms r, amenities a where r.slug = 'generals-quarters';
+
+insert into room_amenities (room_id, amenity_id)
+select r.id, a.id from rooms r, amenities a where r.slug = 'majors-suite' and a.name <> 'Ocean view';
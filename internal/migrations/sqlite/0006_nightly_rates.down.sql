@@ -0,0 +1,2 @@
+alter table reservations drop column total_price;
+alter table rooms drop column nightly_rate;
@@ -0,0 +1,5 @@
+alter table rooms add column nightly_rate integer not null default 0;
+alter table reservations add column total_price integer not null default 0;
+
+update rooms set nightly_rate = 12000 where slug = 'generals-quarters';
+update rooms set nightly_rate = 9500 where slug = 'majors-suite';
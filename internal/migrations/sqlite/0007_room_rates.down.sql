@@ -0,0 +1,3 @@
+drop table if exists room_rates;
+
+alter table rooms drop column weekend_rate;
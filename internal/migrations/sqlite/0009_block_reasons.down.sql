@@ -0,0 +1,3 @@
+delete from restrictions where id in (3, 4);
+
+alter table room_restrictions drop column reason;
@@ -0,0 +1,5 @@
+alter table room_restrictions add column reason text not null default '';
+
+insert into restrictions (id, restriction_name)
+values (3, 'Maintenance'),
+       (4, 'Out of Order');
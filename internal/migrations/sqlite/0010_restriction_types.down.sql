@@ -0,0 +1,5 @@
+drop index if exists restrictions_for_reservations_idx;
+
+alter table restrictions drop column for_reservations;
+alter table restrictions drop column counts_toward_occupancy;
+alter table restrictions drop column colour;
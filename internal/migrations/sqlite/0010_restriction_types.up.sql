@@ -0,0 +1,11 @@
+alter table restrictions add column colour varchar(7) not null default '#6c757d';
+alter table restrictions add column counts_toward_occupancy boolean not null default false;
+alter table restrictions add column for_reservations boolean not null default false;
+
+-- guest bookings are recorded under the one restriction type marked for_reservations
+create unique index restrictions_for_reservations_idx on restrictions (for_reservations) where for_reservations;
+
+update restrictions set colour = '#dc3545', counts_toward_occupancy = true, for_reservations = true where id = 1;
+update restrictions set colour = '#ffc107', counts_toward_occupancy = true where id = 2;
+update restrictions set colour = '#0dcaf0' where id = 3;
+update restrictions set colour = '#6c757d' where id = 4;
@@ -0,0 +1,32 @@
+drop trigger if exists room_restrictions_no_overlap_insert;
+drop trigger if exists room_restrictions_no_overlap_update;
+
+drop index if exists room_restrictions_unit_id_idx;
+alter table room_restrictions drop column unit_id;
+
+drop table if exists room_units;
+
+create trigger room_restrictions_no_overlap_insert
+    before insert
+    on room_restrictions
+    when exists(select 1
+                from room_restrictions
+                where room_id = new.room_id
+                  and new.start_date < end_date
+                  and new.end_date > start_date)
+begin
+    select raise(abort, 'room_restrictions_no_overlap');
+end;
+
+create trigger room_restrictions_no_overlap_update
+    before update of start_date, end_date, room_id
+    on room_restrictions
+    when exists(select 1
+                from room_restrictions
+                where room_id = new.room_id
+                  and id <> new.id
+                  and new.start_date < end_date
+                  and new.end_date > start_date)
+begin
+    select raise(abort, 'room_restrictions_no_overlap');
+end;
@@ -0,0 +1,54 @@
+-- a room is a room type and its units are the physical rooms guests stay in,
+-- so twelve identical doubles are one room with twelve units
+create table room_units
+(
+    id         integer primary key autoincrement,
+    room_id    integer      not null references rooms (id) on delete cascade on update cascade,
+    name       varchar(255) not null,
+    sort_order integer      not null default 0,
+    created_at timestamp    not null default current_timestamp,
+    updated_at timestamp    not null default current_timestamp
+);
+
+create index room_units_room_id_idx on room_units (room_id);
+
+insert into room_units (room_id, name, sort_order)
+select id, room_name, 1
+from rooms
+order by id;
+
+alter table room_restrictions add column unit_id integer references room_units (id) on delete cascade on update cascade;
+
+update room_restrictions
+set unit_id = (select u.id from room_units u where u.room_id = room_restrictions.room_id);
+
+create index room_restrictions_unit_id_idx on room_restrictions (unit_id);
+
+-- a unit, rather than a whole room type, can never have two restrictions covering the same night
+drop trigger if exists room_restrictions_no_overlap_insert;
+drop trigger if exists room_restrictions_no_overlap_update;
+
+create trigger room_restrictions_no_overlap_insert
+    before insert
+    on room_restrictions
+    when exists(select 1
+                from room_restrictions
+                where unit_id = new.unit_id
+                  and new.start_date < end_date
+                  and new.end_date > start_date)
+begin
+    select raise(abort, 'room_restrictions_no_overlap');
+end;
+
+create trigger room_restrictions_no_overlap_update
+    before update of start_date, end_date, unit_id
+    on room_restrictions
+    when exists(select 1
+                from room_restrictions
+                where unit_id = new.unit_id
+                  and id <> new.id
+                  and new.start_date < end_date
+                  and new.end_date > start_date)
+begin
+    select raise(abort, 'room_restrictions_no_overlap');
+end;
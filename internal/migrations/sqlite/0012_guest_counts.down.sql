@@ -0,0 +1,3 @@
+alter table reservations drop column children;
+alter table reservations drop column adults;
+alter table rooms drop column max_occupancy;
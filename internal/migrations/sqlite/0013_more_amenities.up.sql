@@ -0,0 +1,8 @@
+insert into amenities (name)
+values ('Bathtub'),
+       ('Accessible'),
+       ('Pet-friendly');
+
+insert into room_amenities (room_id, amenity_id)
+select r.id, a.id from rooms r, amenities a
+where r.slug = 'majors-suite' and a.name in ('Bathtub', 'Accessible', 'Pet-friendly');
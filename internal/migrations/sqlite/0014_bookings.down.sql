@@ -0,0 +1,4 @@
+drop index if exists reservations_booking_id_idx;
+alter table reservations drop column booking_id;
+
+drop table if exists bookings;
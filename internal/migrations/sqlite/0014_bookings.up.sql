@@ -0,0 +1,11 @@
+-- a booking links the reservations of a split stay, one per room the guest stays in
+create table bookings
+(
+    id         integer primary key autoincrement,
+    created_at timestamp not null default current_timestamp,
+    updated_at timestamp not null default current_timestamp
+);
+
+alter table reservations add column booking_id integer references bookings (id) on delete set null on update cascade;
+
+create index reservations_booking_id_idx on reservations (booking_id);
@@ -0,0 +1,13 @@
+-- api keys let other systems use the api, only a hash of each key is stored
+create table api_keys
+(
+    id           integer primary key autoincrement,
+    name         varchar(255) not null,
+    prefix       varchar(16)  not null,
+    key_hash     char(64)     not null unique,
+    scope        varchar(16)  not null check (scope in ('read', 'write')),
+    last_used_at timestamp,
+    revoked_at   timestamp,
+    created_at   timestamp    not null default current_timestamp,
+    updated_at   timestamp    not null default current_timestamp
+);
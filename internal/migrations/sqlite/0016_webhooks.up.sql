@@ -0,0 +1,29 @@
+-- webhooks tell other systems about reservations, each event is queued as a delivery for every endpoint
+-- subscribed to it and retried until the endpoint accepts it
+create table webhooks
+(
+    id         integer primary key autoincrement,
+    url        varchar(2048) not null,
+    secret     varchar(255)  not null,
+    events     varchar(255)  not null,
+    created_at timestamp     not null default current_timestamp,
+    updated_at timestamp     not null default current_timestamp
+);
+
+create table webhook_deliveries
+(
+    id              integer primary key autoincrement,
+    webhook_id      integer      not null references webhooks (id) on delete cascade,
+    event           varchar(64)  not null,
+    payload         text         not null,
+    status          varchar(16)  not null check (status in ('pending', 'delivered', 'failed')),
+    attempts        integer      not null default 0,
+    status_code     integer      not null default 0,
+    error           text         not null default '',
+    next_attempt_at timestamp    not null,
+    delivered_at    timestamp,
+    created_at      timestamp    not null default current_timestamp,
+    updated_at      timestamp    not null default current_timestamp
+);
+
+create index webhook_deliveries_due_idx on webhook_deliveries (status, next_attempt_at);
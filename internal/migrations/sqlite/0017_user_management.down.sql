@@ -0,0 +1,5 @@
+drop index if exists users_password_token_hash_idx;
+
+alter table users drop column password_token_expires_at;
+alter table users drop column password_token_hash;
+alter table users drop column active;
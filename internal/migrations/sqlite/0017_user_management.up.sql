@@ -0,0 +1,7 @@
+-- deactivated users cannot log in, and a user with a password token can set a new password with it until it
+-- expires, only a hash of each token is stored
+alter table users add column active boolean not null default true;
+alter table users add column password_token_hash char(64);
+alter table users add column password_token_expires_at timestamp;
+
+create unique index users_password_token_hash_idx on users (password_token_hash);
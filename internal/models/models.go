@@ -14,53 +14,185 @@ type User struct {
 	Email       string
 	Password    string
 	AccessLevel int
+	Active      bool
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+
+	// bumped to end the user's sessions, which keep the version they logged in with
+	SessionVersion int
+
+	// a hash of the token that lets the user set a new password, empty when there is none
+	PasswordTokenHash      string
+	PasswordTokenExpiresAt time.Time
 }
 
 // Room is the room model
 type Room struct {
+	ID           int
+	RoomName     string
+	Slug         string
+	Description  string
+	SortOrder    int
+	Active       bool
+	NightlyRate  int // in cents
+	WeekendRate  int // in cents, 0 charges the nightly rate on weekends too
+	MaxOccupancy int // the most guests, adults and children, one unit sleeps
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Images       []string  // Not in the Postgres model, paths from room_images
+	Amenities    []Amenity // Not in the Postgres model
+	Units        int       // Not in the Postgres model, the number of room_units
+	FreeUnits    int       // Not in the Postgres model, units free for the searched dates
+}
+
+// RoomSearch narrows an availability search to rooms that sleep Guests people and have every amenity in AmenityIDs
+type RoomSearch struct {
+	Guests     int
+	AmenityIDs []int
+}
+
+// RoomUnit is the RoomUnit model, one physical room of a room type
+type RoomUnit struct {
 	ID        int
-	RoomName  string
+	RoomID    int
+	Name      string
+	SortOrder int
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
+// Amenity is the amenity model
+type Amenity struct {
+	ID        int
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// RoomRate is the RoomRate model, a rate that overrides the room's own rates for the nights
+// from StartDate up to, but not including, EndDate
+type RoomRate struct {
+	ID          int
+	RoomID      int
+	Name        string
+	StartDate   time.Time
+	EndDate     time.Time
+	NightlyRate int // in cents
+	WeekendRate int // in cents, 0 charges the nightly rate on weekends too
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// StayRule is the StayRule model, limits on stays in a room for the dates from StartDate up to,
+// but not including, EndDate
+type StayRule struct {
+	ID                int
+	RoomID            int
+	Name              string
+	StartDate         time.Time
+	EndDate           time.Time
+	MinNights         int // 0 for no minimum
+	MaxNights         int // 0 for no maximum
+	ClosedToArrival   int // weekdays bitmask, bit 0 is Sunday
+	ClosedToDeparture int // weekdays bitmask, bit 0 is Sunday
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
 // Restriction is the restriction model
 type Restriction struct {
-	ID              int
-	RestrictionName string
-	CreatedAt       time.Time
-	UpdatedAt       time.Time
+	ID                    int
+	RestrictionName       string
+	Colour                string // hex colour on the reservation calendar, like #ffc107
+	CountsTowardOccupancy bool   // only for the calendar's occupancy figure, every type takes its unit for the night
+	ForReservations       bool   // guest bookings are recorded under this type
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
 }
 
 // Reservation is the reservation model
 type Reservation struct {
+	ID         int
+	FirstName  string
+	LastName   string
+	Email      string
+	Phone      string
+	StartDate  time.Time
+	EndDate    time.Time
+	RoomID     int
+	TotalPrice int // in cents
+	Adults     int
+	Children   int
+	BookingID  int // the split stay the reservation is part of, 0 for a stay in one room
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Room       Room     // Not in the Postgres model
+	Unit       RoomUnit // Not in the Postgres model, the unit the guest was given
+	Processed  int
+}
+
+// Booking is the Booking model, linking the reservations of a split stay
+type Booking struct {
+	ID           int
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Reservations []Reservation // Not in the Postgres model, in the order the guest stays in them
+}
+
+// APIKey is the APIKey model, a key other systems use the api with. Only the hash of the key is stored.
+type APIKey struct {
+	ID         int
+	Name       string
+	Prefix     string // the start of the key, to tell keys apart
+	KeyHash    string
+	Scope      string    // read or write
+	LastUsedAt time.Time // zero when the key was never used
+	RevokedAt  time.Time // zero while the key can be used
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Webhook is the Webhook model, an endpoint told about reservation events
+type Webhook struct {
 	ID        int
-	FirstName string
-	LastName  string
-	Email     string
-	Phone     string
-	StartDate time.Time
-	EndDate   time.Time
-	RoomID    int
+	URL       string
+	Secret    string   // signs the payloads, so the endpoint can tell they came from us
+	Events    []string // the events sent to the endpoint
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	Room      Room // Not in the Postgres model
-	Processed int
+}
+
+// WebhookDelivery is the WebhookDelivery model, an event queued for a webhook
+type WebhookDelivery struct {
+	ID            int
+	WebhookID     int
+	Event         string
+	Payload       string
+	Status        string // pending, delivered or failed
+	Attempts      int
+	StatusCode    int    // of the last attempt, 0 when it got no response
+	Error         string // why the last attempt failed
+	NextAttemptAt time.Time
+	DeliveredAt   time.Time // zero until delivered
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Webhook       Webhook // Not in the Postgres model
 }
 
 // RoomRestriction is the RoomRestriction model
 type RoomRestriction struct {
 	ID            int
 	RoomID        int
+	UnitID        int
 	ReservationID int
 	RestrictionID int
 	StartDate     time.Time
 	EndDate       time.Time
+	Reason        string
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 	Room          Room        // Not in the Postgres model
+	Unit          RoomUnit    // Not in the Postgres model
 	Reservation   Reservation // Not in the Postgres model
 	Restriction   Restriction // Not in the Postgres model
 }
@@ -73,3 +205,11 @@ type MailData struct {
 	Content  string
 	Template string
 }
+
+// Alternative is a stay in a room close to dates a guest searched for, offered when nothing was free for them
+type Alternative struct {
+	Room       Room
+	StartDate  time.Time
+	EndDate    time.Time
+	TotalPrice int // in cents
+}
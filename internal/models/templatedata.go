@@ -14,4 +14,6 @@ type TemplateData struct {
 	Error           string
 	Form            *forms.Form
 	IsAuthenticated int
+	Permissions     map[string]bool // what the logged in user's role can do in the admin area
+	Rooms           []Room // active rooms for the navigation menu
 }
@@ -0,0 +1,158 @@
+package openapi
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type testParty struct {
+	Name    string   `json:"name"`
+	Arrival string   `json:"arrival" openapi:"format=date"`
+	Adults  int      `json:"adults,omitempty" openapi:"minimum=1"`
+	Tags    []string `json:"tags,omitempty"`
+	Secret  string   `json:"-"`
+}
+
+type testBooking struct {
+	testParty
+	ID int `json:"id"`
+}
+
+func testDocument() *Document {
+	d := New("Test", "1.0.0", "")
+	d.Add(http.MethodPost, "/bookings", &Operation{
+		OperationID: "createBooking",
+		RequestBody: &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{"application/json": {Schema: d.Component("Party", testParty{})}},
+		},
+		Responses: map[string]Response{
+			"201": {Description: "Booked", Content: map[string]MediaType{
+				"application/json": {Schema: d.Component("Booking", testBooking{})},
+			}},
+		},
+	})
+	d.Add(http.MethodGet, "/bookings/{id}", &Operation{
+		OperationID: "getBooking",
+		Parameters: []Parameter{
+			{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "integer"}},
+			{Name: "from", In: "query", Required: true, Schema: &Schema{Type: "string", Format: "date"}},
+		},
+		Responses: map[string]Response{"204": {Description: "Found"}},
+	})
+	return d
+}
+
+func TestSchemaOf(t *testing.T) {
+	s := SchemaOf(testBooking{})
+
+	if s.Type != "object" || s.AdditionalProperties != false {
+		t.Fatalf("unexpected schema %+v", s)
+	}
+	if _, ok := s.Properties["Secret"]; ok {
+		t.Error("a field with json tag - is in the schema")
+	}
+	if s.Properties["arrival"].Format != "date" || *s.Properties["adults"].Minimum != 1 {
+		t.Error("openapi tag options are missing")
+	}
+	if s.Properties["tags"].Type != "array" || s.Properties["tags"].Items.Type != "string" {
+		t.Error("slices are not arrays of their element")
+	}
+	if strings.Join(s.Required, ",") != "name,arrival,id" {
+		t.Errorf("expected the fields without omitempty, and those of the embedded struct, required but got %v",
+			s.Required)
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	d := testDocument()
+
+	var tests = []struct {
+		name    string
+		method  string
+		target  string
+		body    string
+		invalid []string // the fields expected in Errors
+		badJSON bool
+	}{
+		{"valid body", "POST", "/bookings", `{"name": "John", "arrival": "2050-01-01", "adults": 2}`, nil, false},
+		{"missing field", "POST", "/bookings", `{"arrival": "2050-01-01"}`, []string{"name"}, false},
+		{"wrong types", "POST", "/bookings", `{"name": 1, "arrival": "2050-01-01", "adults": 1.5, "tags": [1]}`,
+			[]string{"name", "adults", "tags[0]"}, false},
+		{"bad date and minimum", "POST", "/bookings", `{"name": "John", "arrival": "01/01/2050", "adults": 0}`,
+			[]string{"arrival", "adults"}, false},
+		{"unknown field", "POST", "/bookings", `{"name": "John", "arrival": "2050-01-01", "id": 1, "x": 1}`,
+			[]string{"id", "x"}, false},
+		{"not json", "POST", "/bookings", `name=John`, nil, true},
+		{"no body", "POST", "/bookings", ``, nil, true},
+		{"valid parameters", "GET", "/bookings/1?from=2050-01-01", "", nil, false},
+		{"invalid parameters", "GET", "/bookings/one?from=tomorrow", "", []string{"id", "from"}, false},
+		{"missing parameter", "GET", "/bookings/1", "", []string{"from"}, false},
+		{"not in the document", "GET", "/rooms", "", nil, false},
+	}
+
+	for _, e := range tests {
+		request, _ := http.NewRequest(e.method, e.target, strings.NewReader(e.body))
+
+		err := d.ValidateRequest(request)
+
+		if e.badJSON {
+			if !errors.Is(err, ErrInvalidJSON) {
+				t.Errorf("%s: expected ErrInvalidJSON but got %v", e.name, err)
+			}
+			continue
+		}
+
+		var errs Errors
+		errors.As(err, &errs)
+		if len(errs) != len(e.invalid) {
+			t.Errorf("%s: expected %v invalid but got %v", e.name, e.invalid, err)
+			continue
+		}
+		for _, field := range e.invalid {
+			if len(errs[field]) == 0 {
+				t.Errorf("%s: expected %s to be invalid but got %v", e.name, field, err)
+			}
+		}
+	}
+
+	// the handler can still read the body
+	request, _ := http.NewRequest("POST", "/bookings", strings.NewReader(`{"name": "John", "arrival": "2050-01-01"}`))
+	if err := d.ValidateRequest(request); err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(request.Body)
+	if err != nil || !strings.Contains(string(body), "John") {
+		t.Error("the body was not left for the handler")
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	d := testDocument()
+
+	var tests = []struct {
+		name   string
+		method string
+		path   string
+		status int
+		body   string
+		valid  bool
+	}{
+		{"booking", "POST", "/bookings", 201, `{"id": 1, "name": "John", "arrival": "2050-01-01"}`, true},
+		{"missing id", "POST", "/bookings", 201, `{"name": "John", "arrival": "2050-01-01"}`, false},
+		{"undocumented status", "POST", "/bookings", 200, `{}`, false},
+		{"no content", "GET", "/bookings/1", 204, ``, true},
+		{"unexpected body", "GET", "/bookings/1", 204, `{}`, false},
+		{"undocumented path", "GET", "/rooms", 200, `[]`, false},
+	}
+
+	for _, e := range tests {
+		err := d.ValidateResponse(e.method, e.path, e.status, []byte(e.body))
+		if (err == nil) != e.valid {
+			t.Errorf("%s: expected valid to be %t but got %v", e.name, e.valid, err)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidJSON is returned for a request body that is not json
+var ErrInvalidJSON = errors.New("invalid json body")
+
+// Errors holds what is wrong with a request or response, by field
+type Errors map[string][]string
+
+func (e Errors) add(field, message string) {
+	e[field] = append(e[field], message)
+}
+
+// Error lists the fields and their messages in a stable order
+func (e Errors) Error() string {
+	var fields []string
+	for field, messages := range e {
+		fields = append(fields, fmt.Sprintf("%s: %s", field, strings.Join(messages, ", ")))
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, "; ")
+}
+
+// Find returns the operation for a method and path, and the values of the path's parameters
+func (d *Document) Find(method, path string) (*Operation, map[string]string) {
+	for template, item := range d.Paths {
+		op, ok := item[strings.ToLower(method)]
+		if !ok {
+			continue
+		}
+		if params, ok := match(template, path); ok {
+			return op, params
+		}
+	}
+	return nil, nil
+}
+
+// match matches a path against a path template like /rooms/{id}
+func match(template, path string) (map[string]string, bool) {
+	want := strings.Split(strings.Trim(template, "/"), "/")
+	got := strings.Split(strings.Trim(path, "/"), "/")
+	if len(want) != len(got) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i := range want {
+		if strings.HasPrefix(want[i], "{") && strings.HasSuffix(want[i], "}") {
+			params[strings.Trim(want[i], "{}")] = got[i]
+		} else if want[i] != got[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// ValidateRequest checks the parameters and body of a request against its operation, leaving the body for the
+// handler to read. It returns ErrInvalidJSON for a body that does not parse, Errors for one that does not match,
+// and nil for requests to operations the document does not have.
+func (d *Document) ValidateRequest(r *http.Request) error {
+	op, pathParams := d.Find(r.Method, r.URL.Path)
+	if op == nil {
+		return nil
+	}
+
+	errs := make(Errors)
+	query := r.URL.Query()
+
+	for _, p := range op.Parameters {
+		var values []string
+		switch p.In {
+		case "path":
+			values = []string{pathParams[p.Name]}
+		case "query":
+			values = query[p.Name]
+		}
+
+		if len(values) == 0 || (len(values) == 1 && values[0] == "") {
+			if p.Required {
+				errs.add(p.Name, "This parameter is required")
+			}
+			continue
+		}
+
+		schema := d.resolve(p.Schema)
+		if schema.Type == "array" {
+			for _, v := range values {
+				d.validateParameter(p.Name, d.resolve(schema.Items), v, errs)
+			}
+		} else if len(values) > 1 {
+			errs.add(p.Name, "This parameter can only be given once")
+		} else {
+			d.validateParameter(p.Name, schema, values[0], errs)
+		}
+	}
+
+	if op.RequestBody != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if len(bytes.TrimSpace(body)) == 0 {
+			if op.RequestBody.Required {
+				return ErrInvalidJSON
+			}
+		} else {
+			value, err := decode(body)
+			if err != nil {
+				return ErrInvalidJSON
+			}
+			d.validate("", d.resolve(op.RequestBody.Content["application/json"].Schema), value, errs)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ValidateResponse checks a response body against the response of the operation for its status code
+func (d *Document) ValidateResponse(method, path string, status int, body []byte) error {
+	op, _ := d.Find(method, path)
+	if op == nil {
+		return fmt.Errorf("%s %s is not in the document", method, path)
+	}
+
+	response, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		return fmt.Errorf("%s %s does not document a %d response", method, path, status)
+	}
+
+	media, ok := response.Content["application/json"]
+	if !ok {
+		if len(bytes.TrimSpace(body)) > 0 {
+			return fmt.Errorf("%s %s %d has a body but documents none", method, path, status)
+		}
+		return nil
+	}
+
+	value, err := decode(body)
+	if err != nil {
+		return fmt.Errorf("%s %s %d: %w", method, path, status, ErrInvalidJSON)
+	}
+
+	errs := make(Errors)
+	d.validate("", d.resolve(media.Schema), value, errs)
+	if len(errs) > 0 {
+		return fmt.Errorf("%s %s %d: %w", method, path, status, errs)
+	}
+	return nil
+}
+
+func decode(body []byte) (interface{}, error) {
+	var value interface{}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, ErrInvalidJSON
+	}
+
+	return value, nil
+}
+
+// validateParameter checks a path or query parameter, which are always strings in the request
+func (d *Document) validateParameter(name string, schema *Schema, value string, errs Errors) {
+	if schema.Type == "integer" {
+		if _, err := strconv.Atoi(value); err != nil {
+			errs.add(name, "Must be a whole number")
+			return
+		}
+		d.validate(name, schema, json.Number(value), errs)
+		return
+	}
+	d.validate(name, schema, value, errs)
+}
+
+// validate checks a decoded json value against a schema, adding what is wrong to errs under field
+func (d *Document) validate(field string, schema *Schema, value interface{}, errs Errors) {
+	schema = d.resolve(schema)
+	if schema == nil {
+		return
+	}
+
+	name := field
+	if name == "" {
+		name = "body"
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			errs.add(name, "Must be an object")
+			return
+		}
+		for _, required := range schema.Required {
+			if _, ok := object[required]; !ok {
+				errs.add(join(field, required), "This field is required")
+			}
+		}
+		for key, v := range object {
+			property, ok := schema.Properties[key]
+			if !ok {
+				switch additional := schema.AdditionalProperties.(type) {
+				case *Schema:
+					d.validate(join(field, key), additional, v, errs)
+				case bool:
+					if !additional {
+						errs.add(join(field, key), "Unknown field")
+					}
+				}
+				continue
+			}
+			d.validate(join(field, key), property, v, errs)
+		}
+
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			errs.add(name, "Must be an array")
+			return
+		}
+		for i, v := range items {
+			d.validate(fmt.Sprintf("%s[%d]", name, i), schema.Items, v, errs)
+		}
+
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			errs.add(name, "Must be a string")
+			return
+		}
+		if schema.Format == "date" {
+			if _, err := time.Parse("2006-01-02", s); err != nil {
+				errs.add(name, "Dates must be given as yyyy-mm-dd")
+			}
+		}
+		if len(schema.Enum) > 0 && !contains(schema.Enum, s) {
+			errs.add(name, fmt.Sprintf("Must be one of %s", strings.Join(schema.Enum, ", ")))
+		}
+
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			errs.add(name, "Must be a number")
+			return
+		}
+		f, err := n.Float64()
+		if err != nil || (schema.Type == "integer" && strings.ContainsAny(n.String(), ".eE")) {
+			errs.add(name, "Must be a whole number")
+			return
+		}
+		if schema.Minimum != nil && f < float64(*schema.Minimum) {
+			errs.add(name, fmt.Sprintf("Must be at least %d", *schema.Minimum))
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			errs.add(name, "Must be true or false")
+		}
+	}
+}
+
+func join(field, key string) string {
+	if field == "" {
+		return key
+	}
+	return field + "." + key
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
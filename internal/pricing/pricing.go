@@ -0,0 +1,124 @@
+package pricing
+
+import (
+	"fmt"
+	"github.com/FilipeParreiras/Bookings/internal/models"
+	"github.com/FilipeParreiras/Bookings/internal/stayrules"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prices are whole cents, so totals add up without rounding errors
+
+// ErrInvalidStay is returned when a stay does not end after it starts
+var ErrInvalidStay = stayrules.ErrInvalidStay
+
+// Night is the price of one night of a stay
+type Night struct {
+	Date     time.Time
+	Rate     int
+	RateName string // the override used, empty for the room's own rates
+}
+
+// Quote is the price of a stay, night by night
+type Quote struct {
+	Nights []Night
+	Total  int
+}
+
+// Calculate prices every night from start up to, but not including, end. Each night costs the rate of the
+// narrowest override covering it, or else the room's own rate. Friday and Saturday nights cost the weekend
+// rate when there is one.
+func Calculate(room models.Room, rates []models.RoomRate, start, end time.Time) (Quote, error) {
+	var quote Quote
+
+	if !end.After(start) {
+		return quote, ErrInvalidStay
+	}
+
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		night := Night{Date: d, Rate: nightlyRate(d, room.NightlyRate, room.WeekendRate)}
+
+		if rate, ok := override(rates, d); ok {
+			night.Rate = nightlyRate(d, rate.NightlyRate, rate.WeekendRate)
+			night.RateName = rate.Name
+		}
+
+		quote.Nights = append(quote.Nights, night)
+		quote.Total += night.Rate
+	}
+
+	return quote, nil
+}
+
+// IsWeekend tells if the night starting on d is a weekend night
+func IsWeekend(d time.Time) bool {
+	return d.Weekday() == time.Friday || d.Weekday() == time.Saturday
+}
+
+// nightlyRate picks the weekend rate for weekend nights, when set
+func nightlyRate(d time.Time, nightly, weekend int) int {
+	if weekend > 0 && IsWeekend(d) {
+		return weekend
+	}
+	return nightly
+}
+
+// override returns the narrowest rate covering the night starting on d. Of two equally long rates,
+// the one added last wins.
+func override(rates []models.RoomRate, d time.Time) (models.RoomRate, bool) {
+	var best models.RoomRate
+	found := false
+
+	for _, rate := range rates {
+		if d.Before(rate.StartDate) || !d.Before(rate.EndDate) {
+			continue
+		}
+
+		length := rate.EndDate.Sub(rate.StartDate)
+		bestLength := best.EndDate.Sub(best.StartDate)
+		if !found || length < bestLength || (length == bestLength && rate.ID > best.ID) {
+			best = rate
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+// Format shows a price in cents as an amount, like 120.50
+func Format(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Parse reads an amount like 120, 120.5 or 120.50 into cents
+func Parse(amount string) (int, error) {
+	amount = strings.TrimSpace(amount)
+
+	units, fraction, _ := strings.Cut(amount, ".")
+	if units == "" || len(fraction) > 2 || strings.HasPrefix(units, "-") || strings.HasPrefix(units, "+") {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+
+	whole, err := strconv.Atoi(units)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+
+	cents := 0
+	if fraction != "" {
+		cents, err = strconv.Atoi((fraction + "0")[:2])
+		if err != nil || strings.HasPrefix(fraction, "-") || strings.HasPrefix(fraction, "+") {
+			return 0, fmt.Errorf("invalid amount %q", amount)
+		}
+	}
+
+	return whole*100 + cents, nil
+}
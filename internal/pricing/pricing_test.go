@@ -0,0 +1,134 @@
+package pricing
+
+import (
+	"github.com/FilipeParreiras/Bookings/internal/models"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestCalculate(t *testing.T) {
+	room := models.Room{ID: 1, NightlyRate: 12050}
+
+	quote, err := Calculate(room, nil, date("2050-01-30"), date("2050-02-02"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(quote.Nights) != 3 {
+		t.Errorf("expected 3 nights but got %d", len(quote.Nights))
+	}
+	if !quote.Nights[2].Date.Equal(date("2050-02-01")) {
+		t.Errorf("last night is %s, expected 2050-02-01", quote.Nights[2].Date)
+	}
+	if quote.Total != 36150 {
+		t.Errorf("expected a total of 36150 but got %d", quote.Total)
+	}
+
+	for _, end := range []string{"2050-01-30", "2050-01-29"} {
+		_, err = Calculate(room, nil, date("2050-01-30"), date(end))
+		if err != ErrInvalidStay {
+			t.Errorf("expected ErrInvalidStay for a stay ending %s but got %v", end, err)
+		}
+	}
+}
+
+func TestCalculate_Overrides(t *testing.T) {
+	// 2050-07-01 is a Friday
+	room := models.Room{ID: 1, NightlyRate: 10000, WeekendRate: 12000}
+	rates := []models.RoomRate{
+		{ID: 1, Name: "Summer", StartDate: date("2050-06-15"), EndDate: date("2050-09-15"), NightlyRate: 15000},
+		{ID: 2, Name: "Holiday", StartDate: date("2050-07-03"), EndDate: date("2050-07-05"), NightlyRate: 20000, WeekendRate: 25000},
+		{ID: 3, Name: "Late summer", StartDate: date("2050-07-04"), EndDate: date("2050-07-06"), NightlyRate: 18000},
+	}
+
+	quote, err := Calculate(room, rates, date("2050-06-13"), date("2050-06-16"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// two nights at the room's rate and the first night of summer
+	if quote.Total != 10000+10000+15000 || quote.Nights[2].RateName != "Summer" || quote.Nights[0].RateName != "" {
+		t.Errorf("unexpected quote before summer: %+v", quote)
+	}
+
+	quote, err = Calculate(room, rates, date("2050-07-01"), date("2050-07-06"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected = []struct {
+		rate int
+		name string
+	}{
+		{15000, "Summer"},      // friday, summer has no weekend rate
+		{15000, "Summer"},      // saturday
+		{20000, "Holiday"},     // sunday, holiday is narrower than summer
+		{18000, "Late summer"}, // monday, both two nights long, late summer was added last
+		{18000, "Late summer"}, // tuesday
+	}
+
+	for i, e := range expected {
+		if quote.Nights[i].Rate != e.rate || quote.Nights[i].RateName != e.name {
+			t.Errorf("night %d: expected %d (%s) but got %d (%s)", i, e.rate, e.name,
+				quote.Nights[i].Rate, quote.Nights[i].RateName)
+		}
+	}
+
+	// weekend nights without an override
+	quote, _ = Calculate(room, nil, date("2050-01-07"), date("2050-01-10"))
+	if quote.Total != 12000+12000+10000 {
+		t.Errorf("expected weekend rates on friday and saturday, got %+v", quote)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	var tests = []struct {
+		cents    int
+		expected string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{12050, "120.50"},
+		{-250, "-2.50"},
+	}
+
+	for _, e := range tests {
+		if got := Format(e.cents); got != e.expected {
+			t.Errorf("Format(%d) = %s, expected %s", e.cents, got, e.expected)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	var tests = []struct {
+		amount   string
+		expected int
+		valid    bool
+	}{
+		{"120", 12000, true},
+		{"120.5", 12050, true},
+		{" 120.05 ", 12005, true},
+		{"0", 0, true},
+		{"", 0, false},
+		{".50", 0, false},
+		{"120.505", 0, false},
+		{"-120", 0, false},
+		{"12O", 0, false},
+		{"120.-5", 0, false},
+	}
+
+	for _, e := range tests {
+		got, err := Parse(e.amount)
+		if (err == nil) != e.valid {
+			t.Errorf("Parse(%q) returned error %v", e.amount, err)
+		}
+		if e.valid && got != e.expected {
+			t.Errorf("Parse(%q) = %d, expected %d", e.amount, got, e.expected)
+		}
+	}
+}
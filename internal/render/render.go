@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"github.com/FilipeParreiras/Bookings/internal/access"
 	"github.com/FilipeParreiras/Bookings/internal/config"
 	"github.com/FilipeParreiras/Bookings/internal/models"
+	"github.com/FilipeParreiras/Bookings/internal/pricing"
+	"github.com/FilipeParreiras/Bookings/internal/repository"
+	"github.com/FilipeParreiras/Bookings/internal/stayrules"
 	"github.com/justinas/nosurf"
 	"html/template"
+	"log"
 	"net/http"
 	"path/filepath"
 	"time"
@@ -15,13 +20,18 @@ import (
 
 // specify sertain functions that are available to golang template
 var functions = template.FuncMap{
-	"humanDate":  HumanDate,
-	"formatDate": FormatDate,
-	"iterate":    Iterate,
-	"add":        Add,
+	"humanDate":   HumanDate,
+	"formatDate":  FormatDate,
+	"iterate":     Iterate,
+	"add":         Add,
+	"formatPrice": pricing.Format,
+	"weekdays":    stayrules.DayNames,
+	"guests":      Guests,
+	"roleName":    RoleName,
 }
 
 var app *config.AppConfig
+var menu repository.DatabaseRepo
 var pathToTemplates = "./templates"
 
 func Add(a, b int) int {
@@ -44,6 +54,11 @@ func NewRenderer(a *config.AppConfig) {
 	app = a
 }
 
+// NewMenu sets the repository the rooms of the navigation menu are read from
+func NewMenu(db repository.DatabaseRepo) {
+	menu = db
+}
+
 // HumanDate returns time in YYY-MM-DD format
 func HumanDate(time time.Time) string {
 	return time.Format("2006-01-02")
@@ -53,6 +68,29 @@ func FormatDate(time time.Time, f string) string {
 	return time.Format(f)
 }
 
+// RoleName returns the name of the role of an access level, like "Front desk"
+func RoleName(accessLevel int) string {
+	role, _ := access.RoleFor(accessLevel)
+	return role.String()
+}
+
+// Guests describes a party, like "2 adults and 1 child"
+func Guests(adults, children int) string {
+	label := fmt.Sprintf("%d adult", adults)
+	if adults != 1 {
+		label += "s"
+	}
+
+	switch {
+	case children == 1:
+		label += " and 1 child"
+	case children > 1:
+		label += fmt.Sprintf(" and %d children", children)
+	}
+
+	return label
+}
+
 // AddDefaultData adds data for all templates
 func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateData {
 	td.Flash = app.Session.PopString(r.Context(), "flash")
@@ -62,6 +100,20 @@ func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateDa
 	if app.Session.Exists(r.Context(), "user_id") {
 		td.IsAuthenticated = 1
 	}
+	if role, ok := access.RoleFrom(r.Context()); ok {
+		td.Permissions = role.Permissions()
+	}
+	if menu != nil {
+		rooms, err := menu.AllRooms(r.Context())
+		if err != nil {
+			log.Println("cannot load the rooms menu:", err)
+		}
+		for _, room := range rooms {
+			if room.Active {
+				td.Rooms = append(td.Rooms, room)
+			}
+		}
+	}
 	return td
 }
 
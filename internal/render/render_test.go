@@ -75,3 +75,22 @@ func TestCreateTemplateCache(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestGuests(t *testing.T) {
+	var tests = []struct {
+		adults   int
+		children int
+		expected string
+	}{
+		{1, 0, "1 adult"},
+		{2, 0, "2 adults"},
+		{2, 1, "2 adults and 1 child"},
+		{1, 3, "1 adult and 3 children"},
+	}
+
+	for _, e := range tests {
+		if label := Guests(e.adults, e.children); label != e.expected {
+			t.Errorf("expected %q but got %q", e.expected, label)
+		}
+	}
+}
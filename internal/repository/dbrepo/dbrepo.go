@@ -1,19 +1,31 @@
 package dbrepo
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"github.com/FilipeParreiras/Bookings/internal/config"
 	"github.com/FilipeParreiras/Bookings/internal/repository"
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"strings"
+	"time"
 )
 
+// defaultQueryTimeout is used when the app config does not set DBTimeout
+const defaultQueryTimeout = 3 * time.Second
+
 type postgresDBRepo struct {
 	App *config.AppConfig
 	DB  *sql.DB
 }
 
-type testDBRepo struct {
-	App *config.AppConfig
-	DB  *sql.DB
+// sqliteDBRepo keeps the whole database in one SQLite file, for local development and tests.
+// SQLite understands the $n placeholders, returning clauses and date comparisons used by the
+// postgres queries, so it shares their implementation.
+type sqliteDBRepo struct {
+	postgresDBRepo
 }
 
 func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
@@ -23,8 +35,69 @@ func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo
 	}
 }
 
-func NewTestingsRepo(a *config.AppConfig) repository.DatabaseRepo {
-	return &testDBRepo{
-		App: a,
+func NewSQLiteRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo {
+	return &sqliteDBRepo{
+		postgresDBRepo{
+			App: a,
+			DB:  conn,
+		},
+	}
+}
+
+// uniqueIDs returns ids without repeats, in their first order
+func uniqueIDs(ids []int) []int {
+	var unique []int
+	seen := make(map[int]bool)
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	return unique
+}
+
+// queryContext derives the context for a query from the caller's one, so it is cancelled with the request
+// and never runs longer than the configured query timeout
+func (m *postgresDBRepo) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := defaultQueryTimeout
+	if m.App != nil && m.App.DBTimeout > 0 {
+		timeout = m.App.DBTimeout
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// isOverlap reports if err was raised because two restrictions would cover the same night for a room: the
+// room_restrictions_no_overlap exclusion constraint (23P01) or a serialization failure between two bookings (40001)
+// in postgres, or the room_restrictions_no_overlap triggers in sqlite
+func isOverlap(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23P01" || pgErr.Code == "40001"
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_TRIGGER &&
+			strings.Contains(sqliteErr.Error(), "room_restrictions_no_overlap")
+	}
+
+	return false
+}
+
+// isUniqueViolation reports if err was raised by a unique index, 23505 in postgres
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
 	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+	}
+
+	return false
 }
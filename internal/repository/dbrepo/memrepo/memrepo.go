@@ -0,0 +1,1861 @@
+package memrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/FilipeParreiras/Bookings/internal/apikeys"
+	"github.com/FilipeParreiras/Bookings/internal/config"
+	"github.com/FilipeParreiras/Bookings/internal/models"
+	"github.com/FilipeParreiras/Bookings/internal/repository"
+	"github.com/FilipeParreiras/Bookings/internal/webhooks"
+	"golang.org/x/crypto/bcrypt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Repo is a DatabaseRepo that keeps everything in memory with the same rules as the sql repositories:
+// rooms must exist, restrictions for a room never overlap and deleting a reservation frees its dates.
+// Tests can make any method fail with FailOn.
+type Repo struct {
+	App *config.AppConfig
+
+	mu               sync.Mutex
+	failures         map[string]error
+	users            map[int]models.User
+	rooms            map[int]models.Room
+	amenities        map[int]models.Amenity
+	roomRates        map[int]models.RoomRate
+	roomUnits        map[int]models.RoomUnit
+	stayRules        map[int]models.StayRule
+	restrictions     map[int]models.Restriction
+	reservations     map[int]models.Reservation
+	bookings         map[int]models.Booking
+	apiKeys          map[int]models.APIKey
+	webhooks         map[int]models.Webhook
+	deliveries       map[int]models.WebhookDelivery
+	roomRestrictions map[int]models.RoomRestriction
+	lastID           int
+}
+
+var _ repository.DatabaseRepo = (*Repo)(nil)
+
+// New creates an in-memory repository with the same rooms, units, amenities and restrictions as the
+// seed migrations
+func New(a *config.AppConfig) *Repo {
+	m := &Repo{
+		App:              a,
+		failures:         make(map[string]error),
+		users:            make(map[int]models.User),
+		rooms:            make(map[int]models.Room),
+		amenities:        make(map[int]models.Amenity),
+		roomRates:        make(map[int]models.RoomRate),
+		roomUnits:        make(map[int]models.RoomUnit),
+		stayRules:        make(map[int]models.StayRule),
+		restrictions:     make(map[int]models.Restriction),
+		reservations:     make(map[int]models.Reservation),
+		bookings:         make(map[int]models.Booking),
+		apiKeys:          make(map[int]models.APIKey),
+		webhooks:         make(map[int]models.Webhook),
+		deliveries:       make(map[int]models.WebhookDelivery),
+		roomRestrictions: make(map[int]models.RoomRestriction),
+	}
+
+	m.amenities[1] = models.Amenity{ID: 1, Name: "Ocean view"}
+	m.amenities[2] = models.Amenity{ID: 2, Name: "Private bathroom"}
+	m.amenities[3] = models.Amenity{ID: 3, Name: "Free Wi-Fi"}
+	m.amenities[4] = models.Amenity{ID: 4, Name: "Bathtub"}
+	m.amenities[5] = models.Amenity{ID: 5, Name: "Accessible"}
+	m.amenities[6] = models.Amenity{ID: 6, Name: "Pet-friendly"}
+
+	description := "Your home away from home, set on the majestic waters of the Atlantic Ocean, " +
+		"this will be a vacation to remember."
+
+	m.rooms[1] = models.Room{
+		ID:           1,
+		RoomName:     "General's Quarters",
+		Slug:         "generals-quarters",
+		Description:  description,
+		SortOrder:    1,
+		Active:       true,
+		NightlyRate:  12000,
+		MaxOccupancy: 2,
+		Images:       []string{"/static/images/generals-quarters.png"},
+		Amenities:    []models.Amenity{m.amenities[3], m.amenities[1], m.amenities[2]},
+	}
+	m.rooms[2] = models.Room{
+		ID:           2,
+		RoomName:     "Major's Suite",
+		Slug:         "majors-suite",
+		Description:  description,
+		SortOrder:    2,
+		Active:       true,
+		NightlyRate:  9500,
+		MaxOccupancy: 4,
+		Images:       []string{"/static/images/marjors-suite.png"},
+		Amenities: []models.Amenity{m.amenities[5], m.amenities[4], m.amenities[3], m.amenities[6],
+			m.amenities[2]},
+	}
+	m.roomUnits[1] = models.RoomUnit{ID: 1, RoomID: 1, Name: "General's Quarters", SortOrder: 1}
+	m.roomUnits[2] = models.RoomUnit{ID: 2, RoomID: 2, Name: "Major's Suite", SortOrder: 1}
+	m.restrictions[1] = models.Restriction{
+		ID:                    1,
+		RestrictionName:       "Reservation",
+		Colour:                "#dc3545",
+		CountsTowardOccupancy: true,
+		ForReservations:       true,
+	}
+	m.restrictions[2] = models.Restriction{
+		ID:                    2,
+		RestrictionName:       "Owner Block",
+		Colour:                "#ffc107",
+		CountsTowardOccupancy: true,
+	}
+	m.restrictions[3] = models.Restriction{ID: 3, RestrictionName: "Maintenance", Colour: "#0dcaf0"}
+	m.restrictions[4] = models.Restriction{ID: 4, RestrictionName: "Out of Order", Colour: "#6c757d"}
+	m.lastID = 4
+
+	return m
+}
+
+// FailOn makes every call to the named DatabaseRepo method return err, until cleared with ClearFailures
+func (m *Repo) FailOn(method string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.failures[method] = err
+}
+
+// ClearFailures makes every method succeed again
+func (m *Repo) ClearFailures() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.failures = make(map[string]error)
+}
+
+// AddUser stores a user that can log in with password and returns its id
+func (m *Repo) AddUser(user models.User, password string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return 0, err
+	}
+
+	user.ID = m.nextID()
+	user.Password = string(hashedPassword)
+	user.Active = true
+	user.SessionVersion = 1
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = time.Now()
+	m.users[user.ID] = user
+
+	return user.ID, nil
+}
+
+// fail returns the error registered for method, if any. Callers must hold m.mu.
+func (m *Repo) fail(method string) error {
+	return m.failures[method]
+}
+
+// nextID returns a new id, unique across all tables. Callers must hold m.mu.
+func (m *Repo) nextID() int {
+	m.lastID++
+	return m.lastID
+}
+
+// uniqueIDs returns ids without repeats, in their first order
+func uniqueIDs(ids []int) []int {
+	var unique []int
+	seen := make(map[int]bool)
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	return unique
+}
+
+// overlaps reports if a restriction for unitID already covers a night between start and end.
+// Callers must hold m.mu.
+func (m *Repo) overlaps(unitID int, start, end time.Time) bool {
+	for _, r := range m.roomRestrictions {
+		if r.UnitID == unitID && start.Before(r.EndDate) && end.After(r.StartDate) {
+			return true
+		}
+	}
+	return false
+}
+
+// units returns the units of roomID in display order. Callers must hold m.mu.
+func (m *Repo) units(roomID int) []models.RoomUnit {
+	var units []models.RoomUnit
+	for _, u := range m.roomUnits {
+		if u.RoomID == roomID {
+			units = append(units, u)
+		}
+	}
+
+	sort.Slice(units, func(i, j int) bool {
+		if units[i].SortOrder == units[j].SortOrder {
+			return units[i].ID < units[j].ID
+		}
+		return units[i].SortOrder < units[j].SortOrder
+	})
+
+	return units
+}
+
+// freeUnits returns the ids of the units of roomID, in display order, that have no restriction
+// between start and end. Callers must hold m.mu.
+func (m *Repo) freeUnits(roomID int, start, end time.Time) []int {
+	var free []int
+	for _, u := range m.units(roomID) {
+		if !m.overlaps(u.ID, start, end) {
+			free = append(free, u.ID)
+		}
+	}
+	return free
+}
+
+// withRoom fills in the room id and name of a reservation, as the sql join does. Callers must hold m.mu.
+func (m *Repo) withRoom(res models.Reservation) models.Reservation {
+	room := m.rooms[res.RoomID]
+	res.Room = models.Room{ID: room.ID, RoomName: room.RoomName}
+	return res
+}
+
+// insertReservation stores reservation and returns its id. Callers must hold m.mu.
+func (m *Repo) insertReservation(reservation models.Reservation) (int, error) {
+	if _, ok := m.rooms[reservation.RoomID]; !ok {
+		return 0, errors.New("reservation for a room that does not exist")
+	}
+
+	reservation.ID = m.nextID()
+	reservation.Room = models.Room{}
+	reservation.CreatedAt = time.Now()
+	reservation.UpdatedAt = time.Now()
+	m.reservations[reservation.ID] = reservation
+
+	return reservation.ID, nil
+}
+
+// insertRoomRestriction stores r unless it overlaps another restriction for its unit. Without a unit, r goes
+// on the first free unit of the room. Callers must hold m.mu.
+func (m *Repo) insertRoomRestriction(r models.RoomRestriction) error {
+	if r.UnitID == 0 {
+		free := m.freeUnits(r.RoomID, r.StartDate, r.EndDate)
+		if len(free) == 0 {
+			return repository.ErrRoomUnavailable
+		}
+		r.UnitID = free[0]
+	}
+
+	unit, ok := m.roomUnits[r.UnitID]
+	if !ok {
+		return errors.New("restriction for a unit that does not exist")
+	}
+	r.RoomID = unit.RoomID
+
+	if m.overlaps(r.UnitID, r.StartDate, r.EndDate) {
+		return repository.ErrRoomUnavailable
+	}
+
+	r.ID = m.nextID()
+	r.CreatedAt = time.Now()
+	r.UpdatedAt = time.Now()
+	m.roomRestrictions[r.ID] = r
+
+	return nil
+}
+
+// reservationRestrictionID returns the id of the restriction type guest bookings are recorded under
+func (m *Repo) reservationRestrictionID() int {
+	for _, r := range m.restrictions {
+		if r.ForReservations {
+			return r.ID
+		}
+	}
+	return 0
+}
+
+// InsertReservationWithRestriction inserts a reservation and the room restriction that blocks its dates together
+func (m *Repo) InsertReservationWithRestriction(ctx context.Context, reservation models.Reservation) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("InsertReservationWithRestriction"); err != nil {
+		return 0, err
+	}
+
+	return m.insertReservationWithRestriction(reservation)
+}
+
+// insertReservationWithRestriction inserts a reservation on the first unit of its room that is free for the whole
+// stay, and the room restriction that blocks its dates. Callers must hold m.mu.
+func (m *Repo) insertReservationWithRestriction(reservation models.Reservation) (int, error) {
+	// the guest is given the first unit of the room that is free for the whole stay
+	free := m.freeUnits(reservation.RoomID, reservation.StartDate, reservation.EndDate)
+	if len(free) == 0 {
+		return 0, &repository.ConflictError{
+			RoomID:    reservation.RoomID,
+			StartDate: reservation.StartDate,
+			EndDate:   reservation.EndDate,
+		}
+	}
+
+	id, err := m.insertReservation(reservation)
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.insertRoomRestriction(models.RoomRestriction{
+		StartDate:     reservation.StartDate,
+		EndDate:       reservation.EndDate,
+		RoomID:        reservation.RoomID,
+		UnitID:        free[0],
+		ReservationID: id,
+		RestrictionID: m.reservationRestrictionID(),
+	})
+	if err != nil {
+		delete(m.reservations, id)
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// InsertBooking inserts the reservations of a split stay, and the room restrictions that block their dates, under
+// one booking. Either every reservation is inserted or none is.
+func (m *Repo) InsertBooking(ctx context.Context, reservations []models.Reservation) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("InsertBooking"); err != nil {
+		return 0, err
+	}
+
+	booking := models.Booking{ID: m.nextID(), CreatedAt: time.Now(), UpdatedAt: time.Now()}
+
+	var inserted []int
+	for _, reservation := range reservations {
+		reservation.BookingID = booking.ID
+		id, err := m.insertReservationWithRestriction(reservation)
+		if err != nil {
+			// roll back the reservations inserted before this one
+			for _, id := range inserted {
+				m.deleteReservation(id)
+			}
+			return 0, err
+		}
+		inserted = append(inserted, id)
+	}
+
+	m.bookings[booking.ID] = booking
+
+	return booking.ID, nil
+}
+
+// GetBookingByID returns a booking with its reservations in the order the guest stays in them
+func (m *Repo) GetBookingByID(ctx context.Context, id int) (models.Booking, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("GetBookingByID"); err != nil {
+		return models.Booking{}, err
+	}
+
+	booking, ok := m.bookings[id]
+	if !ok {
+		return booking, sql.ErrNoRows
+	}
+
+	for _, res := range m.reservations {
+		if res.BookingID == id {
+			booking.Reservations = append(booking.Reservations, m.withRoom(res))
+		}
+	}
+
+	sort.Slice(booking.Reservations, func(i, j int) bool {
+		return booking.Reservations[i].StartDate.Before(booking.Reservations[j].StartDate)
+	})
+
+	return booking, nil
+}
+
+// SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID and false otherwise
+func (m *Repo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("SearchAvailabilityByDatesByRoomID"); err != nil {
+		return false, err
+	}
+
+	return len(m.freeUnits(roomID, start, end)) > 0, nil
+}
+
+// SearchAvailabilityForAllRooms returns a slice of available rooms, with their amenities, if any for given date
+// range that match search. A restriction of any type takes its unit, whether or not it counts toward occupancy.
+func (m *Repo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time, search models.RoomSearch) ([]models.Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var rooms []models.Room
+
+	if err := m.fail("SearchAvailabilityForAllRooms"); err != nil {
+		return rooms, err
+	}
+
+	for _, room := range m.rooms {
+		free := len(m.freeUnits(room.ID, start, end))
+		if room.Active && free > 0 && room.MaxOccupancy >= search.Guests && hasAmenities(room, search.AmenityIDs) {
+			room.CreatedAt = time.Time{}
+			room.UpdatedAt = time.Time{}
+			room.Images = nil
+			room.Amenities = append([]models.Amenity(nil), room.Amenities...)
+			room.Units = len(m.units(room.ID))
+			room.FreeUnits = free
+			rooms = append(rooms, room)
+		}
+	}
+
+	sortRooms(rooms)
+
+	return rooms, nil
+}
+
+// hasAmenities reports if a room has every amenity in ids
+func hasAmenities(room models.Room, ids []int) bool {
+	for _, id := range ids {
+		found := false
+		for _, a := range room.Amenities {
+			if a.ID == id {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AllAmenities returns every amenity sorted by name
+func (m *Repo) AllAmenities(ctx context.Context) ([]models.Amenity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var amenities []models.Amenity
+
+	if err := m.fail("AllAmenities"); err != nil {
+		return amenities, err
+	}
+
+	for _, a := range m.amenities {
+		amenities = append(amenities, a)
+	}
+
+	sortAmenities(amenities)
+
+	return amenities, nil
+}
+
+// sortAmenities sorts amenities by name, like the order by of the sql repositories
+func sortAmenities(amenities []models.Amenity) {
+	sort.Slice(amenities, func(i, j int) bool {
+		return amenities[i].Name < amenities[j].Name
+	})
+}
+
+// roomAmenities returns the stored amenities with the ids of amenities, sorted by name. Callers must hold m.mu.
+func (m *Repo) roomAmenities(amenities []models.Amenity) ([]models.Amenity, error) {
+	var ids []int
+	for _, a := range amenities {
+		ids = append(ids, a.ID)
+	}
+
+	var stored []models.Amenity
+	for _, id := range uniqueIDs(ids) {
+		a, ok := m.amenities[id]
+		if !ok {
+			return nil, errors.New("amenity does not exist")
+		}
+		stored = append(stored, a)
+	}
+
+	sortAmenities(stored)
+
+	return stored, nil
+}
+
+// GetRoomByID gets a room by ID, with its images and amenities
+func (m *Repo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("GetRoomByID"); err != nil {
+		return models.Room{}, err
+	}
+
+	room, ok := m.rooms[id]
+	if !ok {
+		return room, sql.ErrNoRows
+	}
+
+	room.Units = len(m.units(room.ID))
+	return copyRoom(room), nil
+}
+
+// GetRoomBySlug returns a room, with its images and amenities, by its slug
+func (m *Repo) GetRoomBySlug(ctx context.Context, slug string) (models.Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("GetRoomBySlug"); err != nil {
+		return models.Room{}, err
+	}
+
+	for _, room := range m.rooms {
+		if room.Slug == slug {
+			room.Units = len(m.units(room.ID))
+			return copyRoom(room), nil
+		}
+	}
+
+	return models.Room{}, sql.ErrNoRows
+}
+
+// copyRoom copies the images and amenities of a room, so callers cannot change the stored room
+func copyRoom(room models.Room) models.Room {
+	room.Images = append([]string(nil), room.Images...)
+	room.Amenities = append([]models.Amenity(nil), room.Amenities...)
+
+	return room
+}
+
+// emailTaken reports if a user other than id has email. Callers must hold m.mu.
+func (m *Repo) emailTaken(email string, id int) bool {
+	for _, user := range m.users {
+		if user.Email == email && user.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// AllUsers returns every user, active or not, by name
+func (m *Repo) AllUsers(ctx context.Context) ([]models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var users []models.User
+
+	if err := m.fail("AllUsers"); err != nil {
+		return users, err
+	}
+
+	for _, user := range m.users {
+		users = append(users, user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].FirstName != users[j].FirstName {
+			return users[i].FirstName < users[j].FirstName
+		}
+		if users[i].LastName != users[j].LastName {
+			return users[i].LastName < users[j].LastName
+		}
+		return users[i].ID < users[j].ID
+	})
+
+	return users, nil
+}
+
+// GetUserByID returns a user by id
+func (m *Repo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("GetUserByID"); err != nil {
+		return models.User{}, err
+	}
+
+	user, ok := m.users[id]
+	if !ok {
+		return user, sql.ErrNoRows
+	}
+
+	return user, nil
+}
+
+// GetUserByPasswordToken returns the user with the password token hash, expired or not, or sql.ErrNoRows
+func (m *Repo) GetUserByPasswordToken(ctx context.Context, hash string) (models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("GetUserByPasswordToken"); err != nil {
+		return models.User{}, err
+	}
+
+	for _, user := range m.users {
+		if hash != "" && user.PasswordTokenHash == hash {
+			return user, nil
+		}
+	}
+
+	return models.User{}, sql.ErrNoRows
+}
+
+// InsertUser adds a user and returns its id, or repository.ErrEmailTaken when another user has the email
+func (m *Repo) InsertUser(ctx context.Context, user models.User) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("InsertUser"); err != nil {
+		return 0, err
+	}
+
+	if m.emailTaken(user.Email, 0) {
+		return 0, repository.ErrEmailTaken
+	}
+
+	user.ID = m.nextID()
+	user.SessionVersion = 1
+	if user.PasswordTokenHash == "" {
+		user.PasswordTokenExpiresAt = time.Time{}
+	}
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = time.Now()
+	m.users[user.ID] = user
+
+	return user.ID, nil
+}
+
+// UpdateUser updates the names, email and access level of a user, returning repository.ErrEmailTaken when
+// another user has the email
+func (m *Repo) UpdateUser(ctx context.Context, user models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("UpdateUser"); err != nil {
+		return err
+	}
+
+	u, ok := m.users[user.ID]
+	if !ok {
+		return nil
+	}
+
+	if m.emailTaken(user.Email, user.ID) {
+		return repository.ErrEmailTaken
+	}
+
+	u.FirstName = user.FirstName
+	u.LastName = user.LastName
+	u.Email = user.Email
+	u.AccessLevel = user.AccessLevel
+	u.UpdatedAt = time.Now()
+	m.users[u.ID] = u
+
+	return nil
+}
+
+// UpdateUserActive activates or deactivates a user, deactivated users cannot log in and their sessions end
+func (m *Repo) UpdateUserActive(ctx context.Context, id int, active bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("UpdateUserActive"); err != nil {
+		return err
+	}
+
+	if u, ok := m.users[id]; ok {
+		u.Active = active
+		if !active {
+			u.SessionVersion++
+		}
+		u.UpdatedAt = time.Now()
+		m.users[id] = u
+	}
+
+	return nil
+}
+
+// ResetPassword clears the password of a user and ends their sessions, so they cannot log in until they set a new
+// one with the token until expiresAt
+func (m *Repo) ResetPassword(ctx context.Context, id int, tokenHash string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("ResetPassword"); err != nil {
+		return err
+	}
+
+	if u, ok := m.users[id]; ok {
+		u.Password = ""
+		u.PasswordTokenHash = tokenHash
+		u.PasswordTokenExpiresAt = expiresAt
+		u.SessionVersion++
+		u.UpdatedAt = time.Now()
+		m.users[id] = u
+	}
+
+	return nil
+}
+
+// UpdatePassword sets the hashed password of a user, clears their password token and ends their sessions
+func (m *Repo) UpdatePassword(ctx context.Context, id int, hashedPassword string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("UpdatePassword"); err != nil {
+		return err
+	}
+
+	if u, ok := m.users[id]; ok {
+		u.Password = hashedPassword
+		u.PasswordTokenHash = ""
+		u.PasswordTokenExpiresAt = time.Time{}
+		u.SessionVersion++
+		u.UpdatedAt = time.Now()
+		m.users[id] = u
+	}
+
+	return nil
+}
+
+// Authenticate authenticates an active user
+func (m *Repo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("Authenticate"); err != nil {
+		return 0, "", err
+	}
+
+	for _, user := range m.users {
+		if user.Email != email || !user.Active {
+			continue
+		}
+
+		// a user whose password was reset has none until they set a new one
+		if user.Password == "" {
+			return 0, "", errors.New("password was reset")
+		}
+
+		err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(testPassword))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return 0, "", errors.New("incorrect password")
+		} else if err != nil {
+			return 0, "", err
+		}
+
+		return user.ID, user.Password, nil
+	}
+
+	return 0, "", sql.ErrNoRows
+}
+
+// AllAPIKeys returns every api key, the newest first
+func (m *Repo) AllAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []models.APIKey
+
+	if err := m.fail("AllAPIKeys"); err != nil {
+		return keys, err
+	}
+
+	for _, key := range m.apiKeys {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID > keys[j].ID
+	})
+
+	return keys, nil
+}
+
+// GetAPIKeyByHash returns the api key with the hash, revoked or not, or sql.ErrNoRows
+func (m *Repo) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("GetAPIKeyByHash"); err != nil {
+		return models.APIKey{}, err
+	}
+
+	for _, key := range m.apiKeys {
+		if key.KeyHash == hash {
+			return key, nil
+		}
+	}
+
+	return models.APIKey{}, sql.ErrNoRows
+}
+
+// InsertAPIKey adds an api key and returns its id
+func (m *Repo) InsertAPIKey(ctx context.Context, key models.APIKey) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("InsertAPIKey"); err != nil {
+		return 0, err
+	}
+
+	// like the unique index and check constraint of api_keys
+	for _, existing := range m.apiKeys {
+		if existing.KeyHash == key.KeyHash {
+			return 0, errors.New("api key already exists")
+		}
+	}
+	if !apikeys.ValidScope(key.Scope) {
+		return 0, errors.New("invalid api key scope")
+	}
+
+	key.ID = m.nextID()
+	key.LastUsedAt = time.Time{}
+	key.RevokedAt = time.Time{}
+	key.CreatedAt = time.Now()
+	key.UpdatedAt = time.Now()
+	m.apiKeys[key.ID] = key
+
+	return key.ID, nil
+}
+
+// RevokeAPIKey stops an api key from being used. Revoking a revoked key keeps when it was first revoked.
+func (m *Repo) RevokeAPIKey(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("RevokeAPIKey"); err != nil {
+		return err
+	}
+
+	key, ok := m.apiKeys[id]
+	if ok && key.RevokedAt.IsZero() {
+		key.RevokedAt = time.Now()
+		key.UpdatedAt = key.RevokedAt
+		m.apiKeys[id] = key
+	}
+
+	return nil
+}
+
+// UpdateAPIKeyLastUsed records when an api key was last used
+func (m *Repo) UpdateAPIKeyLastUsed(ctx context.Context, id int, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("UpdateAPIKeyLastUsed"); err != nil {
+		return err
+	}
+
+	if key, ok := m.apiKeys[id]; ok {
+		key.LastUsedAt = at
+		m.apiKeys[id] = key
+	}
+
+	return nil
+}
+
+// AllWebhooks returns every webhook, the newest first
+func (m *Repo) AllWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var hooks []models.Webhook
+
+	if err := m.fail("AllWebhooks"); err != nil {
+		return hooks, err
+	}
+
+	for _, hook := range m.webhooks {
+		hooks = append(hooks, hook)
+	}
+
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].ID > hooks[j].ID
+	})
+
+	return hooks, nil
+}
+
+// InsertWebhook adds a webhook and returns its id
+func (m *Repo) InsertWebhook(ctx context.Context, hook models.Webhook) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("InsertWebhook"); err != nil {
+		return 0, err
+	}
+
+	hook.ID = m.nextID()
+	hook.Events = append([]string(nil), hook.Events...)
+	hook.CreatedAt = time.Now()
+	hook.UpdatedAt = time.Now()
+	m.webhooks[hook.ID] = hook
+
+	return hook.ID, nil
+}
+
+// DeleteWebhook deletes a webhook and its deliveries
+func (m *Repo) DeleteWebhook(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("DeleteWebhook"); err != nil {
+		return err
+	}
+
+	// like the on delete cascade of webhook_deliveries
+	for deliveryID, d := range m.deliveries {
+		if d.WebhookID == id {
+			delete(m.deliveries, deliveryID)
+		}
+	}
+	delete(m.webhooks, id)
+
+	return nil
+}
+
+// InsertWebhookDeliveries queues the payload of an event for every webhook subscribed to it, due now, and
+// returns how many were queued
+func (m *Repo) InsertWebhookDeliveries(ctx context.Context, event, payload string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("InsertWebhookDeliveries"); err != nil {
+		return 0, err
+	}
+
+	var ids []int
+	for id, hook := range m.webhooks {
+		for _, e := range hook.Events {
+			if e == event {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	sort.Ints(ids)
+
+	now := time.Now()
+	for _, id := range ids {
+		d := models.WebhookDelivery{
+			ID:            m.nextID(),
+			WebhookID:     id,
+			Event:         event,
+			Payload:       payload,
+			Status:        webhooks.StatusPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		m.deliveries[d.ID] = d
+	}
+
+	return len(ids), nil
+}
+
+// withWebhook returns d with the url and secret of its webhook. Callers must hold m.mu.
+func (m *Repo) withWebhook(d models.WebhookDelivery) models.WebhookDelivery {
+	hook := m.webhooks[d.WebhookID]
+	d.Webhook = models.Webhook{ID: hook.ID, URL: hook.URL, Secret: hook.Secret}
+	return d
+}
+
+// ClaimWebhookDeliveries claims up to limit pending deliveries due at now, the longest waiting first, by moving
+// their next attempt lease later
+func (m *Repo) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deliveries []models.WebhookDelivery
+
+	if err := m.fail("ClaimWebhookDeliveries"); err != nil {
+		return deliveries, err
+	}
+
+	for _, d := range m.deliveries {
+		if d.Status == webhooks.StatusPending && !d.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, d)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].NextAttemptAt.Equal(deliveries[j].NextAttemptAt) {
+			return deliveries[i].NextAttemptAt.Before(deliveries[j].NextAttemptAt)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	for i, d := range deliveries {
+		d.NextAttemptAt = now.Add(lease)
+		d.UpdatedAt = time.Now()
+		m.deliveries[d.ID] = d
+		deliveries[i] = m.withWebhook(d)
+	}
+
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery records the outcome of an attempt to send a delivery
+func (m *Repo) UpdateWebhookDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("UpdateWebhookDelivery"); err != nil {
+		return err
+	}
+
+	existing, ok := m.deliveries[d.ID]
+	if !ok {
+		return nil
+	}
+
+	existing.Status = d.Status
+	existing.Attempts = d.Attempts
+	existing.StatusCode = d.StatusCode
+	existing.Error = d.Error
+	existing.NextAttemptAt = d.NextAttemptAt
+	existing.DeliveredAt = d.DeliveredAt
+	existing.UpdatedAt = time.Now()
+	m.deliveries[d.ID] = existing
+
+	return nil
+}
+
+// RecentWebhookDeliveries returns the last limit deliveries, the newest first
+func (m *Repo) RecentWebhookDeliveries(ctx context.Context, limit int) ([]models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deliveries []models.WebhookDelivery
+
+	if err := m.fail("RecentWebhookDeliveries"); err != nil {
+		return deliveries, err
+	}
+
+	for _, d := range m.deliveries {
+		deliveries = append(deliveries, m.withWebhook(d))
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].ID > deliveries[j].ID
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+// AllReservations returns a slice of all reservations
+func (m *Repo) AllReservations(ctx context.Context) ([]models.Reservation, error) {
+	return m.reservationsWhere("AllReservations", func(models.Reservation) bool { return true })
+}
+
+// AllNewReservations returns a slice of all reservations
+func (m *Repo) AllNewReservations(ctx context.Context) ([]models.Reservation, error) {
+	return m.reservationsWhere("AllNewReservations", func(res models.Reservation) bool { return res.Processed == 0 })
+}
+
+// reservationsWhere returns the reservations matching keep, ordered by start date like the sql repositories
+func (m *Repo) reservationsWhere(method string, keep func(models.Reservation) bool) ([]models.Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var reservations []models.Reservation
+
+	if err := m.fail(method); err != nil {
+		return reservations, err
+	}
+
+	for _, res := range m.reservations {
+		if keep(res) {
+			reservations = append(reservations, m.withRoom(res))
+		}
+	}
+
+	sort.Slice(reservations, func(i, j int) bool {
+		if reservations[i].StartDate.Equal(reservations[j].StartDate) {
+			return reservations[i].ID < reservations[j].ID
+		}
+		return reservations[i].StartDate.Before(reservations[j].StartDate)
+	})
+
+	return reservations, nil
+}
+
+// GetReservationById returns one reservation by ID
+func (m *Repo) GetReservationById(ctx context.Context, id int) (models.Reservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("GetReservationById"); err != nil {
+		return models.Reservation{}, err
+	}
+
+	res, ok := m.reservations[id]
+	if !ok {
+		return res, sql.ErrNoRows
+	}
+
+	for _, r := range m.roomRestrictions {
+		if r.ReservationID == id {
+			unit := m.roomUnits[r.UnitID]
+			res.Unit = models.RoomUnit{ID: unit.ID, Name: unit.Name}
+		}
+	}
+
+	return m.withRoom(res), nil
+}
+
+// UpdateReservation updates the guest details of a reservation
+func (m *Repo) UpdateReservation(ctx context.Context, reservation models.Reservation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("UpdateReservation"); err != nil {
+		return err
+	}
+
+	res, ok := m.reservations[reservation.ID]
+	if !ok {
+		return nil
+	}
+
+	res.FirstName = reservation.FirstName
+	res.LastName = reservation.LastName
+	res.Email = reservation.Email
+	res.Phone = reservation.Phone
+	res.UpdatedAt = time.Now()
+	m.reservations[res.ID] = res
+
+	return nil
+}
+
+// DeleteReservation deletes one reservation by ID, along with its room restriction
+func (m *Repo) DeleteReservation(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("DeleteReservation"); err != nil {
+		return err
+	}
+
+	m.deleteReservation(id)
+
+	return nil
+}
+
+// deleteReservation deletes a reservation and its room restriction. Callers must hold m.mu.
+func (m *Repo) deleteReservation(id int) {
+	delete(m.reservations, id)
+	for rid, r := range m.roomRestrictions {
+		if r.ReservationID == id {
+			delete(m.roomRestrictions, rid)
+		}
+	}
+}
+
+// UpdateProcessedForReservation updates processed for a reservation by ID
+func (m *Repo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("UpdateProcessedForReservation"); err != nil {
+		return err
+	}
+
+	res, ok := m.reservations[id]
+	if !ok {
+		return nil
+	}
+
+	res.Processed = processed
+	m.reservations[id] = res
+
+	return nil
+}
+
+// AllRooms returns a slice with all rooms
+func (m *Repo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var rooms []models.Room
+
+	if err := m.fail("AllRooms"); err != nil {
+		return rooms, err
+	}
+
+	for _, room := range m.rooms {
+		room.Images = nil
+		room.Amenities = nil
+		room.Units = len(m.units(room.ID))
+		rooms = append(rooms, room)
+	}
+
+	sortRooms(rooms)
+
+	return rooms, nil
+}
+
+// sortRooms puts rooms in display order, like the order by of the sql repositories
+func sortRooms(rooms []models.Room) {
+	sort.Slice(rooms, func(i, j int) bool {
+		if rooms[i].SortOrder == rooms[j].SortOrder {
+			return rooms[i].RoomName < rooms[j].RoomName
+		}
+		return rooms[i].SortOrder < rooms[j].SortOrder
+	})
+}
+
+// InsertRoom inserts a room, its images, its amenities and its first unit, placing it after the other rooms
+func (m *Repo) InsertRoom(ctx context.Context, room models.Room) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("InsertRoom"); err != nil {
+		return 0, err
+	}
+
+	for _, r := range m.rooms {
+		if r.Slug == room.Slug {
+			return 0, errors.New("duplicate room slug")
+		}
+		if r.SortOrder >= room.SortOrder {
+			room.SortOrder = r.SortOrder + 1
+		}
+	}
+
+	amenities, err := m.roomAmenities(room.Amenities)
+	if err != nil {
+		return 0, err
+	}
+
+	room.ID = m.nextID()
+	room.Images = append([]string(nil), room.Images...)
+	room.Amenities = amenities
+	room.Units = 0
+	room.FreeUnits = 0
+	room.CreatedAt = time.Now()
+	room.UpdatedAt = time.Now()
+	m.rooms[room.ID] = room
+
+	// every room starts with one unit, named after it
+	unitID := m.nextID()
+	m.roomUnits[unitID] = models.RoomUnit{
+		ID:        unitID,
+		RoomID:    room.ID,
+		Name:      room.RoomName,
+		SortOrder: 1,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	return room.ID, nil
+}
+
+// UpdateRoom updates the details, images and amenities of a room
+func (m *Repo) UpdateRoom(ctx context.Context, room models.Room) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("UpdateRoom"); err != nil {
+		return err
+	}
+
+	r, ok := m.rooms[room.ID]
+	if !ok {
+		return nil
+	}
+
+	for _, other := range m.rooms {
+		if other.ID != room.ID && other.Slug == room.Slug {
+			return errors.New("duplicate room slug")
+		}
+	}
+
+	r.RoomName = room.RoomName
+	r.Slug = room.Slug
+	r.Description = room.Description
+	r.Active = room.Active
+	r.NightlyRate = room.NightlyRate
+	r.WeekendRate = room.WeekendRate
+	r.MaxOccupancy = room.MaxOccupancy
+	amenities, err := m.roomAmenities(room.Amenities)
+	if err != nil {
+		return err
+	}
+
+	r.Images = append([]string(nil), room.Images...)
+	r.Amenities = amenities
+	r.UpdatedAt = time.Now()
+	m.rooms[r.ID] = r
+
+	return nil
+}
+
+// UpdateRoomActive activates or deactivates a room
+func (m *Repo) UpdateRoomActive(ctx context.Context, id int, active bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("UpdateRoomActive"); err != nil {
+		return err
+	}
+
+	room, ok := m.rooms[id]
+	if !ok {
+		return nil
+	}
+
+	room.Active = active
+	room.UpdatedAt = time.Now()
+	m.rooms[id] = room
+
+	return nil
+}
+
+// UpdateRoomOrder sets the display order of rooms to the order of ids
+func (m *Repo) UpdateRoomOrder(ctx context.Context, ids []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("UpdateRoomOrder"); err != nil {
+		return err
+	}
+
+	for i, id := range ids {
+		room, ok := m.rooms[id]
+		if !ok {
+			continue
+		}
+		room.SortOrder = i + 1
+		m.rooms[id] = room
+	}
+
+	return nil
+}
+
+// DeleteRoom deletes a room with its past reservations and restrictions, unless guests are booked from today on
+func (m *Repo) DeleteRoom(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("DeleteRoom"); err != nil {
+		return err
+	}
+
+	today := time.Now().Truncate(24 * time.Hour)
+	for _, res := range m.reservations {
+		if res.RoomID == id && res.EndDate.After(today) {
+			return repository.ErrRoomHasReservations
+		}
+	}
+
+	delete(m.rooms, id)
+	for rid, res := range m.reservations {
+		if res.RoomID == id {
+			delete(m.reservations, rid)
+		}
+	}
+	for rid, r := range m.roomRestrictions {
+		if r.RoomID == id {
+			delete(m.roomRestrictions, rid)
+		}
+	}
+	for rid, r := range m.roomRates {
+		if r.RoomID == id {
+			delete(m.roomRates, rid)
+		}
+	}
+	for uid, u := range m.roomUnits {
+		if u.RoomID == id {
+			delete(m.roomUnits, uid)
+		}
+	}
+	for rid, r := range m.stayRules {
+		if r.RoomID == id {
+			delete(m.stayRules, rid)
+		}
+	}
+
+	return nil
+}
+
+// AllRoomRates returns every rate override of a room by start date
+func (m *Repo) AllRoomRates(ctx context.Context, roomID int) ([]models.RoomRate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("AllRoomRates"); err != nil {
+		return nil, err
+	}
+
+	return m.roomRatesWhere(func(r models.RoomRate) bool {
+		return r.RoomID == roomID
+	}), nil
+}
+
+// GetRoomRates returns the rate overrides of a room that cover any night from start up to end
+func (m *Repo) GetRoomRates(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("GetRoomRates"); err != nil {
+		return nil, err
+	}
+
+	return m.roomRatesWhere(func(r models.RoomRate) bool {
+		return r.RoomID == roomID && start.Before(r.EndDate) && end.After(r.StartDate)
+	}), nil
+}
+
+// roomRatesWhere returns the room rates matching keep, by start date. Callers must hold m.mu.
+func (m *Repo) roomRatesWhere(keep func(models.RoomRate) bool) []models.RoomRate {
+	var rates []models.RoomRate
+	for _, r := range m.roomRates {
+		if keep(r) {
+			rates = append(rates, r)
+		}
+	}
+
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].StartDate.Equal(rates[j].StartDate) {
+			return rates[i].ID < rates[j].ID
+		}
+		return rates[i].StartDate.Before(rates[j].StartDate)
+	})
+
+	return rates
+}
+
+// InsertRoomRate inserts a rate override for a room
+func (m *Repo) InsertRoomRate(ctx context.Context, rate models.RoomRate) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("InsertRoomRate"); err != nil {
+		return 0, err
+	}
+
+	if _, ok := m.rooms[rate.RoomID]; !ok {
+		return 0, errors.New("rate for a room that does not exist")
+	}
+
+	rate.ID = m.nextID()
+	rate.CreatedAt = time.Now()
+	rate.UpdatedAt = time.Now()
+	m.roomRates[rate.ID] = rate
+
+	return rate.ID, nil
+}
+
+// DeleteRoomRate deletes a rate override
+func (m *Repo) DeleteRoomRate(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("DeleteRoomRate"); err != nil {
+		return err
+	}
+
+	delete(m.roomRates, id)
+
+	return nil
+}
+
+// AllRoomUnits returns the units of a room in display order
+func (m *Repo) AllRoomUnits(ctx context.Context, roomID int) ([]models.RoomUnit, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("AllRoomUnits"); err != nil {
+		return nil, err
+	}
+
+	return m.units(roomID), nil
+}
+
+// InsertRoomUnit adds a unit to a room, after its other units, and returns its id
+func (m *Repo) InsertRoomUnit(ctx context.Context, unit models.RoomUnit) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("InsertRoomUnit"); err != nil {
+		return 0, err
+	}
+
+	if _, ok := m.rooms[unit.RoomID]; !ok {
+		return 0, errors.New("unit for a room that does not exist")
+	}
+
+	unit.SortOrder = 1
+	for _, u := range m.units(unit.RoomID) {
+		if u.SortOrder >= unit.SortOrder {
+			unit.SortOrder = u.SortOrder + 1
+		}
+	}
+
+	unit.ID = m.nextID()
+	unit.CreatedAt = time.Now()
+	unit.UpdatedAt = time.Now()
+	m.roomUnits[unit.ID] = unit
+
+	return unit.ID, nil
+}
+
+// DeleteRoomUnit deletes a unit and its past reservations' restrictions. A unit with future reservations
+// cannot be deleted.
+func (m *Repo) DeleteRoomUnit(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("DeleteRoomUnit"); err != nil {
+		return err
+	}
+
+	today := time.Now().Truncate(24 * time.Hour)
+	for _, r := range m.roomRestrictions {
+		if r.UnitID == id && r.ReservationID > 0 && r.EndDate.After(today) {
+			return repository.ErrRoomHasReservations
+		}
+	}
+
+	delete(m.roomUnits, id)
+	for rid, r := range m.roomRestrictions {
+		if r.UnitID == id {
+			delete(m.roomRestrictions, rid)
+		}
+	}
+
+	return nil
+}
+
+// AllStayRules returns every stay rule of a room by start date
+func (m *Repo) AllStayRules(ctx context.Context, roomID int) ([]models.StayRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("AllStayRules"); err != nil {
+		return nil, err
+	}
+
+	return m.stayRulesWhere(func(r models.StayRule) bool {
+		return r.RoomID == roomID
+	}), nil
+}
+
+// GetStayRules returns the stay rules of a room in force on any date from start up to and including end,
+// so rules on the departure date are included
+func (m *Repo) GetStayRules(ctx context.Context, roomID int, start, end time.Time) ([]models.StayRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("GetStayRules"); err != nil {
+		return nil, err
+	}
+
+	return m.stayRulesWhere(func(r models.StayRule) bool {
+		return r.RoomID == roomID && start.Before(r.EndDate) && !end.Before(r.StartDate)
+	}), nil
+}
+
+// stayRulesWhere returns the stay rules matching keep, by start date. Callers must hold m.mu.
+func (m *Repo) stayRulesWhere(keep func(models.StayRule) bool) []models.StayRule {
+	var rules []models.StayRule
+	for _, r := range m.stayRules {
+		if keep(r) {
+			rules = append(rules, r)
+		}
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].StartDate.Equal(rules[j].StartDate) {
+			return rules[i].ID < rules[j].ID
+		}
+		return rules[i].StartDate.Before(rules[j].StartDate)
+	})
+
+	return rules
+}
+
+// InsertStayRule inserts a stay rule for a room
+func (m *Repo) InsertStayRule(ctx context.Context, rule models.StayRule) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("InsertStayRule"); err != nil {
+		return 0, err
+	}
+
+	if _, ok := m.rooms[rule.RoomID]; !ok {
+		return 0, errors.New("stay rule for a room that does not exist")
+	}
+
+	rule.ID = m.nextID()
+	rule.CreatedAt = time.Now()
+	rule.UpdatedAt = time.Now()
+	m.stayRules[rule.ID] = rule
+
+	return rule.ID, nil
+}
+
+// DeleteStayRule deletes a stay rule
+func (m *Repo) DeleteStayRule(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("DeleteStayRule"); err != nil {
+		return err
+	}
+
+	delete(m.stayRules, id)
+
+	return nil
+}
+
+// GetRestrictions returns restrictions for a room by date range
+func (m *Repo) GetRestrictions(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var restrictions []models.RoomRestriction
+
+	if err := m.fail("GetRestrictions"); err != nil {
+		return nil, err
+	}
+
+	// same bounds as the sql query: $1 < end_date and $2 >= start_date
+	for _, r := range m.roomRestrictions {
+		if r.RoomID == roomID && start.Before(r.EndDate) && !end.Before(r.StartDate) {
+			r.Restriction = m.restrictions[r.RestrictionID]
+			unit := m.roomUnits[r.UnitID]
+			r.Unit = models.RoomUnit{ID: unit.ID, Name: unit.Name}
+			restrictions = append(restrictions, r)
+		}
+	}
+
+	sort.Slice(restrictions, func(i, j int) bool {
+		return restrictions[i].StartDate.Before(restrictions[j].StartDate)
+	})
+
+	return restrictions, nil
+}
+
+// GetRestrictionsForAllRooms returns the restrictions of every room that take up a night in the date range, of
+// every type, since each takes its unit
+func (m *Repo) GetRestrictionsForAllRooms(ctx context.Context, start, end time.Time) ([]models.RoomRestriction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var restrictions []models.RoomRestriction
+
+	if err := m.fail("GetRestrictionsForAllRooms"); err != nil {
+		return nil, err
+	}
+
+	for _, r := range m.roomRestrictions {
+		if start.Before(r.EndDate) && end.After(r.StartDate) {
+			restrictions = append(restrictions, r)
+		}
+	}
+
+	sort.Slice(restrictions, func(i, j int) bool {
+		if restrictions[i].RoomID == restrictions[j].RoomID {
+			return restrictions[i].StartDate.Before(restrictions[j].StartDate)
+		}
+		return restrictions[i].RoomID < restrictions[j].RoomID
+	})
+
+	return restrictions, nil
+}
+
+// AllRestrictions returns all restriction types
+func (m *Repo) AllRestrictions(ctx context.Context) ([]models.Restriction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var restrictions []models.Restriction
+
+	if err := m.fail("AllRestrictions"); err != nil {
+		return restrictions, err
+	}
+
+	for _, r := range m.restrictions {
+		restrictions = append(restrictions, r)
+	}
+
+	sort.Slice(restrictions, func(i, j int) bool {
+		return restrictions[i].ID < restrictions[j].ID
+	})
+
+	return restrictions, nil
+}
+
+// GetRestrictionByID returns a restriction type by id
+func (m *Repo) GetRestrictionByID(ctx context.Context, id int) (models.Restriction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("GetRestrictionByID"); err != nil {
+		return models.Restriction{}, err
+	}
+
+	r, ok := m.restrictions[id]
+	if !ok {
+		return r, sql.ErrNoRows
+	}
+
+	return r, nil
+}
+
+// InsertRestriction inserts a restriction type for blocking rooms and returns its id
+func (m *Repo) InsertRestriction(ctx context.Context, r models.Restriction) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("InsertRestriction"); err != nil {
+		return 0, err
+	}
+
+	r.ID = m.nextID()
+	r.ForReservations = false
+	r.CreatedAt = time.Now()
+	r.UpdatedAt = time.Now()
+	m.restrictions[r.ID] = r
+
+	return r.ID, nil
+}
+
+// UpdateRestriction updates the name, colour and occupancy of a restriction type
+func (m *Repo) UpdateRestriction(ctx context.Context, r models.Restriction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("UpdateRestriction"); err != nil {
+		return err
+	}
+
+	existing, ok := m.restrictions[r.ID]
+	if !ok {
+		return nil
+	}
+
+	existing.RestrictionName = r.RestrictionName
+	existing.Colour = r.Colour
+	existing.CountsTowardOccupancy = r.CountsTowardOccupancy
+	existing.UpdatedAt = time.Now()
+	m.restrictions[r.ID] = existing
+
+	return nil
+}
+
+// DeleteRestriction deletes a restriction type. The type used for reservations, and types that rooms are
+// restricted with, cannot be deleted.
+func (m *Repo) DeleteRestriction(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("DeleteRestriction"); err != nil {
+		return err
+	}
+
+	if m.restrictions[id].ForReservations {
+		return repository.ErrRestrictionInUse
+	}
+
+	for _, r := range m.roomRestrictions {
+		if r.RestrictionID == id {
+			return repository.ErrRestrictionInUse
+		}
+	}
+
+	delete(m.restrictions, id)
+
+	return nil
+}
+
+// InsertBlockForUnit blocks a unit for one night with the first restriction type that is not for reservations
+func (m *Repo) InsertBlockForUnit(ctx context.Context, unitID int, startDate time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("InsertBlockForUnit"); err != nil {
+		return err
+	}
+
+	restrictionID := 0
+	for id, r := range m.restrictions {
+		if !r.ForReservations && (restrictionID == 0 || id < restrictionID) {
+			restrictionID = id
+		}
+	}
+
+	if restrictionID == 0 {
+		return errors.New("there is no restriction type for blocking rooms")
+	}
+
+	if _, ok := m.roomUnits[unitID]; !ok {
+		return errors.New("block for a unit that does not exist")
+	}
+
+	return m.insertRoomRestriction(models.RoomRestriction{
+		StartDate:     startDate,
+		EndDate:       startDate.AddDate(0, 0, 1),
+		UnitID:        unitID,
+		RestrictionID: restrictionID,
+	})
+}
+
+// InsertBlock blocks a unit from the start date up to, but not including, the end date. Without a unit it
+// blocks the first unit of the room that is free for those dates.
+func (m *Repo) InsertBlock(ctx context.Context, block models.RoomRestriction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("InsertBlock"); err != nil {
+		return err
+	}
+
+	if _, ok := m.restrictions[block.RestrictionID]; !ok {
+		return errors.New("block with a restriction that does not exist")
+	}
+
+	if _, ok := m.roomUnits[block.UnitID]; block.UnitID != 0 && !ok {
+		return errors.New("block for a unit that does not exist")
+	}
+
+	block.ReservationID = 0
+	return m.insertRoomRestriction(block)
+}
+
+// DeleteBlockByID deletes the room restriction
+func (m *Repo) DeleteBlockByID(ctx context.Context, roomID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.fail("DeleteBlockByID"); err != nil {
+		return err
+	}
+
+	delete(m.roomRestrictions, roomID)
+
+	return nil
+}
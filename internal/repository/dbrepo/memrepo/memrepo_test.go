@@ -0,0 +1,33 @@
+package memrepo
+
+import (
+	"context"
+	"errors"
+	"github.com/FilipeParreiras/Bookings/internal/config"
+	"testing"
+)
+
+func TestRepo_FailOn(t *testing.T) {
+	repo := New(&config.AppConfig{})
+	ctx := context.Background()
+
+	injected := errors.New("connection reset")
+	repo.FailOn("GetRoomByID", injected)
+
+	_, err := repo.GetRoomByID(ctx, 1)
+	if err != injected {
+		t.Errorf("expected the injected error but got %v", err)
+	}
+
+	_, err = repo.AllRooms(ctx)
+	if err != nil {
+		t.Errorf("a method without an injected error failed: %v", err)
+	}
+
+	repo.ClearFailures()
+
+	_, err = repo.GetRoomByID(ctx, 1)
+	if err != nil {
+		t.Errorf("GetRoomByID still fails after ClearFailures: %v", err)
+	}
+}
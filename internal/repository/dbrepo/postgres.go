@@ -1,33 +1,185 @@
 package dbrepo
 
 import (
-	context2 "context"
+	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/FilipeParreiras/Bookings/internal/models"
+	"github.com/FilipeParreiras/Bookings/internal/repository"
+	"github.com/FilipeParreiras/Bookings/internal/webhooks"
 	"golang.org/x/crypto/bcrypt"
 	"log"
+	"strings"
 	"time"
 )
 
-func (m *postgresDBRepo) AllUsers() bool {
-	return true
+// InsertReservationWithRestriction inserts a reservation and the room restriction that blocks its dates in one
+// serializable transaction, so a booking never exists without its restriction. It returns a *repository.ConflictError
+// if the dates were taken since the guest searched for them.
+func (m *postgresDBRepo) InsertReservationWithRestriction(ctx context.Context, reservation models.Reservation) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return 0, err
+	}
+	// rollback is a no-op once the transaction is committed
+	defer tx.Rollback()
+
+	newID, err := insertReservationTx(ctx, tx, reservation)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, bookingError(err, conflictFor(reservation))
+	}
+
+	return newID, nil
 }
 
-// InsertReservation inserts a reservation into the database
-func (m *postgresDBRepo) InsertReservation(reservation models.Reservation) (int, error) {
+// InsertBooking inserts the reservations of a split stay, and the room restrictions that block their dates, under
+// one booking in one serializable transaction. It returns the id of the booking, or a *repository.ConflictError for
+// the first reservation whose dates were taken since the guest searched for them.
+func (m *postgresDBRepo) InsertBooking(ctx context.Context, reservations []models.Reservation) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var bookingID int
+
+	err = tx.QueryRowContext(ctx, `insert into bookings (created_at, updated_at) values ($1, $2) returning id`,
+		time.Now(), time.Now()).Scan(&bookingID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, reservation := range reservations {
+		reservation.BookingID = bookingID
+		_, err = insertReservationTx(ctx, tx, reservation)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, bookingError(err, conflictFor(reservations[0]))
+	}
+
+	return bookingID, nil
+}
 
-	// makes sure that this transaction does not be opened for a long period of time
-	// (can happen if anything is wrong)
-	context, cancel := context2.WithTimeout(context2.Background(), 3*time.Second)
+// GetBookingByID returns a booking with its reservations in the order the guest stays in them
+func (m *postgresDBRepo) GetBookingByID(ctx context.Context, id int) (models.Booking, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
+	var booking models.Booking
+
+	err := m.DB.QueryRowContext(ctx, `select id, created_at, updated_at from bookings where id = $1`, id).Scan(
+		&booking.ID,
+		&booking.CreatedAt,
+		&booking.UpdatedAt,
+	)
+	if err != nil {
+		return booking, err
+	}
+
+	query := `
+			select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id,
+			r.created_at, r.updated_at, r.processed, r.total_price, r.adults, r.children, r.booking_id, rm.id,
+			rm.room_name
+			from reservations r
+			left join rooms rm on (r.room_id = rm.id)
+			where r.booking_id = $1
+			order by r.start_date
+		`
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return booking, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Processed,
+			&i.TotalPrice,
+			&i.Adults,
+			&i.Children,
+			&i.BookingID,
+			&i.Room.ID,
+			&i.Room.RoomName,
+		)
+		if err != nil {
+			return booking, err
+		}
+		booking.Reservations = append(booking.Reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return booking, err
+	}
+
+	return booking, nil
+}
+
+// conflictFor returns the error for a reservation whose dates were taken
+func conflictFor(reservation models.Reservation) *repository.ConflictError {
+	return &repository.ConflictError{
+		RoomID:    reservation.RoomID,
+		StartDate: reservation.StartDate,
+		EndDate:   reservation.EndDate,
+	}
+}
+
+// insertReservationTx inserts a reservation on the first unit of its room that is free for the whole stay, and the
+// room restriction that blocks its dates. It returns a *repository.ConflictError when every unit is taken.
+func insertReservationTx(ctx context.Context, tx *sql.Tx, reservation models.Reservation) (int, error) {
+	conflict := conflictFor(reservation)
+
+	// the guest is given the first unit of the room that is free for the whole stay
+	unitID, err := freeUnit(ctx, tx, reservation.RoomID, reservation.StartDate, reservation.EndDate)
+	if err != nil {
+		return 0, bookingError(err, conflict)
+	}
+
+	if unitID == 0 {
+		return 0, conflict
+	}
+
+	var bookingID interface{}
+	if reservation.BookingID > 0 {
+		bookingID = reservation.BookingID
+	}
+
 	var newID int
 
 	statement := `insert into reservations (first_name, last_name, email, phone, start_date, end_date, 
-                          room_id, created_at, updated_at)
-                          values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+                          room_id, total_price, adults, children, booking_id, created_at, updated_at)
+                          values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) returning id`
 
-	err := m.DB.QueryRowContext(context, statement,
+	err = tx.QueryRowContext(ctx, statement,
 		reservation.FirstName,
 		reservation.LastName,
 		reservation.Email,
@@ -35,96 +187,151 @@ func (m *postgresDBRepo) InsertReservation(reservation models.Reservation) (int,
 		reservation.StartDate,
 		reservation.EndDate,
 		reservation.RoomID,
+		reservation.TotalPrice,
+		reservation.Adults,
+		reservation.Children,
+		bookingID,
 		time.Now(),
 		time.Now(),
 	).Scan(&newID)
 	if err != nil {
-		return 0, err
+		return 0, bookingError(err, conflict)
 	}
 
-	return newID, nil
-}
-
-// InsertRoomRestriction inserts a room restriction into the database
-func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
-	context, cancel := context2.WithTimeout(context2.Background(), 3*time.Second)
-	defer cancel()
-
-	statement := `insert into room_restrictions (start_date, end_date, room_id, reservation_id,
+	statement = `insert into room_restrictions (start_date, end_date, room_id, unit_id, reservation_id,
                                created_at, updated_at, restriction_id)
-                               values ($1, $2, $3, $4, $5, $6, $7)`
+                               values ($1, $2, $3, $4, $5, $6, $7,
+                                       (select id from restrictions where for_reservations = true))`
 
-	_, err := m.DB.ExecContext(context, statement,
-		r.StartDate,
-		r.EndDate,
-		r.RoomID,
-		r.ReservationID,
+	_, err = tx.ExecContext(ctx, statement,
+		reservation.StartDate,
+		reservation.EndDate,
+		reservation.RoomID,
+		unitID,
+		newID,
 		time.Now(),
 		time.Now(),
-		r.RestrictionID,
 	)
 	if err != nil {
-		return err
+		return 0, bookingError(err, conflict)
 	}
 
-	return nil
+	return newID, nil
 }
 
-// SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID and false otherwise
-func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
-	context, cancel := context2.WithTimeout(context2.Background(), 3*time.Second)
-	defer cancel()
+// bookingError returns conflict if err means the room was taken by a concurrent booking, and err unchanged otherwise
+func bookingError(err error, conflict *repository.ConflictError) error {
+	if isOverlap(err) {
+		return conflict
+	}
+	return err
+}
 
-	var numRows int
+// rowQuerier is implemented by both *sql.DB and *sql.Tx
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// freeUnit returns the first unit of a room, in display order, that has no restriction from start up to end,
+// or 0 when every unit is taken
+func freeUnit(ctx context.Context, q rowQuerier, roomID int, start, end time.Time) (int, error) {
+	var unitID int
 
 	query := `
-			select
-				count(id)
-			from
-			    room_restrictions
-			where
-			    room_id = $1 and
-			    $2 < end_date and $3 > start_date
+			select u.id
+			from room_units u
+			where u.room_id = $1 and not exists
+			(select 1 from room_restrictions rr where rr.unit_id = u.id and $2 < rr.end_date and $3 > rr.start_date)
+			order by u.sort_order, u.id
+			limit 1
 			`
 
-	row := m.DB.QueryRowContext(context, query, roomID, start, end)
-	err := row.Scan(&numRows)
+	err := q.QueryRowContext(ctx, query, roomID, start, end).Scan(&unitID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return unitID, nil
+}
+
+// SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID and false otherwise
+func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	unitID, err := freeUnit(ctx, m.DB, roomID, start, end)
 	if err != nil {
 		log.Println(err)
 		return false, err
 	}
 
-	if numRows == 0 {
-		return true, nil
-	}
-	return false, nil
+	return unitID > 0, nil
 }
 
-// SearchAvailabilityForAllRooms returns a slice of available rooms if any for given date range
-func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
-	context, cancel := context2.WithTimeout(context2.Background(), 3*time.Second)
+// SearchAvailabilityForAllRooms returns a slice of available rooms, with their amenities, if any for given date
+// range that match search. A restriction of any type takes its unit, whether or not it counts toward occupancy.
+func (m *postgresDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time, search models.RoomSearch) ([]models.Room, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	var rooms []models.Room
+
+	args := []interface{}{start, end, search.Guests}
+
+	// rooms must have every amenity searched for
+	amenities := ""
+	if ids := uniqueIDs(search.AmenityIDs); len(ids) > 0 {
+		var placeholders []string
+		for _, id := range ids {
+			args = append(args, id)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		}
+		amenities = fmt.Sprintf(`and (select count(ra.amenity_id) from room_amenities ra
+				where ra.room_id = r.id and ra.amenity_id in (%s)) = %d`, strings.Join(placeholders, ", "), len(ids))
+	}
+
 	query := `
-		select
-			r.id, r.room_name
-		from
-		    rooms r 
-		where r.id not in
-		(select room_id from room_restrictions rr where $1 < rr.end_date and $2 > rr.start_date)
+		select id, room_name, slug, description, sort_order, active, nightly_rate, weekend_rate, max_occupancy,
+		units, free_units
+		from (
+			select
+				r.id, r.room_name, r.slug, r.description, r.sort_order, r.active, r.nightly_rate,
+				r.weekend_rate, r.max_occupancy,
+				(select count(u.id) from room_units u where u.room_id = r.id) as units,
+				(select count(u.id) from room_units u where u.room_id = r.id and not exists
+				(select 1 from room_restrictions rr where rr.unit_id = u.id and $1 < rr.end_date and $2 > rr.start_date))
+				as free_units
+			from
+			    rooms r
+			where r.active = true and r.max_occupancy >= $3 ` + amenities + `
+		) available
+		where free_units > 0
+		order by sort_order, room_name
 	`
 
-	rows, err := m.DB.QueryContext(context, query, start, end)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return rooms, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var room models.Room
 		err := rows.Scan(
 			&room.ID,
 			&room.RoomName,
+			&room.Slug,
+			&room.Description,
+			&room.SortOrder,
+			&room.Active,
+			&room.NightlyRate,
+			&room.WeekendRate,
+			&room.MaxOccupancy,
+			&room.Units,
+			&room.FreeUnits,
 		)
 		if err != nil {
 			return rooms, err
@@ -136,47 +343,177 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 	if err = rows.Err(); err != nil {
 		return rooms, err
 	}
+
+	// sqlite has a single connection, so the rows must be closed before the amenities are read
+	rows.Close()
+
+	for i := range rooms {
+		rooms[i].Amenities, err = m.roomAmenities(ctx, rooms[i].ID)
+		if err != nil {
+			return rooms, err
+		}
+	}
+
 	return rooms, nil
 }
 
-// GetRoomByID gets a room by ID
-func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
-	context, cancel := context2.WithTimeout(context2.Background(), 3*time.Second)
+// GetRoomByID gets a room by ID, with its images and amenities
+func (m *postgresDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	return m.getRoom(ctx, `where id = $1`, id)
+}
+
+// GetRoomBySlug returns a room, with its images and amenities, by its slug
+func (m *postgresDBRepo) GetRoomBySlug(ctx context.Context, slug string) (models.Room, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
+	return m.getRoom(ctx, `where slug = $1`, slug)
+}
+
+// getRoom returns the room matched by the where clause, with its images and amenities
+func (m *postgresDBRepo) getRoom(ctx context.Context, where string, arg interface{}) (models.Room, error) {
 	var room models.Room
 
-	query :=
-		`
-		select id, room_name, created_at, updated_at from rooms where id = $1
-		`
+	query := `
+		select id, room_name, slug, description, sort_order, active, nightly_rate, weekend_rate, max_occupancy,
+		created_at, updated_at, (select count(u.id) from room_units u where u.room_id = rooms.id) from rooms
+		` + where
 
-	row := m.DB.QueryRowContext(context, query, id)
+	row := m.DB.QueryRowContext(ctx, query, arg)
 	err := row.Scan(
 		&room.ID,
 		&room.RoomName,
+		&room.Slug,
+		&room.Description,
+		&room.SortOrder,
+		&room.Active,
+		&room.NightlyRate,
+		&room.WeekendRate,
+		&room.MaxOccupancy,
 		&room.CreatedAt,
 		&room.UpdatedAt,
+		&room.Units,
 	)
 	if err != nil {
 		return room, err
 	}
 
+	room.Images, err = m.roomImages(ctx, room.ID)
+	if err != nil {
+		return room, err
+	}
+
+	room.Amenities, err = m.roomAmenities(ctx, room.ID)
+	if err != nil {
+		return room, err
+	}
+
 	return room, nil
 }
 
-// GetUserByID returns a user by id
-func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
-	context, cancel := context2.WithTimeout(context2.Background(), 3*time.Second)
+// roomImages returns the image paths of a room in display order
+func (m *postgresDBRepo) roomImages(ctx context.Context, roomID int) ([]string, error) {
+	var images []string
+
+	rows, err := m.DB.QueryContext(ctx,
+		`select image_path from room_images where room_id = $1 order by sort_order, id`, roomID)
+	if err != nil {
+		return images, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var image string
+		err := rows.Scan(&image)
+		if err != nil {
+			return images, err
+		}
+		images = append(images, image)
+	}
+
+	if err = rows.Err(); err != nil {
+		return images, err
+	}
+
+	return images, nil
+}
+
+// AllAmenities returns every amenity sorted by name
+func (m *postgresDBRepo) AllAmenities(ctx context.Context) ([]models.Amenity, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
-	query := `select id, first_name, last_name, email, password, access_level, created_at, updated_at
-			from users where id=$1
-			`
+	var amenities []models.Amenity
+
+	rows, err := m.DB.QueryContext(ctx, `select id, name, created_at, updated_at from amenities order by name`)
+	if err != nil {
+		return amenities, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a models.Amenity
+		err := rows.Scan(&a.ID, &a.Name, &a.CreatedAt, &a.UpdatedAt)
+		if err != nil {
+			return amenities, err
+		}
+		amenities = append(amenities, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return amenities, err
+	}
+
+	return amenities, nil
+}
+
+// roomAmenities returns the amenities of a room sorted by name
+func (m *postgresDBRepo) roomAmenities(ctx context.Context, roomID int) ([]models.Amenity, error) {
+	var amenities []models.Amenity
+
+	query := `
+		select a.id, a.name, a.created_at, a.updated_at
+		from amenities a
+		join room_amenities ra on (ra.amenity_id = a.id)
+		where ra.room_id = $1
+		order by a.name
+		`
+
+	rows, err := m.DB.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return amenities, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a models.Amenity
+		err := rows.Scan(&a.ID, &a.Name, &a.CreatedAt, &a.UpdatedAt)
+		if err != nil {
+			return amenities, err
+		}
+		amenities = append(amenities, a)
+	}
 
-	row := m.DB.QueryRowContext(context, query, id)
+	if err = rows.Err(); err != nil {
+		return amenities, err
+	}
+
+	return amenities, nil
+}
 
+// userColumns are the columns scanned by scanUser
+const userColumns = `id, first_name, last_name, email, password, access_level, active, session_version,
+		password_token_hash, password_token_expires_at, created_at, updated_at`
+
+// scanUser scans a row of userColumns
+func scanUser(row interface{ Scan(...interface{}) error }) (models.User, error) {
 	var user models.User
+	var tokenHash sql.NullString
+	var tokenExpiresAt sql.NullTime
+
 	err := row.Scan(
 		&user.ID,
 		&user.FirstName,
@@ -184,56 +521,199 @@ func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
 		&user.Email,
 		&user.Password,
 		&user.AccessLevel,
+		&user.Active,
+		&user.SessionVersion,
+		&tokenHash,
+		&tokenExpiresAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
+	user.PasswordTokenHash = tokenHash.String
+	user.PasswordTokenExpiresAt = tokenExpiresAt.Time
+
+	return user, err
+}
 
+// nullString stores an empty string as null, for columns that must be unique when set
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// AllUsers returns every user, active or not, by name
+func (m *postgresDBRepo) AllUsers(ctx context.Context) ([]models.User, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var users []models.User
+
+	rows, err := m.DB.QueryContext(ctx, `select `+userColumns+` from users order by first_name, last_name, id`)
 	if err != nil {
-		return user, err
+		return users, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return users, err
+		}
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return users, err
+	}
+
+	return users, nil
+}
+
+// GetUserByID returns a user by id
+func (m *postgresDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `select `+userColumns+` from users where id = $1`, id)
+
+	return scanUser(row)
+}
+
+// GetUserByPasswordToken returns the user with the password token hash, expired or not, or sql.ErrNoRows
+func (m *postgresDBRepo) GetUserByPasswordToken(ctx context.Context, hash string) (models.User, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `select `+userColumns+` from users where password_token_hash = $1`, hash)
+
+	return scanUser(row)
+}
+
+// InsertUser adds a user and returns its id, or repository.ErrEmailTaken when another user has the email
+func (m *postgresDBRepo) InsertUser(ctx context.Context, user models.User) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var newID int
+
+	statement := `insert into users (first_name, last_name, email, password, access_level, active,
+			password_token_hash, password_token_expires_at, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id`
+
+	var tokenExpiresAt sql.NullTime
+	if user.PasswordTokenHash != "" {
+		tokenExpiresAt = sql.NullTime{Time: user.PasswordTokenExpiresAt, Valid: true}
+	}
+
+	err := m.DB.QueryRowContext(ctx, statement,
+		user.FirstName,
+		user.LastName,
+		user.Email,
+		user.Password,
+		user.AccessLevel,
+		user.Active,
+		nullString(user.PasswordTokenHash),
+		tokenExpiresAt,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if isUniqueViolation(err) {
+		return 0, repository.ErrEmailTaken
+	} else if err != nil {
+		return 0, err
 	}
 
-	return user, nil
+	return newID, nil
 }
 
-// UpdateUser updates user information
-func (m *postgresDBRepo) UpdateUser(user models.User) error {
-	context, cancel := context2.WithTimeout(context2.Background(), 3*time.Second)
+// UpdateUser updates the names, email and access level of a user, returning repository.ErrEmailTaken when
+// another user has the email
+func (m *postgresDBRepo) UpdateUser(ctx context.Context, user models.User) error {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	query := `
 			update users set first_name=$1, last_name=$2, email=$3, access_level=$4, updated_at=$5
+			where id=$6
 			`
 
-	_, err := m.DB.ExecContext(context, query,
+	_, err := m.DB.ExecContext(ctx, query,
 		user.FirstName,
 		user.LastName,
 		user.Email,
 		user.AccessLevel,
 		time.Now(),
+		user.ID,
 	)
-	if err != nil {
+	if isUniqueViolation(err) {
+		return repository.ErrEmailTaken
+	} else if err != nil {
 		return err
 	}
 
 	return nil
 }
 
-// Authenticate authenticates a user
-func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string, error) {
-	context, cancel := context2.WithTimeout(context2.Background(), 3*time.Second)
+// UpdateUserActive activates or deactivates a user, deactivated users cannot log in and their sessions end
+func (m *postgresDBRepo) UpdateUserActive(ctx context.Context, id int, active bool) error {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
-	var id int
-	var hashedPassword string
+	query := `update users set active = $1,
+			session_version = case when $1 then session_version else session_version + 1 end,
+			updated_at = $2 where id = $3`
 
-	// checks if user entered a valid email
-	row := m.DB.QueryRowContext(context, "select id, password from users where email=$1", email)
-	err := row.Scan(&id, &hashedPassword)
-	if err != nil {
-		return id, "", err
-	}
+	_, err := m.DB.ExecContext(ctx, query, active, time.Now(), id)
 
-	// checks if passwords are equal
+	return err
+}
+
+// ResetPassword clears the password of a user and ends their sessions, so they cannot log in until they set a new
+// one with the token until expiresAt
+func (m *postgresDBRepo) ResetPassword(ctx context.Context, id int, tokenHash string, expiresAt time.Time) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `update users set password = '', password_token_hash = $1, password_token_expires_at = $2,
+			session_version = session_version + 1, updated_at = $3 where id = $4`
+
+	_, err := m.DB.ExecContext(ctx, query, tokenHash, expiresAt, time.Now(), id)
+
+	return err
+}
+
+// UpdatePassword sets the hashed password of a user, clears their password token and ends their sessions
+func (m *postgresDBRepo) UpdatePassword(ctx context.Context, id int, hashedPassword string) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `update users set password = $1, password_token_hash = null, password_token_expires_at = null,
+			session_version = session_version + 1, updated_at = $2 where id = $3`
+
+	_, err := m.DB.ExecContext(ctx, query, hashedPassword, time.Now(), id)
+
+	return err
+}
+
+// Authenticate authenticates an active user
+func (m *postgresDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var id int
+	var hashedPassword string
+
+	// checks if user entered a valid email
+	row := m.DB.QueryRowContext(ctx, "select id, password from users where email=$1 and active", email)
+	err := row.Scan(&id, &hashedPassword)
+	if err != nil {
+		return id, "", err
+	}
+
+	// a user whose password was reset has none until they set a new one
+	if hashedPassword == "" {
+		return 0, "", errors.New("password was reset")
+	}
+
+	// checks if passwords are equal
 	err = bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(testPassword))
 	if err == bcrypt.ErrMismatchedHashAndPassword {
 		return 0, "", errors.New("incorrect password")
@@ -244,9 +724,378 @@ func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string,
 	return id, hashedPassword, nil
 }
 
+// apiKeyColumns are the columns scanned by scanAPIKey
+const apiKeyColumns = `id, name, prefix, key_hash, scope, last_used_at, revoked_at, created_at, updated_at`
+
+// scanAPIKey scans a row of apiKeyColumns
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (models.APIKey, error) {
+	var key models.APIKey
+	var lastUsedAt, revokedAt sql.NullTime
+
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&key.Scope,
+		&lastUsedAt,
+		&revokedAt,
+		&key.CreatedAt,
+		&key.UpdatedAt,
+	)
+	key.LastUsedAt = lastUsedAt.Time
+	key.RevokedAt = revokedAt.Time
+
+	return key, err
+}
+
+// AllAPIKeys returns every api key, the newest first
+func (m *postgresDBRepo) AllAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var keys []models.APIKey
+
+	rows, err := m.DB.QueryContext(ctx, `select `+apiKeyColumns+` from api_keys order by id desc`)
+	if err != nil {
+		return keys, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return keys, err
+	}
+
+	return keys, nil
+}
+
+// GetAPIKeyByHash returns the api key with the hash, revoked or not, or sql.ErrNoRows
+func (m *postgresDBRepo) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, `select `+apiKeyColumns+` from api_keys where key_hash = $1`, hash)
+
+	return scanAPIKey(row)
+}
+
+// InsertAPIKey adds an api key and returns its id
+func (m *postgresDBRepo) InsertAPIKey(ctx context.Context, key models.APIKey) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var newID int
+
+	statement := `insert into api_keys (name, prefix, key_hash, scope, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6) returning id`
+
+	err := m.DB.QueryRowContext(ctx, statement,
+		key.Name,
+		key.Prefix,
+		key.KeyHash,
+		key.Scope,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// RevokeAPIKey stops an api key from being used. Revoking a revoked key keeps when it was first revoked.
+func (m *postgresDBRepo) RevokeAPIKey(ctx context.Context, id int) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `update api_keys set revoked_at = $1, updated_at = $1 where id = $2 and revoked_at is null`
+
+	_, err := m.DB.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateAPIKeyLastUsed records when an api key was last used
+func (m *postgresDBRepo) UpdateAPIKeyLastUsed(ctx context.Context, id int, at time.Time) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `update api_keys set last_used_at = $1 where id = $2`, at, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AllWebhooks returns every webhook, the newest first
+func (m *postgresDBRepo) AllWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var hooks []models.Webhook
+
+	rows, err := m.DB.QueryContext(ctx,
+		`select id, url, secret, events, created_at, updated_at from webhooks order by id desc`)
+	if err != nil {
+		return hooks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hook models.Webhook
+		var events string
+		err := rows.Scan(
+			&hook.ID,
+			&hook.URL,
+			&hook.Secret,
+			&events,
+			&hook.CreatedAt,
+			&hook.UpdatedAt,
+		)
+		if err != nil {
+			return hooks, err
+		}
+		hook.Events = strings.Split(events, ",")
+		hooks = append(hooks, hook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return hooks, err
+	}
+
+	return hooks, nil
+}
+
+// InsertWebhook adds a webhook and returns its id
+func (m *postgresDBRepo) InsertWebhook(ctx context.Context, hook models.Webhook) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var newID int
+
+	statement := `insert into webhooks (url, secret, events, created_at, updated_at)
+			values ($1, $2, $3, $4, $5) returning id`
+
+	err := m.DB.QueryRowContext(ctx, statement,
+		hook.URL,
+		hook.Secret,
+		strings.Join(hook.Events, ","),
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// DeleteWebhook deletes a webhook and its deliveries
+func (m *postgresDBRepo) DeleteWebhook(ctx context.Context, id int) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from webhooks where id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InsertWebhookDeliveries queues the payload of an event for every webhook subscribed to it, due now, and
+// returns how many were queued
+func (m *postgresDBRepo) InsertWebhookDeliveries(ctx context.Context, event, payload string) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	statement := `insert into webhook_deliveries
+			(webhook_id, event, payload, status, next_attempt_at, created_at, updated_at)
+			select id, $1, $2, $3, $4, $4, $4 from webhooks
+			where ',' || events || ',' like '%,' || $1 || ',%'`
+
+	result, err := m.DB.ExecContext(ctx, statement, event, payload, webhooks.StatusPending, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	queued, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(queued), nil
+}
+
+// webhookDeliveryColumns are the columns scanned by scanWebhookDelivery, from webhook_deliveries d joined
+// with webhooks w
+const webhookDeliveryColumns = `d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.status_code,
+	d.error, d.next_attempt_at, d.delivered_at, d.created_at, d.updated_at, w.id, w.url, w.secret`
+
+// scanWebhookDelivery scans a row of webhookDeliveryColumns
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }) (models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var deliveredAt sql.NullTime
+
+	err := row.Scan(
+		&d.ID,
+		&d.WebhookID,
+		&d.Event,
+		&d.Payload,
+		&d.Status,
+		&d.Attempts,
+		&d.StatusCode,
+		&d.Error,
+		&d.NextAttemptAt,
+		&deliveredAt,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+		&d.Webhook.ID,
+		&d.Webhook.URL,
+		&d.Webhook.Secret,
+	)
+	d.DeliveredAt = deliveredAt.Time
+
+	return d, err
+}
+
+// webhookDeliveries returns the deliveries of a query selecting webhookDeliveryColumns
+func (m *postgresDBRepo) webhookDeliveries(ctx context.Context, query string, args ...interface{}) ([]models.WebhookDelivery, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var deliveries []models.WebhookDelivery
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return deliveries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return deliveries, err
+	}
+
+	return deliveries, nil
+}
+
+// ClaimWebhookDeliveries claims up to limit pending deliveries due at now, the longest waiting first, by moving
+// their next attempt lease later, so no other sender picks them up while they are being sent
+func (m *postgresDBRepo) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	// the due check is repeated outside the subquery, so a row another sender claimed first is skipped once its
+	// update commits
+	statement := `update webhook_deliveries set next_attempt_at = $1, updated_at = $2
+			where id in (
+				select id from webhook_deliveries
+				where status = $3 and next_attempt_at <= $4
+				order by next_attempt_at, id
+				limit $5)
+			and status = $3 and next_attempt_at <= $4
+			returning id`
+
+	rows, err := m.DB.QueryContext(ctx, statement, now.Add(lease), time.Now(), webhooks.StatusPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var args []interface{}
+	var placeholders []string
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		args = append(args, id)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(args) == 0 {
+		return nil, nil
+	}
+
+	query := `select ` + webhookDeliveryColumns + `
+			from webhook_deliveries d
+			join webhooks w on (w.id = d.webhook_id)
+			where d.id in (` + strings.Join(placeholders, ", ") + `)
+			order by d.id`
+
+	return m.webhookDeliveries(ctx, query, args...)
+}
+
+// UpdateWebhookDelivery records the outcome of an attempt to send a delivery
+func (m *postgresDBRepo) UpdateWebhookDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var deliveredAt sql.NullTime
+	if !d.DeliveredAt.IsZero() {
+		deliveredAt = sql.NullTime{Time: d.DeliveredAt, Valid: true}
+	}
+
+	query := `update webhook_deliveries set status = $1, attempts = $2, status_code = $3, error = $4,
+			next_attempt_at = $5, delivered_at = $6, updated_at = $7
+			where id = $8`
+
+	_, err := m.DB.ExecContext(ctx, query,
+		d.Status,
+		d.Attempts,
+		d.StatusCode,
+		d.Error,
+		d.NextAttemptAt,
+		deliveredAt,
+		time.Now(),
+		d.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RecentWebhookDeliveries returns the last limit deliveries, the newest first
+func (m *postgresDBRepo) RecentWebhookDeliveries(ctx context.Context, limit int) ([]models.WebhookDelivery, error) {
+	query := `select ` + webhookDeliveryColumns + `
+			from webhook_deliveries d
+			join webhooks w on (w.id = d.webhook_id)
+			order by d.id desc
+			limit $1`
+
+	return m.webhookDeliveries(ctx, query, limit)
+}
+
 // AllReservations returns a slice of all reservations
-func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
-	context, cancel := context2.WithTimeout(context2.Background(), 3*time.Second)
+func (m *postgresDBRepo) AllReservations(ctx context.Context) ([]models.Reservation, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	var reservations []models.Reservation
@@ -254,13 +1103,13 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 	query :=
 		`
 			select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at,
-			r.updated_at, r.processed, rm.id, rm.room_name
+			r.updated_at, r.processed, r.total_price, r.adults, r.children, rm.id, rm.room_name
 			from reservations r 
 			left join rooms rm on (r.room_id = rm.id)
 			order by r.start_date asc
 		`
 
-	rows, err := m.DB.QueryContext(context, query)
+	rows, err := m.DB.QueryContext(ctx, query)
 	if err != nil {
 		return reservations, err
 	}
@@ -281,6 +1130,9 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Processed,
+			&i.TotalPrice,
+			&i.Adults,
+			&i.Children,
 			&i.Room.ID,
 			&i.Room.RoomName,
 		)
@@ -297,8 +1149,8 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 }
 
 // AllNewReservations returns a slice of all reservations
-func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
-	context, cancel := context2.WithTimeout(context2.Background(), 3*time.Second)
+func (m *postgresDBRepo) AllNewReservations(ctx context.Context) ([]models.Reservation, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	var reservations []models.Reservation
@@ -306,14 +1158,14 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 	query :=
 		`
 			select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at,
-			r.updated_at, rm.id, rm.room_name
+			r.updated_at, r.total_price, r.adults, r.children, rm.id, rm.room_name
 			from reservations r 
 			left join rooms rm on (r.room_id = rm.id)
 			where processed = 0
 			order by r.start_date asc
 		`
 
-	rows, err := m.DB.QueryContext(context, query)
+	rows, err := m.DB.QueryContext(ctx, query)
 	if err != nil {
 		return reservations, err
 	}
@@ -333,6 +1185,9 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 			&i.RoomID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.TotalPrice,
+			&i.Adults,
+			&i.Children,
 			&i.Room.ID,
 			&i.Room.RoomName,
 		)
@@ -349,21 +1204,24 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 }
 
 // GetReservationById returns one reservation by ID
-func (m *postgresDBRepo) GetReservationById(id int) (models.Reservation, error) {
-	context, cancel := context2.WithTimeout(context2.Background(), 3*time.Second)
+func (m *postgresDBRepo) GetReservationById(ctx context.Context, id int) (models.Reservation, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	var reservation models.Reservation
 
 	query := `
 			select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at,
-			r.updated_at, r.processed, rm.id, rm.room_name
+			r.updated_at, r.processed, r.total_price, r.adults, r.children, coalesce(r.booking_id, 0), rm.id,
+			rm.room_name, coalesce(u.id, 0), coalesce(u.name, '')
 			from reservations r 
 			left join rooms rm on (r.room_id = rm.id)
+			left join room_restrictions rr on (rr.reservation_id = r.id)
+			left join room_units u on (rr.unit_id = u.id)
 			where r.id = $1
 		`
 
-	row := m.DB.QueryRowContext(context, query, id)
+	row := m.DB.QueryRowContext(ctx, query, id)
 	err := row.Scan(
 		&reservation.ID,
 		&reservation.FirstName,
@@ -376,8 +1234,14 @@ func (m *postgresDBRepo) GetReservationById(id int) (models.Reservation, error)
 		&reservation.CreatedAt,
 		&reservation.UpdatedAt,
 		&reservation.Processed,
+		&reservation.TotalPrice,
+		&reservation.Adults,
+		&reservation.Children,
+		&reservation.BookingID,
 		&reservation.Room.ID,
 		&reservation.Room.RoomName,
+		&reservation.Unit.ID,
+		&reservation.Unit.Name,
 	)
 	if err != nil {
 		return reservation, err
@@ -386,8 +1250,8 @@ func (m *postgresDBRepo) GetReservationById(id int) (models.Reservation, error)
 	return reservation, nil
 }
 
-func (m *postgresDBRepo) UpdateReservation(reservation models.Reservation) error {
-	context, cancel := context2.WithTimeout(context2.Background(), 3*time.Second)
+func (m *postgresDBRepo) UpdateReservation(ctx context.Context, reservation models.Reservation) error {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	query := `
@@ -395,7 +1259,7 @@ func (m *postgresDBRepo) UpdateReservation(reservation models.Reservation) error
 			where id = $6
 			`
 
-	_, err := m.DB.ExecContext(context, query,
+	_, err := m.DB.ExecContext(ctx, query,
 		reservation.FirstName,
 		reservation.LastName,
 		reservation.Email,
@@ -411,13 +1275,13 @@ func (m *postgresDBRepo) UpdateReservation(reservation models.Reservation) error
 }
 
 // DeleteReservation deletes one reservation by ID
-func (m *postgresDBRepo) DeleteReservation(id int) error {
-	context, cancel := context2.WithTimeout(context2.Background(), 3*time.Second)
+func (m *postgresDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	query := "delete from reservations where id = $1"
 
-	_, err := m.DB.ExecContext(context, query, id)
+	_, err := m.DB.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -426,13 +1290,13 @@ func (m *postgresDBRepo) DeleteReservation(id int) error {
 }
 
 // UpdateProcessedForReservation updates processed for a reservation by ID
-func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error {
-	context, cancel := context2.WithTimeout(context2.Background(), 3*time.Second)
+func (m *postgresDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	query := "update reservations set processed = $1 where id = $2"
 
-	_, err := m.DB.ExecContext(context, query, processed, id)
+	_, err := m.DB.ExecContext(ctx, query, processed, id)
 	if err != nil {
 		return err
 	}
@@ -440,15 +1304,17 @@ func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error
 	return nil
 }
 
-// AllRooms returns a slice with all rooms
-func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
-	context, cancel := context2.WithTimeout(context2.Background(), 3*time.Second)
+// AllRooms returns a slice with all rooms, active or not, in display order
+func (m *postgresDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	var rooms []models.Room
-	query := `select id, room_name, created_at, updated_at from rooms order by room_name`
+	query := `select id, room_name, slug, description, sort_order, active, nightly_rate, weekend_rate,
+			max_occupancy, created_at, updated_at, (select count(u.id) from room_units u where u.room_id = rooms.id)
+			from rooms order by sort_order, room_name`
 
-	rows, err := m.DB.QueryContext(context, query)
+	rows, err := m.DB.QueryContext(ctx, query)
 	if err != nil {
 		return rooms, err
 	}
@@ -459,8 +1325,16 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 		err := rows.Scan(
 			&rm.ID,
 			&rm.RoomName,
+			&rm.Slug,
+			&rm.Description,
+			&rm.SortOrder,
+			&rm.Active,
+			&rm.NightlyRate,
+			&rm.WeekendRate,
+			&rm.MaxOccupancy,
 			&rm.CreatedAt,
 			&rm.UpdatedAt,
+			&rm.Units,
 		)
 		if err != nil {
 			return rooms, err
@@ -475,74 +1349,872 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 	return rooms, nil
 }
 
-// GetRestrictions returns restrictions for a room by date range
-func (m *postgresDBRepo) GetRestrictions(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
-	context, cancel := context2.WithTimeout(context2.Background(), 3*time.Second)
+// InsertRoom inserts a room, its images, its amenities and its first unit, placing it after the other rooms
+func (m *postgresDBRepo) InsertRoom(ctx context.Context, room models.Room) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
-	var restrictions []models.RoomRestriction
-	// coalesce uis used to deal if reservation_id is nil
-	query := `
-		select id, coalesce(reservation_id, 0), restriction_id, room_id, start_date, end_date
-		from room_restrictions where $1 < end_date and $2 >= start_date
-		and room_id = $3
-		`
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
 
-	rows, err := m.DB.QueryContext(context, query, start, end, roomID)
+	statement := `insert into rooms (room_name, slug, description, sort_order, active, nightly_rate, weekend_rate,
+			max_occupancy, created_at, updated_at)
+			values ($1, $2, $3, (select coalesce(max(sort_order), 0) + 1 from rooms), $4, $5, $6, $7, $8, $9)
+			returning id`
+
+	err = tx.QueryRowContext(ctx, statement,
+		room.RoomName,
+		room.Slug,
+		room.Description,
+		room.Active,
+		room.NightlyRate,
+		room.WeekendRate,
+		room.MaxOccupancy,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var r models.RoomRestriction
-		err := rows.Scan(
-			&r.ID,
-			&r.ReservationID,
-			&r.RestrictionID,
-			&r.RoomID,
-			&r.StartDate,
-			&r.EndDate,
-		)
-		if err != nil {
-			return nil, err
-		}
-		restrictions = append(restrictions, r)
+	err = replaceRoomImages(ctx, tx, newID, room.Images)
+	if err != nil {
+		return 0, err
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+	err = replaceRoomAmenities(ctx, tx, newID, room.Amenities)
+	if err != nil {
+		return 0, err
 	}
 
-	return restrictions, nil
+	// every room starts with one unit, named after it
+	statement = `insert into room_units (room_id, name, sort_order, created_at, updated_at)
+			values ($1, $2, 1, $3, $4)`
+
+	_, err = tx.ExecContext(ctx, statement, newID, room.RoomName, time.Now(), time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
 }
 
-// InsertBlockForRoom inserts the room restriction
-func (m *postgresDBRepo) InsertBlockForRoom(roomID int, startDate time.Time) error {
-	context, cancel := context2.WithTimeout(context2.Background(), 3*time.Second)
+// UpdateRoom updates the details, images and amenities of a room
+func (m *postgresDBRepo) UpdateRoom(ctx context.Context, room models.Room) error {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
-	query := `insert into room_restrictions (start_date, end_date, room_id, restriction_id, created_at, updated_at)
-			values ($1,$2,$3,$4,$5,$6)`
-
-	_, err := m.DB.ExecContext(context, query, startDate, startDate.AddDate(0, 0, 1), roomID, 2,
-		time.Now(), time.Now())
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		log.Println(err)
 		return err
 	}
+	defer tx.Rollback()
+
+	query := `
+			update rooms set room_name = $1, slug = $2, description = $3, active = $4, nightly_rate = $5,
+			weekend_rate = $6, max_occupancy = $7, updated_at = $8
+			where id = $9
+			`
+
+	_, err = tx.ExecContext(ctx, query,
+		room.RoomName,
+		room.Slug,
+		room.Description,
+		room.Active,
+		room.NightlyRate,
+		room.WeekendRate,
+		room.MaxOccupancy,
+		time.Now(),
+		room.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = replaceRoomImages(ctx, tx, room.ID, room.Images)
+	if err != nil {
+		return err
+	}
+
+	err = replaceRoomAmenities(ctx, tx, room.ID, room.Amenities)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// replaceRoomAmenities makes amenities, by their ids, the only amenities of a room
+func replaceRoomAmenities(ctx context.Context, tx *sql.Tx, roomID int, amenities []models.Amenity) error {
+	_, err := tx.ExecContext(ctx, `delete from room_amenities where room_id = $1`, roomID)
+	if err != nil {
+		return err
+	}
+
+	var ids []int
+	for _, a := range amenities {
+		ids = append(ids, a.ID)
+	}
+
+	for _, id := range uniqueIDs(ids) {
+		_, err := tx.ExecContext(ctx, `insert into room_amenities (room_id, amenity_id) values ($1, $2)`, roomID, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replaceRoomImages makes images, in order, the only images of a room
+func replaceRoomImages(ctx context.Context, tx *sql.Tx, roomID int, images []string) error {
+	_, err := tx.ExecContext(ctx, `delete from room_images where room_id = $1`, roomID)
+	if err != nil {
+		return err
+	}
+
+	statement := `insert into room_images (room_id, image_path, sort_order, created_at, updated_at)
+			values ($1, $2, $3, $4, $5)`
+
+	for i, image := range images {
+		_, err := tx.ExecContext(ctx, statement, roomID, image, i+1, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateRoomActive activates or deactivates a room. Inactive rooms are not offered to guests.
+func (m *postgresDBRepo) UpdateRoomActive(ctx context.Context, id int, active bool) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := "update rooms set active = $1, updated_at = $2 where id = $3"
+
+	_, err := m.DB.ExecContext(ctx, query, active, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateRoomOrder sets the display order of rooms to the order of ids
+func (m *postgresDBRepo) UpdateRoomOrder(ctx context.Context, ids []int) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, id := range ids {
+		_, err := tx.ExecContext(ctx, "update rooms set sort_order = $1 where id = $2", i+1, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteRoom deletes a room with its past reservations and restrictions. It returns
+// repository.ErrRoomHasReservations if guests are booked from today on.
+func (m *postgresDBRepo) DeleteRoom(ctx context.Context, id int) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	// serializable, so a reservation booked between the check and the delete makes the delete fail instead of
+	// being deleted with it
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var numRows int
+
+	today := time.Now().Truncate(24 * time.Hour)
+	query := "select count(id) from reservations where room_id = $1 and end_date > $2"
+
+	err = tx.QueryRowContext(ctx, query, id, today).Scan(&numRows)
+	if err != nil {
+		return err
+	}
+
+	if numRows > 0 {
+		return repository.ErrRoomHasReservations
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from rooms where id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AllRoomRates returns every rate override of a room by start date
+func (m *postgresDBRepo) AllRoomRates(ctx context.Context, roomID int) ([]models.RoomRate, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `
+		select id, room_id, name, start_date, end_date, nightly_rate, weekend_rate, created_at, updated_at
+		from room_rates where room_id = $1
+		order by start_date, id
+		`
+
+	return m.roomRates(ctx, query, roomID)
+}
+
+// GetRoomRates returns the rate overrides of a room that cover any night from start up to end
+func (m *postgresDBRepo) GetRoomRates(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRate, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `
+		select id, room_id, name, start_date, end_date, nightly_rate, weekend_rate, created_at, updated_at
+		from room_rates where room_id = $1 and $2 < end_date and $3 > start_date
+		order by start_date, id
+		`
+
+	return m.roomRates(ctx, query, roomID, start, end)
+}
+
+// roomRates runs a query for room rates
+func (m *postgresDBRepo) roomRates(ctx context.Context, query string, args ...interface{}) ([]models.RoomRate, error) {
+	var rates []models.RoomRate
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return rates, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.RoomRate
+		err := rows.Scan(
+			&r.ID,
+			&r.RoomID,
+			&r.Name,
+			&r.StartDate,
+			&r.EndDate,
+			&r.NightlyRate,
+			&r.WeekendRate,
+			&r.CreatedAt,
+			&r.UpdatedAt,
+		)
+		if err != nil {
+			return rates, err
+		}
+		rates = append(rates, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rates, err
+	}
+
+	return rates, nil
+}
+
+// InsertRoomRate inserts a rate override for a room
+func (m *postgresDBRepo) InsertRoomRate(ctx context.Context, rate models.RoomRate) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var newID int
+
+	statement := `insert into room_rates (room_id, name, start_date, end_date, nightly_rate, weekend_rate,
+			created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8) returning id`
+
+	err := m.DB.QueryRowContext(ctx, statement,
+		rate.RoomID,
+		rate.Name,
+		rate.StartDate,
+		rate.EndDate,
+		rate.NightlyRate,
+		rate.WeekendRate,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// DeleteRoomRate deletes a rate override
+func (m *postgresDBRepo) DeleteRoomRate(ctx context.Context, id int) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from room_rates where id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AllRoomUnits returns the units of a room in display order
+func (m *postgresDBRepo) AllRoomUnits(ctx context.Context, roomID int) ([]models.RoomUnit, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var units []models.RoomUnit
+
+	query := `
+		select id, room_id, name, sort_order, created_at, updated_at
+		from room_units where room_id = $1
+		order by sort_order, id
+		`
+
+	rows, err := m.DB.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return units, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u models.RoomUnit
+		err := rows.Scan(
+			&u.ID,
+			&u.RoomID,
+			&u.Name,
+			&u.SortOrder,
+			&u.CreatedAt,
+			&u.UpdatedAt,
+		)
+		if err != nil {
+			return units, err
+		}
+		units = append(units, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return units, err
+	}
+
+	return units, nil
+}
+
+// InsertRoomUnit adds a unit to a room, after its other units, and returns its id
+func (m *postgresDBRepo) InsertRoomUnit(ctx context.Context, unit models.RoomUnit) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var newID int
+
+	statement := `insert into room_units (room_id, name, sort_order, created_at, updated_at)
+			values ($1, $2, (select coalesce(max(sort_order), 0) + 1 from room_units where room_id = $1), $3, $4)
+			returning id`
+
+	err := m.DB.QueryRowContext(ctx, statement,
+		unit.RoomID,
+		unit.Name,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// DeleteRoomUnit deletes a unit and its past reservations' restrictions. A unit with future reservations
+// cannot be deleted.
+func (m *postgresDBRepo) DeleteRoomUnit(ctx context.Context, id int) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	// serializable, so a reservation booked between the check and the delete makes the delete fail instead of
+	// being deleted with it
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var numRows int
+
+	today := time.Now().Truncate(24 * time.Hour)
+	query := `select count(id) from room_restrictions where unit_id = $1 and reservation_id is not null
+			and end_date > $2`
+
+	err = tx.QueryRowContext(ctx, query, id, today).Scan(&numRows)
+	if err != nil {
+		return err
+	}
+
+	if numRows > 0 {
+		return repository.ErrRoomHasReservations
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from room_units where id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AllStayRules returns every stay rule of a room by start date
+func (m *postgresDBRepo) AllStayRules(ctx context.Context, roomID int) ([]models.StayRule, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `
+		select id, room_id, name, start_date, end_date, min_nights, max_nights, closed_to_arrival,
+		closed_to_departure, created_at, updated_at
+		from stay_rules where room_id = $1
+		order by start_date, id
+		`
+
+	return m.stayRules(ctx, query, roomID)
+}
+
+// GetStayRules returns the stay rules of a room in force on any date from start up to and including end,
+// so rules on the departure date are included
+func (m *postgresDBRepo) GetStayRules(ctx context.Context, roomID int, start, end time.Time) ([]models.StayRule, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `
+		select id, room_id, name, start_date, end_date, min_nights, max_nights, closed_to_arrival,
+		closed_to_departure, created_at, updated_at
+		from stay_rules where room_id = $1 and $2 < end_date and $3 >= start_date
+		order by start_date, id
+		`
+
+	return m.stayRules(ctx, query, roomID, start, end)
+}
+
+// stayRules runs a query for stay rules
+func (m *postgresDBRepo) stayRules(ctx context.Context, query string, args ...interface{}) ([]models.StayRule, error) {
+	var rules []models.StayRule
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return rules, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.StayRule
+		err := rows.Scan(
+			&r.ID,
+			&r.RoomID,
+			&r.Name,
+			&r.StartDate,
+			&r.EndDate,
+			&r.MinNights,
+			&r.MaxNights,
+			&r.ClosedToArrival,
+			&r.ClosedToDeparture,
+			&r.CreatedAt,
+			&r.UpdatedAt,
+		)
+		if err != nil {
+			return rules, err
+		}
+		rules = append(rules, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+// InsertStayRule inserts a stay rule for a room
+func (m *postgresDBRepo) InsertStayRule(ctx context.Context, rule models.StayRule) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var newID int
+
+	statement := `insert into stay_rules (room_id, name, start_date, end_date, min_nights, max_nights,
+			closed_to_arrival, closed_to_departure, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) returning id`
+
+	err := m.DB.QueryRowContext(ctx, statement,
+		rule.RoomID,
+		rule.Name,
+		rule.StartDate,
+		rule.EndDate,
+		rule.MinNights,
+		rule.MaxNights,
+		rule.ClosedToArrival,
+		rule.ClosedToDeparture,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// DeleteStayRule deletes a stay rule
+func (m *postgresDBRepo) DeleteStayRule(ctx context.Context, id int) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from stay_rules where id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetRestrictions returns restrictions for a room by date range
+func (m *postgresDBRepo) GetRestrictions(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
+	// coalesce uis used to deal if reservation_id is nil
+	query := `
+		select rr.id, coalesce(rr.reservation_id, 0), rr.restriction_id, rr.room_id, rr.unit_id, rr.start_date,
+		rr.end_date, rr.reason, r.id, r.restriction_name, r.colour, r.counts_toward_occupancy, r.for_reservations,
+		u.id, u.name
+		from room_restrictions rr
+		join restrictions r on (rr.restriction_id = r.id)
+		join room_units u on (rr.unit_id = u.id)
+		where $1 < rr.end_date and $2 >= rr.start_date
+		and rr.room_id = $3
+		order by rr.start_date
+		`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.RoomRestriction
+		err := rows.Scan(
+			&r.ID,
+			&r.ReservationID,
+			&r.RestrictionID,
+			&r.RoomID,
+			&r.UnitID,
+			&r.StartDate,
+			&r.EndDate,
+			&r.Reason,
+			&r.Restriction.ID,
+			&r.Restriction.RestrictionName,
+			&r.Restriction.Colour,
+			&r.Restriction.CountsTowardOccupancy,
+			&r.Restriction.ForReservations,
+			&r.Unit.ID,
+			&r.Unit.Name,
+		)
+		if err != nil {
+			return nil, err
+		}
+		restrictions = append(restrictions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return restrictions, nil
+}
+
+// GetRestrictionsForAllRooms returns the restrictions of every room that take up a night in the date range, of
+// every type, since each takes its unit
+func (m *postgresDBRepo) GetRestrictionsForAllRooms(ctx context.Context, start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
+
+	query := `
+		select id, coalesce(reservation_id, 0), restriction_id, room_id, unit_id, start_date, end_date
+		from room_restrictions
+		where $1 < end_date and $2 > start_date
+		order by room_id, start_date
+		`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.RoomRestriction
+		err := rows.Scan(
+			&r.ID,
+			&r.ReservationID,
+			&r.RestrictionID,
+			&r.RoomID,
+			&r.UnitID,
+			&r.StartDate,
+			&r.EndDate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		restrictions = append(restrictions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return restrictions, nil
+}
+
+// AllRestrictions returns all restriction types
+func (m *postgresDBRepo) AllRestrictions(ctx context.Context) ([]models.Restriction, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var restrictions []models.Restriction
+
+	query := `
+		select id, restriction_name, colour, counts_toward_occupancy, for_reservations, created_at, updated_at
+		from restrictions order by id
+		`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return restrictions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.Restriction
+		err := rows.Scan(
+			&r.ID,
+			&r.RestrictionName,
+			&r.Colour,
+			&r.CountsTowardOccupancy,
+			&r.ForReservations,
+			&r.CreatedAt,
+			&r.UpdatedAt,
+		)
+		if err != nil {
+			return restrictions, err
+		}
+		restrictions = append(restrictions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return restrictions, err
+	}
+
+	return restrictions, nil
+}
+
+// GetRestrictionByID returns a restriction type by id
+func (m *postgresDBRepo) GetRestrictionByID(ctx context.Context, id int) (models.Restriction, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var r models.Restriction
+
+	query := `
+		select id, restriction_name, colour, counts_toward_occupancy, for_reservations, created_at, updated_at
+		from restrictions where id = $1
+		`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(
+		&r.ID,
+		&r.RestrictionName,
+		&r.Colour,
+		&r.CountsTowardOccupancy,
+		&r.ForReservations,
+		&r.CreatedAt,
+		&r.UpdatedAt,
+	)
+	if err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
+
+// InsertRestriction inserts a restriction type for blocking rooms and returns its id
+func (m *postgresDBRepo) InsertRestriction(ctx context.Context, r models.Restriction) (int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	var newID int
+
+	query := `insert into restrictions (restriction_name, colour, counts_toward_occupancy, created_at, updated_at)
+			values ($1, $2, $3, $4, $5) returning id`
+
+	err := m.DB.QueryRowContext(ctx, query,
+		r.RestrictionName,
+		r.Colour,
+		r.CountsTowardOccupancy,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// UpdateRestriction updates the name, colour and occupancy of a restriction type
+func (m *postgresDBRepo) UpdateRestriction(ctx context.Context, r models.Restriction) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	query := `update restrictions set restriction_name = $1, colour = $2, counts_toward_occupancy = $3, updated_at = $4
+			where id = $5`
+
+	_, err := m.DB.ExecContext(ctx, query,
+		r.RestrictionName,
+		r.Colour,
+		r.CountsTowardOccupancy,
+		time.Now(),
+		r.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteRestriction deletes a restriction type. The type used for reservations, and types that rooms are
+// restricted with, cannot be deleted.
+func (m *postgresDBRepo) DeleteRestriction(ctx context.Context, id int) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var numRows, forReservations int
+
+	query := "select count(id) from room_restrictions where restriction_id = $1"
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(&numRows)
+	if err != nil {
+		return err
+	}
+
+	query = "select count(id) from restrictions where id = $1 and for_reservations = true"
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(&forReservations)
+	if err != nil {
+		return err
+	}
+
+	if numRows > 0 || forReservations > 0 {
+		return repository.ErrRestrictionInUse
+	}
+
+	_, err = tx.ExecContext(ctx, "delete from restrictions where id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// InsertBlockForUnit blocks a unit for one night with the first restriction type that is not for reservations
+func (m *postgresDBRepo) InsertBlockForUnit(ctx context.Context, unitID int, startDate time.Time) error {
+	restrictions, err := m.AllRestrictions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range restrictions {
+		if !r.ForReservations {
+			return m.InsertBlock(ctx, models.RoomRestriction{
+				UnitID:        unitID,
+				RestrictionID: r.ID,
+				StartDate:     startDate,
+				EndDate:       startDate.AddDate(0, 0, 1),
+			})
+		}
+	}
+
+	return errors.New("there is no restriction type for blocking rooms")
+}
+
+// InsertBlock blocks a unit from the start date up to, but not including, the end date. Without a unit it
+// blocks the first unit of the room that is free for those dates.
+func (m *postgresDBRepo) InsertBlock(ctx context.Context, block models.RoomRestriction) error {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	if block.UnitID == 0 {
+		unitID, err := freeUnit(ctx, m.DB, block.RoomID, block.StartDate, block.EndDate)
+		if err != nil {
+			return err
+		}
+		if unitID == 0 {
+			return repository.ErrRoomUnavailable
+		}
+		block.UnitID = unitID
+	}
+
+	// the room is always the unit's own
+	query := `insert into room_restrictions (start_date, end_date, room_id, unit_id, restriction_id, reason,
+			created_at, updated_at)
+			select $1, $2, room_id, id, $3, $4, $5, $6 from room_units where id = $7`
+
+	result, err := m.DB.ExecContext(ctx, query, block.StartDate, block.EndDate, block.RestrictionID,
+		block.Reason, time.Now(), time.Now(), block.UnitID)
+	if isOverlap(err) {
+		return repository.ErrRoomUnavailable
+	}
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return errors.New("block for a unit that does not exist")
+	}
 
 	return nil
 }
 
 // DeleteBlockByID deletes the room restriction
-func (m *postgresDBRepo) DeleteBlockByID(roomID int) error {
-	context, cancel := context2.WithTimeout(context2.Background(), 3*time.Second)
+func (m *postgresDBRepo) DeleteBlockByID(ctx context.Context, roomID int) error {
+	ctx, cancel := m.queryContext(ctx)
 	defer cancel()
 
 	query := `delete from room_restrictions where id = $1`
 
-	_, err := m.DB.ExecContext(context, query, roomID)
+	_, err := m.DB.ExecContext(ctx, query, roomID)
 	if err != nil {
 		log.Println(err)
 		return err
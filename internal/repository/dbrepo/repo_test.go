@@ -0,0 +1,1471 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/FilipeParreiras/Bookings/internal/config"
+	"github.com/FilipeParreiras/Bookings/internal/driver"
+	"github.com/FilipeParreiras/Bookings/internal/migrations"
+	"github.com/FilipeParreiras/Bookings/internal/models"
+	"github.com/FilipeParreiras/Bookings/internal/repository"
+	"github.com/FilipeParreiras/Bookings/internal/repository/dbrepo/memrepo"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSQLiteTestRepo returns a repository on a fresh, fully migrated sqlite file
+func newSQLiteTestRepo(t *testing.T) repository.DatabaseRepo {
+	t.Helper()
+
+	db, err := driver.ConnectSQLite(filepath.Join(t.TempDir(), "bookings.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.SQL.Close() })
+
+	migrator, err := migrations.New(db.SQL, migrations.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = migrator.Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewSQLiteRepo(db.SQL, &config.AppConfig{DBTimeout: 5 * time.Second})
+}
+
+// postgresDSNEnv names the variable with a connection string to a Postgres database the tests can create schemas
+// in, like "host=localhost user=postgres dbname=bookings_test". The tests skip Postgres when it is not set.
+const postgresDSNEnv = "BOOKINGS_TEST_POSTGRES_DSN"
+
+// newPostgresTestRepo returns a repository on a fresh, fully migrated schema of the database at dsn, which is
+// dropped when the test ends
+func newPostgresTestRepo(t *testing.T, dsn string) repository.DatabaseRepo {
+	t.Helper()
+
+	admin, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("bookings_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("create schema " + schema); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("drop schema " + schema + " cascade"); err != nil {
+			t.Error(err)
+		}
+		admin.Close()
+	})
+
+	// every connection of the pool works in the schema, extensions already in public stay usable
+	searchPath := "search_path=" + schema + ",public"
+	switch {
+	case strings.Contains(dsn, "://") && strings.Contains(dsn, "?"):
+		dsn += "&" + searchPath
+	case strings.Contains(dsn, "://"):
+		dsn += "?" + searchPath
+	default:
+		dsn += " " + searchPath
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db, migrations.Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = migrator.Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewPostgresRepo(db, &config.AppConfig{DBTimeout: 5 * time.Second})
+}
+
+// backends returns every repository that must behave like the production database, with Postgres when
+// postgresDSNEnv is set
+func backends(t *testing.T) map[string]repository.DatabaseRepo {
+	repos := map[string]repository.DatabaseRepo{
+		"sqlite": newSQLiteTestRepo(t),
+		"memory": memrepo.New(&config.AppConfig{}),
+	}
+
+	if dsn := os.Getenv(postgresDSNEnv); dsn != "" {
+		repos["postgres"] = newPostgresTestRepo(t, dsn)
+	}
+
+	return repos
+}
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestRepo_Booking(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			reservation := models.Reservation{
+				FirstName:  "John",
+				LastName:   "Smith",
+				Email:      "john@smith.com",
+				StartDate:  date("2050-01-01"),
+				EndDate:    date("2050-01-04"),
+				RoomID:     1,
+				TotalPrice: 36000,
+			}
+
+			id, err := repo.InsertReservationWithRestriction(ctx, reservation)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			saved, err := repo.GetReservationById(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !saved.StartDate.Equal(reservation.StartDate) || saved.Room.RoomName != "General's Quarters" ||
+				saved.TotalPrice != 36000 {
+				t.Errorf("saved reservation does not match: %+v", saved)
+			}
+
+			// overlapping stay in the same room
+			reservation.StartDate = date("2050-01-03")
+			reservation.EndDate = date("2050-01-05")
+			_, err = repo.InsertReservationWithRestriction(ctx, reservation)
+			var conflict *repository.ConflictError
+			if !errors.As(err, &conflict) || !errors.Is(err, repository.ErrRoomUnavailable) {
+				t.Errorf("expected a conflict for overlapping dates but got %v", err)
+			}
+
+			// a stay starting on the departure day is fine
+			reservation.StartDate = date("2050-01-04")
+			reservation.EndDate = date("2050-01-06")
+			_, err = repo.InsertReservationWithRestriction(ctx, reservation)
+			if err != nil {
+				t.Errorf("could not book from the departure day of the previous stay: %v", err)
+			}
+
+			all, err := repo.AllReservations(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(all) != 2 {
+				t.Errorf("expected 2 reservations but got %d", len(all))
+			}
+		})
+	}
+}
+
+func TestRepo_Availability(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			_, err := repo.InsertReservationWithRestriction(ctx, models.Reservation{
+				FirstName: "John",
+				LastName:  "Smith",
+				Email:     "john@smith.com",
+				StartDate: date("2050-01-10"),
+				EndDate:   date("2050-01-15"),
+				RoomID:    1,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var tests = []struct {
+				name      string
+				start     string
+				end       string
+				available bool
+			}{
+				{"before", "2050-01-05", "2050-01-10", true},
+				{"after", "2050-01-15", "2050-01-20", true},
+				{"inside", "2050-01-11", "2050-01-12", false},
+				{"covering", "2050-01-01", "2050-01-31", false},
+				{"overlapping end", "2050-01-14", "2050-01-16", false},
+			}
+
+			for _, e := range tests {
+				available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, date(e.start), date(e.end), 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if available != e.available {
+					t.Errorf("%s: expected available %t but got %t", e.name, e.available, available)
+				}
+			}
+
+			rooms, err := repo.SearchAvailabilityForAllRooms(ctx, date("2050-01-11"), date("2050-01-12"), models.RoomSearch{Guests: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rooms) != 1 || rooms[0].ID != 2 {
+				t.Errorf("expected only room 2 to be available but got %+v", rooms)
+			}
+		})
+	}
+}
+
+func TestRepo_Blocks(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			err := repo.InsertBlockForUnit(ctx, 2, date("2050-02-01"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = repo.InsertBlockForUnit(ctx, 2, date("2050-02-01"))
+			if !errors.Is(err, repository.ErrRoomUnavailable) {
+				t.Errorf("expected ErrRoomUnavailable for a second block on the same night but got %v", err)
+			}
+
+			_, err = repo.InsertReservationWithRestriction(ctx, models.Reservation{
+				FirstName: "John",
+				LastName:  "Smith",
+				Email:     "john@smith.com",
+				StartDate: date("2050-01-30"),
+				EndDate:   date("2050-02-03"),
+				RoomID:    2,
+			})
+			if !errors.Is(err, repository.ErrRoomUnavailable) {
+				t.Errorf("expected ErrRoomUnavailable for a reservation over a block but got %v", err)
+			}
+
+			restrictions, err := repo.GetRestrictions(ctx, 2, date("2050-02-01"), date("2050-02-28"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(restrictions) != 1 || restrictions[0].ReservationID != 0 {
+				t.Fatalf("expected one block but got %+v", restrictions)
+			}
+
+			err = repo.DeleteBlockByID(ctx, restrictions[0].ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, date("2050-02-01"), date("2050-02-02"), 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !available {
+				t.Error("room is still unavailable after its block was deleted")
+			}
+		})
+	}
+}
+
+func TestRepo_BlockRange(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			restrictions, err := repo.AllRestrictions(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(restrictions) != 4 || restrictions[2].RestrictionName != "Maintenance" {
+				t.Fatalf("expected the four seeded restriction types but got %+v", restrictions)
+			}
+
+			err = repo.InsertBlock(ctx, models.RoomRestriction{
+				RoomID:        1,
+				RestrictionID: 3,
+				StartDate:     date("2050-04-10"),
+				EndDate:       date("2050-04-15"),
+				Reason:        "Repainting",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = repo.InsertBlock(ctx, models.RoomRestriction{
+				RoomID:        1,
+				RestrictionID: 4,
+				StartDate:     date("2050-04-14"),
+				EndDate:       date("2050-04-16"),
+			})
+			if !errors.Is(err, repository.ErrRoomUnavailable) {
+				t.Errorf("expected ErrRoomUnavailable for an overlapping block but got %v", err)
+			}
+
+			// the end date is free again
+			err = repo.InsertBlock(ctx, models.RoomRestriction{
+				RoomID:        1,
+				RestrictionID: 4,
+				StartDate:     date("2050-04-15"),
+				EndDate:       date("2050-04-16"),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			blocks, err := repo.GetRestrictions(ctx, 1, date("2050-04-01"), date("2050-04-30"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(blocks) != 2 {
+				t.Fatalf("expected two blocks but got %+v", blocks)
+			}
+			if blocks[0].Reason != "Repainting" || blocks[0].Restriction.RestrictionName != "Maintenance" {
+				t.Errorf("expected the maintenance block first but got %+v", blocks[0])
+			}
+			if blocks[1].Restriction.RestrictionName != "Out of Order" {
+				t.Errorf("expected an out of order block but got %+v", blocks[1])
+			}
+
+			for _, d := range []string{"2050-04-10", "2050-04-14"} {
+				available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, date(d), date(d).AddDate(0, 0, 1), 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if available {
+					t.Errorf("room is available on %s inside the block", d)
+				}
+			}
+		})
+	}
+}
+
+func TestRepo_Restrictions(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			reservations, err := repo.GetRestrictionByID(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reservations.ForReservations || !reservations.CountsTowardOccupancy || reservations.Colour != "#dc3545" {
+				t.Errorf("unexpected reservation type %+v", reservations)
+			}
+
+			id, err := repo.InsertRestriction(ctx, models.Restriction{
+				RestrictionName: "Deep Clean",
+				Colour:          "#198754",
+				ForReservations: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = repo.UpdateRestriction(ctx, models.Restriction{
+				ID:                    id,
+				RestrictionName:       "Deep Cleaning",
+				Colour:                "#20c997",
+				CountsTowardOccupancy: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			restriction, err := repo.GetRestrictionByID(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if restriction.RestrictionName != "Deep Cleaning" || restriction.Colour != "#20c997" ||
+				!restriction.CountsTowardOccupancy || restriction.ForReservations {
+				t.Errorf("unexpected restriction type after update %+v", restriction)
+			}
+
+			// guest bookings are recorded under the reservations type
+			_, err = repo.InsertReservationWithRestriction(ctx, models.Reservation{
+				FirstName: "John",
+				LastName:  "Smith",
+				Email:     "john@smith.com",
+				StartDate: date("2050-05-01"),
+				EndDate:   date("2050-05-03"),
+				RoomID:    1,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = repo.InsertBlock(ctx, models.RoomRestriction{
+				RoomID:        1,
+				RestrictionID: id,
+				StartDate:     date("2050-05-10"),
+				EndDate:       date("2050-05-12"),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			restrictions, err := repo.GetRestrictions(ctx, 1, date("2050-05-01"), date("2050-05-31"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(restrictions) != 2 || !restrictions[0].Restriction.ForReservations ||
+				restrictions[1].Restriction.RestrictionName != "Deep Cleaning" {
+				t.Fatalf("unexpected restrictions %+v", restrictions)
+			}
+
+			for _, restrictionID := range []int{1, id} {
+				err = repo.DeleteRestriction(ctx, restrictionID)
+				if !errors.Is(err, repository.ErrRestrictionInUse) {
+					t.Errorf("expected ErrRestrictionInUse deleting restriction type %d but got %v", restrictionID, err)
+				}
+			}
+
+			err = repo.DeleteBlockByID(ctx, restrictions[1].ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = repo.DeleteRestriction(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = repo.GetRestrictionByID(ctx, id)
+			if !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("expected sql.ErrNoRows for a deleted restriction type but got %v", err)
+			}
+
+			// single night blocks from the calendar use the first type that is not for reservations
+			err = repo.InsertBlockForUnit(ctx, 2, date("2050-05-20"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			restrictions, err = repo.GetRestrictions(ctx, 2, date("2050-05-20"), date("2050-05-21"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(restrictions) != 1 || restrictions[0].RestrictionID != 2 {
+				t.Errorf("expected an owner block but got %+v", restrictions)
+			}
+		})
+	}
+}
+
+func TestRepo_DeleteReservationFreesRoom(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			id, err := repo.InsertReservationWithRestriction(ctx, models.Reservation{
+				FirstName: "John",
+				LastName:  "Smith",
+				Email:     "john@smith.com",
+				StartDate: date("2050-03-01"),
+				EndDate:   date("2050-03-02"),
+				RoomID:    1,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = repo.DeleteReservation(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, date("2050-03-01"), date("2050-03-02"), 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !available {
+				t.Error("room restriction was not removed with its reservation")
+			}
+		})
+	}
+}
+
+func TestRepo_RestrictionsForAllRooms(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			// the last stay checks out as the month starts, so it takes up no night of it
+			for _, stay := range []struct {
+				roomID     int
+				start, end string
+			}{{2, "2050-10-05", "2050-10-06"}, {1, "2050-10-01", "2050-10-03"}, {1, "2050-09-25", "2050-10-01"}} {
+				_, err := repo.InsertReservationWithRestriction(ctx, models.Reservation{
+					FirstName: "John",
+					LastName:  "Smith",
+					Email:     "john@smith.com",
+					StartDate: date(stay.start),
+					EndDate:   date(stay.end),
+					RoomID:    stay.roomID,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			restrictions, err := repo.GetRestrictionsForAllRooms(ctx, date("2050-10-01"), date("2050-11-01"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(restrictions) != 2 {
+				t.Fatalf("got %d restrictions, wanted 2", len(restrictions))
+			}
+			if restrictions[0].RoomID != 1 || restrictions[1].RoomID != 2 {
+				t.Errorf("restrictions are not ordered by room: %+v", restrictions)
+			}
+			if restrictions[0].UnitID == 0 || !restrictions[0].StartDate.Equal(date("2050-10-01")) {
+				t.Errorf("unexpected restriction %+v", restrictions[0])
+			}
+		})
+	}
+}
+
+func TestRepo_GuestCapacity(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			var tests = []struct {
+				guests int
+				rooms  []int
+			}{
+				{2, []int{1, 2}},
+				{3, []int{2}},
+				{4, []int{2}},
+				{5, nil},
+			}
+
+			for _, e := range tests {
+				rooms, err := repo.SearchAvailabilityForAllRooms(ctx, date("2050-06-01"), date("2050-06-03"),
+					models.RoomSearch{Guests: e.guests})
+				if err != nil {
+					t.Fatal(err)
+				}
+				var ids []int
+				for _, room := range rooms {
+					ids = append(ids, room.ID)
+				}
+				if fmt.Sprint(ids) != fmt.Sprint(e.rooms) {
+					t.Errorf("%d guests: expected rooms %v but got %v", e.guests, e.rooms, ids)
+				}
+			}
+
+			id, err := repo.InsertReservationWithRestriction(ctx, models.Reservation{
+				FirstName: "John",
+				LastName:  "Smith",
+				Email:     "john@smith.com",
+				StartDate: date("2050-06-01"),
+				EndDate:   date("2050-06-03"),
+				RoomID:    2,
+				Adults:    2,
+				Children:  1,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			saved, err := repo.GetReservationById(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if saved.Adults != 2 || saved.Children != 1 {
+				t.Errorf("expected 2 adults and 1 child but got %d and %d", saved.Adults, saved.Children)
+			}
+
+			all, err := repo.AllReservations(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(all) != 1 || all[0].Adults != 2 || all[0].Children != 1 {
+				t.Errorf("guest counts missing from all reservations: %+v", all)
+			}
+		})
+	}
+}
+
+func TestRepo_AmenitySearch(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			amenities, err := repo.AllAmenities(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(amenities) != 6 || amenities[0].Name != "Accessible" {
+				t.Fatalf("expected the six seeded amenities by name but got %+v", amenities)
+			}
+
+			ids := make(map[string]int)
+			for _, a := range amenities {
+				ids[a.Name] = a.ID
+			}
+
+			var tests = []struct {
+				name      string
+				amenities []int
+				rooms     []int
+			}{
+				{"no amenities", nil, []int{1, 2}},
+				{"ocean view", []int{ids["Ocean view"]}, []int{1}},
+				{"in every room", []int{ids["Private bathroom"]}, []int{1, 2}},
+				{"both", []int{ids["Private bathroom"], ids["Pet-friendly"]}, []int{2}},
+				{"repeated", []int{ids["Pet-friendly"], ids["Pet-friendly"]}, []int{2}},
+				{"in no room", []int{ids["Ocean view"], ids["Pet-friendly"]}, nil},
+			}
+
+			for _, e := range tests {
+				rooms, err := repo.SearchAvailabilityForAllRooms(ctx, date("2050-07-01"), date("2050-07-03"),
+					models.RoomSearch{Guests: 1, AmenityIDs: e.amenities})
+				if err != nil {
+					t.Fatal(err)
+				}
+				var found []int
+				for _, room := range rooms {
+					found = append(found, room.ID)
+				}
+				if fmt.Sprint(found) != fmt.Sprint(e.rooms) {
+					t.Errorf("%s: expected rooms %v but got %v", e.name, e.rooms, found)
+				}
+				if len(rooms) > 0 && len(rooms[0].Amenities) == 0 {
+					t.Errorf("%s: rooms returned without their amenities", e.name)
+				}
+			}
+
+			room, err := repo.GetRoomByID(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			room.Amenities = []models.Amenity{{ID: ids["Pet-friendly"]}, {ID: ids["Bathtub"]}}
+			err = repo.UpdateRoom(ctx, room)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			room, _ = repo.GetRoomByID(ctx, 1)
+			if len(room.Amenities) != 2 || room.Amenities[0].Name != "Bathtub" || room.Amenities[1].Name != "Pet-friendly" {
+				t.Errorf("expected the bathtub and pet-friendly amenities but got %+v", room.Amenities)
+			}
+		})
+	}
+}
+
+func TestRepo_Bookings(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			leg := func(roomID int, start, end string) models.Reservation {
+				return models.Reservation{
+					FirstName: "John",
+					LastName:  "Smith",
+					Email:     "john@smith.com",
+					StartDate: date(start),
+					EndDate:   date(end),
+					RoomID:    roomID,
+					Adults:    2,
+				}
+			}
+
+			id, err := repo.InsertBooking(ctx, []models.Reservation{
+				leg(2, "2050-08-04", "2050-08-06"),
+				leg(1, "2050-08-01", "2050-08-04"),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			booking, err := repo.GetBookingByID(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(booking.Reservations) != 2 || booking.Reservations[0].Room.RoomName != "General's Quarters" ||
+				booking.Reservations[1].RoomID != 2 {
+				t.Fatalf("expected the General's Quarters then the Major's Suite but got %+v", booking.Reservations)
+			}
+
+			saved, err := repo.GetReservationById(ctx, booking.Reservations[1].ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if saved.BookingID != id || saved.Adults != 2 {
+				t.Errorf("expected a reservation of booking %d but got %+v", id, saved)
+			}
+
+			// the second leg is taken, so the first one is not booked either
+			_, err = repo.InsertBooking(ctx, []models.Reservation{
+				leg(2, "2050-08-02", "2050-08-04"),
+				leg(1, "2050-08-03", "2050-08-05"),
+			})
+			var conflict *repository.ConflictError
+			if !errors.As(err, &conflict) || conflict.RoomID != 1 {
+				t.Errorf("expected a conflict for the General's Quarters but got %v", err)
+			}
+
+			available, err := repo.SearchAvailabilityByDatesByRoomID(ctx, date("2050-08-02"), date("2050-08-04"), 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !available {
+				t.Error("the first leg of a booking that failed was kept")
+			}
+
+			single, err := repo.InsertReservationWithRestriction(ctx, leg(2, "2050-09-01", "2050-09-02"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			saved, _ = repo.GetReservationById(ctx, single)
+			if saved.BookingID != 0 {
+				t.Errorf("a stay in one room is part of booking %d", saved.BookingID)
+			}
+		})
+	}
+}
+
+func TestRepo_Users(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			hashed, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ownerID, err := repo.InsertUser(ctx, models.User{
+				FirstName: "Olivia", LastName: "Owner", Email: "olivia@example.com",
+				Password: string(hashed), AccessLevel: 4, Active: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expires := time.Date(2050, 1, 4, 12, 0, 0, 0, time.UTC)
+			deskID, err := repo.InsertUser(ctx, models.User{
+				FirstName: "Dan", LastName: "Desk", Email: "dan@example.com", AccessLevel: 2, Active: true,
+				PasswordTokenHash: strings.Repeat("a", 64), PasswordTokenExpiresAt: expires,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = repo.InsertUser(ctx, models.User{FirstName: "Copy", Email: "dan@example.com", AccessLevel: 1})
+			if !errors.Is(err, repository.ErrEmailTaken) {
+				t.Errorf("expected repository.ErrEmailTaken for a taken email but got %v", err)
+			}
+
+			users, err := repo.AllUsers(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(users) != 2 || users[0].ID != deskID || users[1].ID != ownerID {
+				t.Fatalf("users are not by name: %+v", users)
+			}
+			if !users[1].Active || users[1].SessionVersion != 1 || users[1].PasswordTokenHash != "" ||
+				!users[1].PasswordTokenExpiresAt.IsZero() {
+				t.Errorf("unexpected owner %+v", users[1])
+			}
+
+			// an invited user has a token and no password, so cannot log in yet
+			desk, err := repo.GetUserByPasswordToken(ctx, strings.Repeat("a", 64))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if desk.ID != deskID || desk.Password != "" || !desk.PasswordTokenExpiresAt.Equal(expires) {
+				t.Errorf("unexpected invited user %+v", desk)
+			}
+			if _, _, err := repo.Authenticate(ctx, "dan@example.com", ""); err == nil {
+				t.Error("a user without a password logged in")
+			}
+
+			_, err = repo.GetUserByPasswordToken(ctx, strings.Repeat("b", 64))
+			if !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("expected sql.ErrNoRows for an unknown token but got %v", err)
+			}
+
+			// setting a password uses up the token
+			if err := repo.UpdatePassword(ctx, deskID, string(hashed)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := repo.GetUserByPasswordToken(ctx, strings.Repeat("a", 64)); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("a token still works after setting a password: %v", err)
+			}
+			if id, _, err := repo.Authenticate(ctx, "dan@example.com", "password"); err != nil || id != deskID {
+				t.Errorf("could not log in with the new password: %d %v", id, err)
+			}
+
+			// updates only change the one user
+			desk.FirstName = "Daniel"
+			desk.AccessLevel = 3
+			if err := repo.UpdateUser(ctx, desk); err != nil {
+				t.Fatal(err)
+			}
+			owner, _ := repo.GetUserByID(ctx, ownerID)
+			if owner.FirstName != "Olivia" || owner.AccessLevel != 4 {
+				t.Errorf("updating one user changed another: %+v", owner)
+			}
+			desk, _ = repo.GetUserByID(ctx, deskID)
+			if desk.FirstName != "Daniel" || desk.AccessLevel != 3 || desk.Email != "dan@example.com" {
+				t.Errorf("unexpected updated user %+v", desk)
+			}
+
+			desk.Email = "olivia@example.com"
+			if err := repo.UpdateUser(ctx, desk); !errors.Is(err, repository.ErrEmailTaken) {
+				t.Errorf("expected repository.ErrEmailTaken for a taken email but got %v", err)
+			}
+
+			// deactivated users cannot log in
+			if err := repo.UpdateUserActive(ctx, deskID, false); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := repo.Authenticate(ctx, "dan@example.com", "password"); err == nil {
+				t.Error("a deactivated user logged in")
+			}
+			if owner, _ := repo.GetUserByID(ctx, ownerID); !owner.Active {
+				t.Error("deactivating one user deactivated another")
+			}
+			if err := repo.UpdateUserActive(ctx, deskID, true); err != nil {
+				t.Fatal(err)
+			}
+
+			// setting a password and deactivating end the sessions, reactivating does not
+			if desk, _ := repo.GetUserByID(ctx, deskID); desk.SessionVersion != 3 {
+				t.Errorf("expected session version 3 after a new password and deactivation but got %d",
+					desk.SessionVersion)
+			}
+
+			// resetting a password clears it until a new one is set with the token
+			if err := repo.ResetPassword(ctx, ownerID, strings.Repeat("c", 64), expires); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := repo.Authenticate(ctx, "olivia@example.com", "password"); err == nil {
+				t.Error("logged in with a reset password")
+			}
+			owner, err = repo.GetUserByPasswordToken(ctx, strings.Repeat("c", 64))
+			if err != nil || owner.ID != ownerID || owner.Password != "" || owner.SessionVersion != 2 {
+				t.Errorf("unexpected reset user %+v %v", owner, err)
+			}
+			if id, _, err := repo.Authenticate(ctx, "dan@example.com", "password"); err != nil || id != deskID {
+				t.Errorf("resetting one password changed another: %d %v", id, err)
+			}
+		})
+	}
+}
+
+func TestRepo_APIKeys(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			readID, err := repo.InsertAPIKey(ctx, models.APIKey{
+				Name: "Channel manager", Prefix: "bk_0123abcd", KeyHash: strings.Repeat("a", 64), Scope: "read",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeID, err := repo.InsertAPIKey(ctx, models.APIKey{
+				Name: "Booking script", Prefix: "bk_4567efab", KeyHash: strings.Repeat("b", 64), Scope: "write",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = repo.InsertAPIKey(ctx, models.APIKey{
+				Name: "Copy", Prefix: "bk_0123abcd", KeyHash: strings.Repeat("a", 64), Scope: "read",
+			})
+			if err == nil {
+				t.Error("inserted two keys with the same hash")
+			}
+
+			key, err := repo.GetAPIKeyByHash(ctx, strings.Repeat("a", 64))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.ID != readID || key.Scope != "read" || key.Name != "Channel manager" {
+				t.Errorf("unexpected key %+v", key)
+			}
+			if !key.LastUsedAt.IsZero() || !key.RevokedAt.IsZero() {
+				t.Errorf("a new key is used or revoked: %+v", key)
+			}
+
+			_, err = repo.GetAPIKeyByHash(ctx, strings.Repeat("c", 64))
+			if !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("expected sql.ErrNoRows for an unknown key but got %v", err)
+			}
+
+			used := time.Date(2050, 1, 2, 3, 4, 5, 0, time.UTC)
+			if err := repo.UpdateAPIKeyLastUsed(ctx, readID, used); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.RevokeAPIKey(ctx, writeID); err != nil {
+				t.Fatal(err)
+			}
+
+			keys, err := repo.AllAPIKeys(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(keys) != 2 || keys[0].ID != writeID || keys[1].ID != readID {
+				t.Fatalf("keys are not newest first: %+v", keys)
+			}
+			if keys[0].RevokedAt.IsZero() || !keys[1].RevokedAt.IsZero() {
+				t.Error("only the write key should be revoked")
+			}
+			if !keys[1].LastUsedAt.Equal(used) {
+				t.Errorf("key was last used at %v, wanted %v", keys[1].LastUsedAt, used)
+			}
+
+			// revoking again keeps the first revocation
+			revokedAt := keys[0].RevokedAt
+			if err := repo.RevokeAPIKey(ctx, writeID); err != nil {
+				t.Fatal(err)
+			}
+			key, _ = repo.GetAPIKeyByHash(ctx, strings.Repeat("b", 64))
+			if !key.RevokedAt.Equal(revokedAt) {
+				t.Error("revoking a revoked key changed when it was revoked")
+			}
+		})
+	}
+}
+
+func TestRepo_Webhooks(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			allID, err := repo.InsertWebhook(ctx, models.Webhook{
+				URL:    "https://channel.example.com/hooks",
+				Secret: "whsec_all",
+				Events: []string{"reservation.created", "reservation.deleted"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			deletedID, err := repo.InsertWebhook(ctx, models.Webhook{
+				URL:    "https://accounting.example.com/hooks",
+				Secret: "whsec_deleted",
+				Events: []string{"reservation.deleted"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hooks, err := repo.AllWebhooks(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(hooks) != 2 || hooks[0].ID != deletedID || hooks[1].ID != allID {
+				t.Fatalf("webhooks are not newest first: %+v", hooks)
+			}
+			if strings.Join(hooks[1].Events, ",") != "reservation.created,reservation.deleted" {
+				t.Errorf("unexpected events %v", hooks[1].Events)
+			}
+
+			// each event is queued for the webhooks subscribed to it
+			var events = []struct {
+				event    string
+				expected int
+			}{
+				{"reservation.created", 1},
+				{"reservation.deleted", 2},
+				{"reservation.processed", 0},
+			}
+			for _, e := range events {
+				queued, err := repo.InsertWebhookDeliveries(ctx, e.event, `{"event": "`+e.event+`"}`)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if queued != e.expected {
+					t.Errorf("%s was queued %d times, wanted %d", e.event, queued, e.expected)
+				}
+			}
+
+			now := time.Now().Add(time.Minute)
+			limited, err := repo.ClaimWebhookDeliveries(ctx, now, time.Minute, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(limited) != 2 {
+				t.Fatalf("expected the limit of 2 deliveries but got %d", len(limited))
+			}
+
+			// claimed deliveries are not claimed again until the lease runs out
+			due, err := repo.ClaimWebhookDeliveries(ctx, now, time.Minute, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(due) != 1 || due[0].ID == limited[0].ID || due[0].ID == limited[1].ID {
+				t.Fatalf("expected the one unclaimed delivery but got %+v", due)
+			}
+			due, _ = repo.ClaimWebhookDeliveries(ctx, now, time.Minute, 10)
+			if len(due) != 0 {
+				t.Fatalf("expected every delivery claimed but got %+v", due)
+			}
+
+			now = now.Add(2 * time.Minute)
+			due, err = repo.ClaimWebhookDeliveries(ctx, now, time.Minute, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(due) != 3 {
+				t.Fatalf("expected 3 due deliveries once the lease ran out but got %d", len(due))
+			}
+			if due[0].Event != "reservation.created" || due[0].Webhook.URL != "https://channel.example.com/hooks" ||
+				due[0].Webhook.Secret != "whsec_all" || due[0].Status != "pending" || due[0].Attempts != 0 {
+				t.Errorf("unexpected delivery %+v", due[0])
+			}
+
+			// one is delivered, one waits for a retry and one failed for good
+			delivered := due[0]
+			delivered.Status, delivered.Attempts, delivered.StatusCode = "delivered", 1, 200
+			delivered.DeliveredAt = now
+			retry := due[1]
+			retry.Status, retry.Attempts, retry.StatusCode, retry.Error = "pending", 1, 500, "500 Internal Server Error"
+			retry.NextAttemptAt = now.Add(time.Hour)
+			failed := due[2]
+			failed.Status, failed.Attempts, failed.Error = "failed", 10, "connection refused"
+			for _, d := range []models.WebhookDelivery{delivered, retry, failed} {
+				if err := repo.UpdateWebhookDelivery(ctx, d); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			due, _ = repo.ClaimWebhookDeliveries(ctx, now.Add(time.Minute), time.Minute, 10)
+			if len(due) != 0 {
+				t.Errorf("expected nothing due but got %+v", due)
+			}
+			due, _ = repo.ClaimWebhookDeliveries(ctx, now.Add(2*time.Hour), time.Minute, 10)
+			if len(due) != 1 || due[0].ID != retry.ID || due[0].StatusCode != 500 || due[0].Attempts != 1 {
+				t.Errorf("expected the retry due later but got %+v", due)
+			}
+
+			recent, err := repo.RecentWebhookDeliveries(ctx, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recent) != 3 || recent[0].ID != failed.ID || recent[2].ID != delivered.ID {
+				t.Fatalf("deliveries are not newest first: %+v", recent)
+			}
+			if recent[2].Status != "delivered" || recent[2].DeliveredAt.IsZero() || !recent[1].DeliveredAt.IsZero() {
+				t.Errorf("only the first delivery should be delivered: %+v", recent)
+			}
+			if recent[0].Error != "connection refused" {
+				t.Errorf("unexpected error %q", recent[0].Error)
+			}
+
+			// deleting a webhook deletes its deliveries
+			if err := repo.DeleteWebhook(ctx, deletedID); err != nil {
+				t.Fatal(err)
+			}
+			hooks, _ = repo.AllWebhooks(ctx)
+			recent, _ = repo.RecentWebhookDeliveries(ctx, 10)
+			if len(hooks) != 1 || len(recent) != 2 {
+				t.Errorf("expected 1 webhook and 2 deliveries but got %d and %d", len(hooks), len(recent))
+			}
+		})
+	}
+}
+
+func TestRepo_Rooms(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			id, err := repo.InsertRoom(ctx, models.Room{
+				RoomName:     "Colonel's Cabin",
+				Slug:         "colonels-cabin",
+				Description:  "A small cabin.",
+				Active:       true,
+				MaxOccupancy: 3,
+				Images:       []string{"/static/images/a.png", "/static/images/b.png"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			room, err := repo.GetRoomByID(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if room.Slug != "colonels-cabin" || room.MaxOccupancy != 3 || len(room.Images) != 2 ||
+				room.Images[1] != "/static/images/b.png" {
+				t.Errorf("saved room does not match: %+v", room)
+			}
+
+			// new rooms go last
+			rooms, err := repo.AllRooms(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rooms) != 3 || rooms[2].ID != id {
+				t.Fatalf("expected the new room last, got %+v", rooms)
+			}
+
+			room.RoomName = "Colonel's Lodge"
+			room.Images = []string{"/static/images/c.png"}
+			err = repo.UpdateRoom(ctx, room)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			room, _ = repo.GetRoomByID(ctx, id)
+			if room.RoomName != "Colonel's Lodge" || len(room.Images) != 1 || room.Images[0] != "/static/images/c.png" {
+				t.Errorf("updated room does not match: %+v", room)
+			}
+
+			err = repo.UpdateRoomOrder(ctx, []int{id, 1, 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rooms, _ = repo.AllRooms(ctx)
+			if rooms[0].ID != id || rooms[1].ID != 1 || rooms[2].ID != 2 {
+				t.Errorf("rooms not in the new order: %+v", rooms)
+			}
+
+			// inactive rooms cannot be found by guests
+			err = repo.UpdateRoomActive(ctx, id, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			available, err := repo.SearchAvailabilityForAllRooms(ctx, date("2050-05-01"), date("2050-05-02"), models.RoomSearch{Guests: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, x := range available {
+				if x.ID == id {
+					t.Error("inactive room shown as available")
+				}
+			}
+
+			err = repo.DeleteRoom(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = repo.GetRoomByID(ctx, id)
+			if err == nil {
+				t.Error("room still found after it was deleted")
+			}
+		})
+	}
+}
+
+func TestRepo_GetRoomBySlug(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			room, err := repo.GetRoomBySlug(ctx, "generals-quarters")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if room.ID != 1 || room.Description == "" || len(room.Images) != 1 {
+				t.Errorf("room does not match the seed data: %+v", room)
+			}
+
+			var amenities []string
+			for _, a := range room.Amenities {
+				amenities = append(amenities, a.Name)
+			}
+			if strings.Join(amenities, ", ") != "Free Wi-Fi, Ocean view, Private bathroom" {
+				t.Errorf("unexpected amenities: %v", amenities)
+			}
+
+			_, err = repo.GetRoomBySlug(ctx, "colonels-cabin")
+			if !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("expected sql.ErrNoRows for an unknown slug but got %v", err)
+			}
+		})
+	}
+}
+
+func TestRepo_RoomRates(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			room, err := repo.GetRoomByID(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			room.WeekendRate = 15000
+			err = repo.UpdateRoom(ctx, room)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			room, _ = repo.GetRoomByID(ctx, 1)
+			if room.WeekendRate != 15000 {
+				t.Errorf("weekend rate not saved: %+v", room)
+			}
+
+			var ids []int
+			for _, rate := range []models.RoomRate{
+				{RoomID: 1, Name: "Summer", StartDate: date("2050-06-15"), EndDate: date("2050-09-15"), NightlyRate: 15000},
+				{RoomID: 1, Name: "Christmas", StartDate: date("2050-12-24"), EndDate: date("2050-12-27"), NightlyRate: 20000, WeekendRate: 22000},
+				{RoomID: 2, Name: "Summer", StartDate: date("2050-06-15"), EndDate: date("2050-09-15"), NightlyRate: 11000},
+			} {
+				id, err := repo.InsertRoomRate(ctx, rate)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, id)
+			}
+
+			rates, err := repo.AllRoomRates(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rates) != 2 || rates[0].Name != "Summer" || rates[1].WeekendRate != 22000 {
+				t.Errorf("unexpected rates for room 1: %+v", rates)
+			}
+
+			var tests = []struct {
+				start    string
+				end      string
+				expected int
+			}{
+				{"2050-06-10", "2050-06-15", 0}, // departs the day summer starts
+				{"2050-06-10", "2050-06-16", 1},
+				{"2050-09-14", "2050-09-16", 1},
+				{"2050-09-15", "2050-09-16", 0},
+				{"2050-06-01", "2051-01-01", 2},
+			}
+
+			for _, e := range tests {
+				rates, err := repo.GetRoomRates(ctx, 1, date(e.start), date(e.end))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(rates) != e.expected {
+					t.Errorf("%s to %s: expected %d rates but got %d", e.start, e.end, e.expected, len(rates))
+				}
+			}
+
+			err = repo.DeleteRoomRate(ctx, ids[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rates, _ = repo.AllRoomRates(ctx, 1)
+			if len(rates) != 1 || rates[0].Name != "Christmas" {
+				t.Errorf("rate not deleted: %+v", rates)
+			}
+		})
+	}
+}
+
+func TestRepo_StayRules(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			id, err := repo.InsertStayRule(ctx, models.StayRule{
+				RoomID:            1,
+				Name:              "August",
+				StartDate:         date("2050-08-01"),
+				EndDate:           date("2050-09-01"),
+				MinNights:         3,
+				ClosedToDeparture: 1,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rules, err := repo.AllStayRules(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rules) != 1 || rules[0].MinNights != 3 || rules[0].ClosedToDeparture != 1 {
+				t.Errorf("unexpected stay rules: %+v", rules)
+			}
+
+			var tests = []struct {
+				start    string
+				end      string
+				expected int
+			}{
+				{"2050-07-25", "2050-07-31", 0},
+				{"2050-07-25", "2050-08-01", 1}, // departs the day the rule starts
+				{"2050-08-31", "2050-09-02", 1},
+				{"2050-09-01", "2050-09-02", 0},
+			}
+
+			for _, e := range tests {
+				rules, err := repo.GetStayRules(ctx, 1, date(e.start), date(e.end))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(rules) != e.expected {
+					t.Errorf("%s to %s: expected %d rules but got %d", e.start, e.end, e.expected, len(rules))
+				}
+			}
+
+			rules, _ = repo.GetStayRules(ctx, 2, date("2050-08-01"), date("2050-08-05"))
+			if len(rules) != 0 {
+				t.Errorf("rules of room 1 returned for room 2: %+v", rules)
+			}
+
+			err = repo.DeleteStayRule(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rules, _ = repo.AllStayRules(ctx, 1)
+			if len(rules) != 0 {
+				t.Errorf("stay rule not deleted: %+v", rules)
+			}
+		})
+	}
+}
+
+func TestRepo_DeleteRoomWithReservations(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			_, err := repo.InsertReservationWithRestriction(ctx, models.Reservation{
+				FirstName: "John",
+				LastName:  "Smith",
+				Email:     "john@smith.com",
+				StartDate: date("2050-04-01"),
+				EndDate:   date("2050-04-03"),
+				RoomID:    1,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = repo.DeleteRoom(ctx, 1)
+			if !errors.Is(err, repository.ErrRoomHasReservations) {
+				t.Errorf("expected ErrRoomHasReservations but got %v", err)
+			}
+
+			// past stays do not keep a room from being deleted
+			_, err = repo.InsertReservationWithRestriction(ctx, models.Reservation{
+				FirstName: "John",
+				LastName:  "Smith",
+				Email:     "john@smith.com",
+				StartDate: date("2020-04-01"),
+				EndDate:   date("2020-04-03"),
+				RoomID:    2,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = repo.DeleteRoom(ctx, 2)
+			if err != nil {
+				t.Errorf("room with only past reservations was not deleted: %v", err)
+			}
+		})
+	}
+}
+
+func TestRepo_RoomUnits(t *testing.T) {
+	for name, repo := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			units, err := repo.AllRoomUnits(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(units) != 1 || units[0].Name != "General's Quarters" {
+				t.Fatalf("expected the seeded unit but got %+v", units)
+			}
+
+			second, err := repo.InsertRoomUnit(ctx, models.RoomUnit{RoomID: 1, Name: "Annex"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			booking := models.Reservation{
+				FirstName: "John",
+				LastName:  "Smith",
+				Email:     "john@smith.com",
+				StartDate: date("2050-05-01"),
+				EndDate:   date("2050-05-04"),
+				RoomID:    1,
+			}
+
+			var unitIDs []int
+			for i := 0; i < 2; i++ {
+				id, err := repo.InsertReservationWithRestriction(ctx, booking)
+				if err != nil {
+					t.Fatalf("booking %d of two units failed: %v", i+1, err)
+				}
+				saved, err := repo.GetReservationById(ctx, id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				unitIDs = append(unitIDs, saved.Unit.ID)
+			}
+			if unitIDs[0] != units[0].ID || unitIDs[1] != second {
+				t.Errorf("expected the units to be assigned in order but got %v", unitIDs)
+			}
+
+			_, err = repo.InsertReservationWithRestriction(ctx, booking)
+			if !errors.Is(err, repository.ErrRoomUnavailable) {
+				t.Errorf("expected a conflict once every unit is taken but got %v", err)
+			}
+
+			rooms, err := repo.SearchAvailabilityForAllRooms(ctx, date("2050-05-03"), date("2050-05-05"), models.RoomSearch{Guests: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, room := range rooms {
+				if room.ID == 1 {
+					t.Errorf("room 1 has no free unit but was returned: %+v", room)
+				}
+			}
+
+			rooms, err = repo.SearchAvailabilityForAllRooms(ctx, date("2050-05-04"), date("2050-05-06"), models.RoomSearch{Guests: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			found := false
+			for _, room := range rooms {
+				if room.ID == 1 {
+					found = true
+					if room.Units != 2 || room.FreeUnits != 2 {
+						t.Errorf("expected two of two units free but got %d of %d", room.FreeUnits, room.Units)
+					}
+				}
+			}
+			if !found {
+				t.Error("room 1 is free from the departure day but was not returned")
+			}
+
+			err = repo.DeleteRoomUnit(ctx, second)
+			if !errors.Is(err, repository.ErrRoomHasReservations) {
+				t.Errorf("expected ErrRoomHasReservations but got %v", err)
+			}
+
+			empty, err := repo.InsertRoomUnit(ctx, models.RoomUnit{RoomID: 1, Name: "Loft"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = repo.DeleteRoomUnit(ctx, empty)
+			if err != nil {
+				t.Errorf("unit without reservations was not deleted: %v", err)
+			}
+		})
+	}
+}
@@ -1,118 +0,0 @@
-package dbrepo
-
-import (
-	"errors"
-	"github.com/FilipeParreiras/Bookings/internal/models"
-	"time"
-)
-
-func (m *testDBRepo) AllUsers() bool {
-	return true
-}
-
-// InsertReservation inserts a reservation into the database
-func (m *testDBRepo) InsertReservation(reservation models.Reservation) (int, error) {
-	// if the room id is 2 then fail; Otherwise pass
-	if reservation.RoomID == 2 {
-		return 0, errors.New("some error")
-	}
-	return 1, nil
-}
-
-// InsertRoomRestriction inserts a room restriction into the database
-func (m *testDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
-	if r.RoomID == 1000 {
-		return errors.New("some error")
-	}
-	return nil
-}
-
-// SearchAvailabilityByDatesByRoomID returns true if availability exists for roomID and false otherwise
-func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
-	return false, nil
-}
-
-// SearchAvailabilityForAllRooms returns a slice of available rooms if any for given date range
-func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
-	var rooms []models.Room
-	return rooms, nil
-}
-
-// GetRoomByID gets a room by ID
-func (m *testDBRepo) GetRoomByID(id int) (models.Room, error) {
-	var room models.Room
-	if id > 2 {
-		return room, errors.New("Some error")
-	}
-
-	return room, nil
-}
-
-func (m *testDBRepo) GetUserByID(id int) (models.User, error) {
-	var user models.User
-
-	return user, nil
-}
-
-func (m *testDBRepo) UpdateUser(user models.User) error {
-	return nil
-}
-
-func (m *testDBRepo) Authenticate(email, testPassword string) (int, string, error) {
-	return 1, "", nil
-}
-
-// AllReservations returns a slice of all reservations
-func (m *testDBRepo) AllReservations() ([]models.Reservation, error) {
-	var reservations []models.Reservation
-	return reservations, nil
-}
-
-// AllNewReservations returns a slice of all reservations
-func (m *testDBRepo) AllNewReservations() ([]models.Reservation, error) {
-	var reservations []models.Reservation
-	return reservations, nil
-}
-
-// GetReservationById returns one reservation by ID
-func (m *testDBRepo) GetReservationById(id int) (models.Reservation, error) {
-	var reservation models.Reservation
-
-	return reservation, nil
-}
-
-func (m *testDBRepo) UpdateReservation(reservation models.Reservation) error {
-	return nil
-}
-
-// DeleteReservation deletes one reservation by ID
-func (m *testDBRepo) DeleteReservation(id int) error {
-	return nil
-}
-
-// UpdateProcessedForReservation updates processed for a reservation by ID
-func (m *testDBRepo) UpdateProcessedForReservation(id, processed int) error {
-	return nil
-}
-
-// AllRooms returns a slice with all rooms
-func (m *testDBRepo) AllRooms() ([]models.Room, error) {
-	var rooms []models.Room
-	return rooms, nil
-}
-
-// GetRestrictions returns restrictions for a room by date range
-func (m *testDBRepo) GetRestrictions(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
-	var restrictions []models.RoomRestriction
-	return restrictions, nil
-}
-
-// InsertBlockForRoom inserts the room restriction
-func (m *testDBRepo) InsertBlockForRoom(roomID int, startDate time.Time) error {
-	return nil
-}
-
-// DeleteBlockByID deletes the room restriction
-func (m *testDBRepo) DeleteBlockByID(roomID int) error {
-	return nil
-}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRoomUnavailable is returned when a room restriction would overlap another one for the same room
+var ErrRoomUnavailable = errors.New("room is not available for the requested dates")
+
+// ErrRoomHasReservations is returned when deleting a room that guests have booked for the future
+var ErrRoomHasReservations = errors.New("room has future reservations")
+
+// ErrRestrictionInUse is returned when deleting a restriction type that reservations or blocks still use
+var ErrRestrictionInUse = errors.New("restriction type is in use")
+
+// ErrEmailTaken is returned when saving a user with the email of another user
+var ErrEmailTaken = errors.New("email is taken by another user")
+
+// ConflictError is returned when a room was taken for some of the requested dates
+// between the availability check and the booking. It wraps ErrRoomUnavailable.
+type ConflictError struct {
+	RoomID    int
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("room %d is no longer available from %s to %s",
+		e.RoomID, e.StartDate.Format("2006-01-02"), e.EndDate.Format("2006-01-02"))
+}
+
+func (e *ConflictError) Unwrap() error {
+	return ErrRoomUnavailable
+}
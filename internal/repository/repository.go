@@ -1,31 +1,78 @@
 package repository
 
 import (
+	"context"
 	"github.com/FilipeParreiras/Bookings/internal/models"
 	"time"
 )
 
+// DatabaseRepo is the storage used by the handlers. Every method takes the context of the request it serves,
+// so a query is cancelled when the client goes away.
 type DatabaseRepo interface {
-	AllUsers() bool
+	InsertReservationWithRestriction(ctx context.Context, reservation models.Reservation) (int, error)
+	InsertBooking(ctx context.Context, reservations []models.Reservation) (int, error)
+	GetBookingByID(ctx context.Context, id int) (models.Booking, error)
+	SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error)
+	SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time, search models.RoomSearch) ([]models.Room, error)
+	GetRoomByID(ctx context.Context, id int) (models.Room, error)
 
-	InsertReservation(reservation models.Reservation) (int, error)
-	InsertRoomRestriction(r models.RoomRestriction) error
-	SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error)
-	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
-	GetRoomByID(id int) (models.Room, error)
+	AllUsers(ctx context.Context) ([]models.User, error)
+	GetUserByID(ctx context.Context, id int) (models.User, error)
+	GetUserByPasswordToken(ctx context.Context, hash string) (models.User, error)
+	InsertUser(ctx context.Context, user models.User) (int, error)
+	UpdateUser(ctx context.Context, user models.User) error
+	UpdateUserActive(ctx context.Context, id int, active bool) error
+	ResetPassword(ctx context.Context, id int, tokenHash string, expiresAt time.Time) error
+	UpdatePassword(ctx context.Context, id int, hashedPassword string) error
+	Authenticate(ctx context.Context, email, testPassword string) (int, string, error)
 
-	GetUserByID(id int) (models.User, error)
-	UpdateUser(user models.User) error
-	Authenticate(email, testPassword string) (int, string, error)
+	AllAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error)
+	InsertAPIKey(ctx context.Context, key models.APIKey) (int, error)
+	RevokeAPIKey(ctx context.Context, id int) error
+	UpdateAPIKeyLastUsed(ctx context.Context, id int, at time.Time) error
 
-	AllReservations() ([]models.Reservation, error)
-	AllNewReservations() ([]models.Reservation, error)
-	GetReservationById(id int) (models.Reservation, error)
-	UpdateReservation(reservation models.Reservation) error
-	DeleteReservation(id int) error
-	UpdateProcessedForReservation(id, processed int) error
-	AllRooms() ([]models.Room, error)
-	GetRestrictions(roomID int, start, end time.Time) ([]models.RoomRestriction, error)
-	InsertBlockForRoom(roomID int, startDate time.Time) error
-	DeleteBlockByID(roomID int) error
+	AllWebhooks(ctx context.Context) ([]models.Webhook, error)
+	InsertWebhook(ctx context.Context, hook models.Webhook) (int, error)
+	DeleteWebhook(ctx context.Context, id int) error
+	InsertWebhookDeliveries(ctx context.Context, event, payload string) (int, error)
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, d models.WebhookDelivery) error
+	RecentWebhookDeliveries(ctx context.Context, limit int) ([]models.WebhookDelivery, error)
+
+	AllReservations(ctx context.Context) ([]models.Reservation, error)
+	AllNewReservations(ctx context.Context) ([]models.Reservation, error)
+	GetReservationById(ctx context.Context, id int) (models.Reservation, error)
+	UpdateReservation(ctx context.Context, reservation models.Reservation) error
+	DeleteReservation(ctx context.Context, id int) error
+	UpdateProcessedForReservation(ctx context.Context, id, processed int) error
+	AllRooms(ctx context.Context) ([]models.Room, error)
+	GetRoomBySlug(ctx context.Context, slug string) (models.Room, error)
+	AllAmenities(ctx context.Context) ([]models.Amenity, error)
+	InsertRoom(ctx context.Context, room models.Room) (int, error)
+	UpdateRoom(ctx context.Context, room models.Room) error
+	UpdateRoomActive(ctx context.Context, id int, active bool) error
+	UpdateRoomOrder(ctx context.Context, ids []int) error
+	DeleteRoom(ctx context.Context, id int) error
+	AllRoomRates(ctx context.Context, roomID int) ([]models.RoomRate, error)
+	GetRoomRates(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRate, error)
+	InsertRoomRate(ctx context.Context, rate models.RoomRate) (int, error)
+	DeleteRoomRate(ctx context.Context, id int) error
+	AllRoomUnits(ctx context.Context, roomID int) ([]models.RoomUnit, error)
+	InsertRoomUnit(ctx context.Context, unit models.RoomUnit) (int, error)
+	DeleteRoomUnit(ctx context.Context, id int) error
+	AllStayRules(ctx context.Context, roomID int) ([]models.StayRule, error)
+	GetStayRules(ctx context.Context, roomID int, start, end time.Time) ([]models.StayRule, error)
+	InsertStayRule(ctx context.Context, rule models.StayRule) (int, error)
+	DeleteStayRule(ctx context.Context, id int) error
+	GetRestrictions(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error)
+	GetRestrictionsForAllRooms(ctx context.Context, start, end time.Time) ([]models.RoomRestriction, error)
+	AllRestrictions(ctx context.Context) ([]models.Restriction, error)
+	GetRestrictionByID(ctx context.Context, id int) (models.Restriction, error)
+	InsertRestriction(ctx context.Context, r models.Restriction) (int, error)
+	UpdateRestriction(ctx context.Context, r models.Restriction) error
+	DeleteRestriction(ctx context.Context, id int) error
+	InsertBlockForUnit(ctx context.Context, unitID int, startDate time.Time) error
+	InsertBlock(ctx context.Context, block models.RoomRestriction) error
+	DeleteBlockByID(ctx context.Context, roomID int) error
 }
@@ -0,0 +1,56 @@
+package splitstay
+
+// A split stay covers the nights of a search with consecutive legs in different rooms, for when no single room
+// is free for every night. Nights are counted from the arrival date: night 0 is the first night.
+
+// Leg is a run of nights in one room, from night First up to, but not including, night Last
+type Leg struct {
+	RoomID int
+	First  int
+	Last   int
+}
+
+// Plan returns the fewest legs that cover every night, where free[i] holds the ids of the rooms free on night i in
+// order of preference. It returns nil when some night has no free room or more than maxLegs legs would be needed.
+// A single room free for every night is not a split stay, so Plan returns nil for it too.
+func Plan(free [][]int, maxLegs int) []Leg {
+	var legs []Leg
+
+	// taking the room free for the most nights from each first night needs the fewest moves
+	for first := 0; first < len(free); {
+		best := Leg{First: first, Last: first}
+		for _, roomID := range free[first] {
+			last := first + 1
+			for last < len(free) && contains(free[last], roomID) {
+				last++
+			}
+			if last > best.Last {
+				best = Leg{RoomID: roomID, First: first, Last: last}
+			}
+		}
+
+		if best.Last == first || len(legs) == maxLegs {
+			return nil
+		}
+
+		legs = append(legs, best)
+		first = best.Last
+	}
+
+	if len(legs) < 2 {
+		return nil
+	}
+
+	return legs
+}
+
+// contains reports if ids has id
+func contains(ids []int, id int) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+
+	return false
+}
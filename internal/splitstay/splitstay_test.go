@@ -0,0 +1,31 @@
+package splitstay
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	var tests = []struct {
+		name     string
+		free     [][]int
+		maxLegs  int
+		expected string
+	}{
+		{"one room every night", [][]int{{1, 2}, {1, 2}, {1}}, 3, "[]"},
+		{"two legs", [][]int{{1}, {1}, {1}, {2}, {2}, {2}, {2}}, 3, "[{1 0 3} {2 3 7}]"},
+		{"fewest moves", [][]int{{1, 2}, {1, 2}, {2}, {1}}, 3, "[{2 0 3} {1 3 4}]"},
+		{"preferred room on a tie", [][]int{{2, 1}, {2, 1}, {3}}, 3, "[{2 0 2} {3 2 3}]"},
+		{"back to the first room", [][]int{{1}, {2}, {1}}, 3, "[{1 0 1} {2 1 2} {1 2 3}]"},
+		{"too many legs", [][]int{{1}, {2}, {1}}, 2, "[]"},
+		{"a night with no room", [][]int{{1}, {}, {2}}, 3, "[]"},
+		{"no nights", nil, 3, "[]"},
+	}
+
+	for _, e := range tests {
+		legs := Plan(e.free, e.maxLegs)
+		if got := fmt.Sprint(legs); got != e.expected {
+			t.Errorf("%s: expected %s but got %s", e.name, e.expected, got)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package stayrules
+
+import (
+	"errors"
+	"fmt"
+	"github.com/FilipeParreiras/Bookings/internal/models"
+	"strings"
+	"time"
+)
+
+// Rules limit stays by their arrival and departure dates:
+//   - min and max nights apply to stays arriving while a rule is in force
+//   - closed to arrival days apply to arrival dates while a rule is in force
+//   - closed to departure days apply to departure dates while a rule is in force
+
+// ErrInvalidStay is returned when a stay does not end after it starts
+var ErrInvalidStay = errors.New("departure must be after arrival")
+
+// EveryDay is the weekdays bitmask with all seven days set
+const EveryDay = 1<<7 - 1
+
+// Violation is the error returned when a stay breaks a rule
+type Violation struct {
+	Rule   models.StayRule
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return v.Reason
+}
+
+// Check returns ErrInvalidStay for stays without nights, or a *Violation for the first rule the stay breaks
+func Check(rules []models.StayRule, start, end time.Time) error {
+	if !end.After(start) {
+		return ErrInvalidStay
+	}
+
+	nights := Nights(start, end)
+
+	for _, rule := range rules {
+		if inForce(rule, start) {
+			if rule.MinNights > 0 && nights < rule.MinNights {
+				return violation(rule, "stays must be at least %d nights", rule.MinNights)
+			}
+			if rule.MaxNights > 0 && nights > rule.MaxNights {
+				return violation(rule, "stays can be at most %d nights", rule.MaxNights)
+			}
+			if HasDay(rule.ClosedToArrival, start.Weekday()) {
+				return violation(rule, "no arrivals on %s", dayName(start))
+			}
+		}
+
+		if inForce(rule, end) && HasDay(rule.ClosedToDeparture, end.Weekday()) {
+			return violation(rule, "no departures on %s", dayName(end))
+		}
+	}
+
+	return nil
+}
+
+// Nights returns the number of nights from start to end
+func Nights(start, end time.Time) int {
+	return int(end.Sub(start).Hours()+12) / 24
+}
+
+// Mask returns the weekdays bitmask with the given days set
+func Mask(days ...time.Weekday) int {
+	mask := 0
+	for _, d := range days {
+		mask |= 1 << d
+	}
+	return mask
+}
+
+// HasDay tells if a weekday is set in a weekdays bitmask
+func HasDay(mask int, day time.Weekday) bool {
+	return mask&(1<<day) != 0
+}
+
+// DayNames lists the weekdays set in a bitmask, like "Saturday, Sunday"
+func DayNames(mask int) string {
+	if mask&EveryDay == EveryDay {
+		return "every day"
+	}
+
+	var names []string
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if HasDay(mask, d) {
+			names = append(names, d.String())
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// inForce tells if a rule applies to a date
+func inForce(rule models.StayRule, d time.Time) bool {
+	return !d.Before(rule.StartDate) && d.Before(rule.EndDate)
+}
+
+func violation(rule models.StayRule, format string, args ...interface{}) *Violation {
+	return &Violation{
+		Rule:   rule,
+		Reason: fmt.Sprintf("%s: %s", rule.Name, fmt.Sprintf(format, args...)),
+	}
+}
+
+// dayName names a date with its weekday, like Sunday 2050-12-25
+func dayName(d time.Time) string {
+	return fmt.Sprintf("%s %s", d.Weekday(), d.Format("2006-01-02"))
+}
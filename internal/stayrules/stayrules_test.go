@@ -0,0 +1,83 @@
+package stayrules
+
+import (
+	"errors"
+	"github.com/FilipeParreiras/Bookings/internal/models"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestCheck(t *testing.T) {
+	rules := []models.StayRule{
+		{ID: 1, Name: "August", StartDate: date("2050-08-01"), EndDate: date("2050-09-01"), MinNights: 3, MaxNights: 14},
+		{ID: 2, Name: "No Sunday arrivals", StartDate: date("2050-01-01"), EndDate: date("2051-01-01"),
+			ClosedToArrival: Mask(time.Sunday)},
+		{ID: 3, Name: "Closed", StartDate: date("2050-12-26"), EndDate: date("2050-12-27"),
+			ClosedToArrival: EveryDay, ClosedToDeparture: EveryDay},
+	}
+
+	// 2050-08-01 is a Monday
+	var tests = []struct {
+		name     string
+		start    string
+		end      string
+		violated int
+	}{
+		{"long enough", "2050-08-01", "2050-08-04", 0},
+		{"too short", "2050-08-01", "2050-08-03", 1},
+		{"too long", "2050-08-01", "2050-08-16", 1},
+		{"arrives before the rule", "2050-07-30", "2050-08-01", 0},
+		{"sunday arrival", "2050-07-31", "2050-08-03", 2},
+		{"arrival on a closed day", "2050-12-26", "2050-12-28", 3},
+		{"departure on a closed day", "2050-12-24", "2050-12-26", 3},
+		{"over a closed day", "2050-12-24", "2050-12-28", 0},
+	}
+
+	for _, e := range tests {
+		err := Check(rules, date(e.start), date(e.end))
+
+		var v *Violation
+		switch {
+		case e.violated == 0 && err != nil:
+			t.Errorf("%s: unexpected error %v", e.name, err)
+		case e.violated > 0 && !errors.As(err, &v):
+			t.Errorf("%s: expected rule %d to be broken but got %v", e.name, e.violated, err)
+		case e.violated > 0 && v.Rule.ID != e.violated:
+			t.Errorf("%s: expected rule %d to be broken but rule %d was", e.name, e.violated, v.Rule.ID)
+		}
+	}
+
+	for _, end := range []string{"2050-03-01", "2050-02-28"} {
+		if err := Check(nil, date("2050-03-01"), date(end)); err != ErrInvalidStay {
+			t.Errorf("expected ErrInvalidStay for a stay ending %s but got %v", end, err)
+		}
+	}
+}
+
+func TestNights(t *testing.T) {
+	if n := Nights(date("2050-03-26"), date("2050-04-02")); n != 7 {
+		t.Errorf("expected 7 nights but got %d", n)
+	}
+}
+
+func TestDayNames(t *testing.T) {
+	var tests = []struct {
+		mask     int
+		expected string
+	}{
+		{0, ""},
+		{Mask(time.Sunday, time.Saturday), "Sunday, Saturday"},
+		{EveryDay, "every day"},
+	}
+
+	for _, e := range tests {
+		if got := DayNames(e.mask); got != e.expected {
+			t.Errorf("DayNames(%d) = %q, expected %q", e.mask, got, e.expected)
+		}
+	}
+}
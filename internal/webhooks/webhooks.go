@@ -0,0 +1,295 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/FilipeParreiras/Bookings/internal/models"
+	"github.com/FilipeParreiras/Bookings/internal/repository"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Events are queued as a delivery for every webhook subscribed to them, in the same database as the
+// reservations, so they survive restarts. A Sender claims the due deliveries, so several senders never post the
+// same one, posts them and retries the ones that fail with an exponential backoff, until MaxAttempts.
+//
+// Every request is a json POST signed with the webhook's secret: the X-Bookings-Signature header is
+// "sha256=" and the hex HMAC-SHA256 of the X-Bookings-Timestamp header, a dot and the body.
+
+// The events webhooks can subscribe to
+const (
+	EventReservationCreated   = "reservation.created"
+	EventReservationUpdated   = "reservation.updated"
+	EventReservationProcessed = "reservation.processed"
+	EventReservationDeleted   = "reservation.deleted"
+)
+
+// Events are every event, in the order they are offered to admins
+var Events = []string{
+	EventReservationCreated,
+	EventReservationUpdated,
+	EventReservationProcessed,
+	EventReservationDeleted,
+}
+
+// Statuses of a delivery
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// MaxAttempts is how many times a delivery is tried before it fails for good
+const MaxAttempts = 10
+
+// the first retry is after firstRetry, doubling every attempt up to maxRetry
+const (
+	firstRetry = 30 * time.Second
+	maxRetry   = 6 * time.Hour
+)
+
+// batchSize is how many due deliveries are sent at a time
+const batchSize = 50
+
+// claimLease is how long claimed deliveries are kept from other senders, longer than sending a whole batch to
+// one webhook can take
+const claimLease = 10 * time.Minute
+
+// maxErrorLength is how much of a failed response is kept in the delivery log
+const maxErrorLength = 255
+
+// secretPrefix starts every secret, so they are easy to spot in configs and logs
+const secretPrefix = "whsec_"
+
+// ValidEvent reports if event is one webhooks can subscribe to
+func ValidEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateSecret returns a new random secret to sign payloads with
+func GenerateSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return secretPrefix + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature of a payload sent at timestamp, a unix time
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns how long to wait after a delivery failed for the attempts time
+func Backoff(attempts int) time.Duration {
+	wait := firstRetry
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= maxRetry {
+			return maxRetry
+		}
+	}
+
+	return wait
+}
+
+// Sender posts the queued deliveries to their webhooks
+type Sender struct {
+	DB       repository.DatabaseRepo
+	Client   *http.Client
+	ErrorLog *log.Logger
+}
+
+// NewSender creates a sender that gives endpoints 10 seconds to answer and does not follow redirects
+func NewSender(db repository.DatabaseRepo, errorLog *log.Logger) *Sender {
+	return &Sender{
+		DB: db,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		ErrorLog: errorLog,
+	}
+}
+
+// Run sends the due deliveries every interval until ctx is done
+func (s *Sender) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.DeliverDue(ctx, time.Now()); err != nil {
+			s.ErrorLog.Println(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue claims the deliveries due at now, sends them and records how each went, returning how many were
+// sent. Every webhook is sent its deliveries in order, concurrently with the other webhooks.
+func (s *Sender) DeliverDue(ctx context.Context, now time.Time) (int, error) {
+	sent := 0
+	for {
+		due, err := s.DB.ClaimWebhookDeliveries(ctx, now, claimLease, batchSize)
+		if err != nil {
+			return sent, err
+		}
+
+		// the deliveries of each webhook, in the order they were queued
+		var hooks []int
+		byHook := make(map[int][]models.WebhookDelivery)
+		for _, d := range due {
+			if _, ok := byHook[d.WebhookID]; !ok {
+				hooks = append(hooks, d.WebhookID)
+			}
+			byHook[d.WebhookID] = append(byHook[d.WebhookID], d)
+		}
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		var firstErr error
+		for _, id := range hooks {
+			wg.Add(1)
+			go func(deliveries []models.WebhookDelivery) {
+				defer wg.Done()
+
+				n, err := s.deliverWebhook(ctx, deliveries, now)
+
+				mu.Lock()
+				defer mu.Unlock()
+				sent += n
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}(byHook[id])
+		}
+		wg.Wait()
+
+		if firstErr != nil {
+			return sent, firstErr
+		}
+		if len(due) < batchSize {
+			return sent, nil
+		}
+	}
+}
+
+// deliverWebhook sends the deliveries of one webhook in order, returning how many were sent. Once one is not
+// delivered the rest are not tried until its next attempt, so an endpoint that is down costs one attempt a tick.
+func (s *Sender) deliverWebhook(ctx context.Context, deliveries []models.WebhookDelivery, now time.Time) (int, error) {
+	sent := 0
+	for i, d := range deliveries {
+		d = s.Deliver(ctx, d, now)
+		if err := s.DB.UpdateWebhookDelivery(ctx, d); err != nil {
+			return sent, err
+		}
+		sent++
+
+		if d.Status == StatusDelivered {
+			continue
+		}
+
+		// the rest are retried with it, or after the first retry wait when it failed for good
+		next := d.NextAttemptAt
+		if d.Status == StatusFailed {
+			next = now.Add(firstRetry)
+		}
+		for _, rest := range deliveries[i+1:] {
+			rest.NextAttemptAt = next
+			if err := s.DB.UpdateWebhookDelivery(ctx, rest); err != nil {
+				return sent, err
+			}
+		}
+		return sent, nil
+	}
+
+	return sent, nil
+}
+
+// Deliver posts a delivery to its webhook and returns it with the outcome: delivered for a 2xx response,
+// otherwise pending with its next attempt, or failed after MaxAttempts
+func (s *Sender) Deliver(ctx context.Context, d models.WebhookDelivery, now time.Time) models.WebhookDelivery {
+	d.Attempts++
+	d.Error = ""
+
+	var err error
+	d.StatusCode, err = s.post(ctx, d, now)
+	switch {
+	case err == nil:
+		d.Status = StatusDelivered
+		d.DeliveredAt = now
+	case d.Attempts >= MaxAttempts:
+		d.Status = StatusFailed
+		d.Error = err.Error()
+	default:
+		d.Status = StatusPending
+		d.Error = err.Error()
+		d.NextAttemptAt = now.Add(Backoff(d.Attempts))
+	}
+
+	if len(d.Error) > maxErrorLength {
+		d.Error = d.Error[:maxErrorLength]
+	}
+
+	return d
+}
+
+// post sends the payload of d, returning the status code of the response or 0 when the webhook did not answer
+func (s *Sender) post(ctx context.Context, d models.WebhookDelivery, now time.Time) (int, error) {
+	payload := []byte(d.Payload)
+	timestamp := now.Unix()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, d.Webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "Bookings-Webhooks/1.0")
+	request.Header.Set("X-Bookings-Delivery", strconv.Itoa(d.ID))
+	request.Header.Set("X-Bookings-Event", d.Event)
+	request.Header.Set("X-Bookings-Timestamp", strconv.FormatInt(timestamp, 10))
+	request.Header.Set("X-Bookings-Signature", Sign(d.Webhook.Secret, timestamp, payload))
+
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorLength))
+		return response.StatusCode, fmt.Errorf("%s: %s", response.Status, bytes.TrimSpace(body))
+	}
+
+	// drain the body, so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+
+	return response.StatusCode, nil
+}
@@ -0,0 +1,219 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/FilipeParreiras/Bookings/internal/models"
+	"github.com/FilipeParreiras/Bookings/internal/repository"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	payload := []byte(`{"event": "reservation.created"}`)
+
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte("1700000000." + string(payload)))
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if signature := Sign("whsec_test", 1700000000, payload); signature != expected {
+		t.Errorf("expected %s but got %s", expected, signature)
+	}
+	if Sign("whsec_other", 1700000000, payload) == expected {
+		t.Error("another secret gives the same signature")
+	}
+	if Sign("whsec_test", 1700000001, payload) == expected {
+		t.Error("another timestamp gives the same signature")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	var tests = []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{100, 6 * time.Hour},
+	}
+
+	for _, e := range tests {
+		if wait := Backoff(e.attempts); wait != e.expected {
+			t.Errorf("after %d attempts expected to wait %v but got %v", e.attempts, e.expected, wait)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(secret, "whsec_") || len(secret) != 54 {
+		t.Errorf("unexpected secret %q", secret)
+	}
+
+	other, _ := GenerateSecret()
+	if other == secret {
+		t.Error("two secrets are the same")
+	}
+}
+
+func TestSender_Deliver(t *testing.T) {
+	var received *http.Request
+	var body string
+	status := http.StatusOK
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received, body = r, string(b)
+		w.WriteHeader(status)
+		w.Write([]byte("busy"))
+	}))
+	defer server.Close()
+
+	s := NewSender(nil, nil)
+	now := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	d := models.WebhookDelivery{
+		ID:      7,
+		Event:   EventReservationCreated,
+		Payload: `{"event": "reservation.created"}`,
+		Webhook: models.Webhook{URL: server.URL, Secret: "whsec_test"},
+	}
+
+	// accepted
+	delivered := s.Deliver(context.Background(), d, now)
+	if delivered.Status != StatusDelivered || delivered.StatusCode != 200 || delivered.Attempts != 1 ||
+		!delivered.DeliveredAt.Equal(now) {
+		t.Errorf("unexpected delivery %+v", delivered)
+	}
+	if body != d.Payload || received.Header.Get("X-Bookings-Event") != "reservation.created" ||
+		received.Header.Get("X-Bookings-Delivery") != "7" {
+		t.Errorf("unexpected request %v %s", received.Header, body)
+	}
+	if received.Header.Get("X-Bookings-Timestamp") != "2524651200" ||
+		received.Header.Get("X-Bookings-Signature") != Sign("whsec_test", now.Unix(), []byte(d.Payload)) {
+		t.Error("the request is not signed")
+	}
+
+	// refused, so it is retried later
+	status = http.StatusServiceUnavailable
+	retry := s.Deliver(context.Background(), d, now)
+	if retry.Status != StatusPending || retry.StatusCode != 503 || !retry.NextAttemptAt.Equal(now.Add(Backoff(1))) ||
+		!strings.Contains(retry.Error, "busy") || !retry.DeliveredAt.IsZero() {
+		t.Errorf("unexpected delivery %+v", retry)
+	}
+
+	// redirects are not followed
+	status = http.StatusFound
+	redirected := s.Deliver(context.Background(), d, now)
+	if redirected.Status != StatusPending || redirected.StatusCode != 302 {
+		t.Errorf("unexpected delivery %+v", redirected)
+	}
+
+	// the last attempt fails for good
+	d.Attempts = MaxAttempts - 1
+	failed := s.Deliver(context.Background(), d, now)
+	if failed.Status != StatusFailed || failed.Attempts != MaxAttempts {
+		t.Errorf("unexpected delivery %+v", failed)
+	}
+
+	// no response
+	server.Close()
+	d.Attempts = 0
+	unreachable := s.Deliver(context.Background(), d, now)
+	if unreachable.Status != StatusPending || unreachable.StatusCode != 0 || unreachable.Error == "" {
+		t.Errorf("unexpected delivery %+v", unreachable)
+	}
+}
+
+// queueDB is a DatabaseRepo with only the delivery queue, claiming everything pending and due once
+type queueDB struct {
+	repository.DatabaseRepo
+	mu         sync.Mutex
+	deliveries []models.WebhookDelivery
+	claimed    map[int]bool
+	updates    map[int]models.WebhookDelivery
+}
+
+func (q *queueDB) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	var due []models.WebhookDelivery
+	for _, d := range q.deliveries {
+		if !q.claimed[d.ID] && len(due) < limit {
+			q.claimed[d.ID] = true
+			due = append(due, d)
+		}
+	}
+	return due, nil
+}
+
+func (q *queueDB) UpdateWebhookDelivery(ctx context.Context, d models.WebhookDelivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.updates[d.ID] = d
+	return nil
+}
+
+func TestSender_DeliverDue(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string]int)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received[r.URL.Path]++
+		mu.Unlock()
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	up := models.Webhook{ID: 1, URL: server.URL + "/up"}
+	down := models.Webhook{ID: 2, URL: server.URL + "/down"}
+	q := &queueDB{claimed: make(map[int]bool), updates: make(map[int]models.WebhookDelivery)}
+	for id := 1; id <= 6; id++ {
+		hook := up
+		if id%2 == 0 {
+			hook = down
+		}
+		q.deliveries = append(q.deliveries, models.WebhookDelivery{ID: id, WebhookID: hook.ID, Webhook: hook,
+			Status: StatusPending})
+	}
+
+	now := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+	sent, err := NewSender(q, nil).DeliverDue(context.Background(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the webhook that is down is tried once, and holds back its other deliveries without holding up the other
+	if sent != 4 || received["/up"] != 3 || received["/down"] != 1 {
+		t.Fatalf("expected 4 deliveries sent, 3 up and 1 down, but sent %d and received %v", sent, received)
+	}
+	for _, id := range []int{1, 3, 5} {
+		if q.updates[id].Status != StatusDelivered {
+			t.Errorf("delivery %d was not delivered: %+v", id, q.updates[id])
+		}
+	}
+	retry := now.Add(Backoff(1))
+	if d := q.updates[2]; d.Status != StatusPending || d.Attempts != 1 || !d.NextAttemptAt.Equal(retry) {
+		t.Errorf("unexpected delivery %+v", d)
+	}
+	for _, id := range []int{4, 6} {
+		if d := q.updates[id]; d.Status != StatusPending || d.Attempts != 0 || !d.NextAttemptAt.Equal(retry) {
+			t.Errorf("delivery %d is not held back for the retry: %+v", id, d)
+		}
+	}
+}
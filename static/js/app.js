@@ -107,7 +107,7 @@ function Prompt() {
     }
 }
 
-function ShowCheckAvailability(roomId) {
+function ShowCheckAvailability(roomId, csrfToken) {
     document.getElementById("check-availability-button").addEventListener("click", function () {
         let html = `
         <form id="check-availability-form" action="" method="post" novalidate class="needs-validation">
@@ -136,6 +136,7 @@ function ShowCheckAvailability(roomId) {
                     showOnFocus: true,
                     minDate: Date()
                 })
+                GreyOutUnavailableNights(rp, roomId);
             },
             didOpen: () => {
                 document.getElementById("start").removeAttribute("disabled");
@@ -148,7 +149,7 @@ function ShowCheckAvailability(roomId) {
                 console.log(form);
                 let formData = new FormData(form);
                 console.log("called");
-                formData.append("csrf_token", "{{.CSRFToken}}");
+                formData.append("csrf_token", csrfToken);
                 formData.append("room_id", roomId);
 
                 fetch('/search-availability-json', {
@@ -162,6 +163,7 @@ function ShowCheckAvailability(roomId) {
                                 icon: 'success',
                                 showConfirmButton: false,
                                 msg: '<p>Room is available!</p>' +
+                                    '<p>Total: ' + data.price + '</p>' +
                                     '<p><a href="/book-room?id='
                                     + data.room_id
                                     + '&s='
@@ -172,11 +174,47 @@ function ShowCheckAvailability(roomId) {
                             })
                         } else {
                             attention.error({
-                                msg: "no availability",
+                                msg: data.message || "no availability",
                             })
                         }
                     })
             }
         });
     })
-}
\ No newline at end of file
+}
+
+// GreyOutUnavailableNights disables the nights that are taken in a date range picker, for a room or, without a
+// room id, the nights no room is free. The availability of a month is fetched when the picker first shows it.
+function GreyOutUnavailableNights(rangePicker, roomId) {
+    const disabled = new Set();
+    const loaded = new Set();
+
+    let load = function (date) {
+        const month = date.getFullYear() + '-' + String(date.getMonth() + 1).padStart(2, '0');
+        if (loaded.has(month)) {
+            return;
+        }
+        loaded.add(month);
+
+        let url = '/availability-grid-json?month=' + month;
+        if (roomId) {
+            url += '&room_id=' + roomId;
+        }
+
+        fetch(url)
+            .then(response => response.json())
+            .then(data => {
+                if (!data.ok) {
+                    return;
+                }
+                const nights = roomId ? data.rooms[0].unavailable : data.unavailable;
+                nights.forEach(night => disabled.add(night));
+                rangePicker.setOptions({datesDisabled: Array.from(disabled)});
+            })
+    }
+
+    load(new Date());
+    rangePicker.inputs.forEach(input => {
+        input.addEventListener('changeMonth', event => load(event.detail.viewDate));
+    });
+}